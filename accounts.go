@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+)
+
+// DriveAccount is an extra Google account whose folders feed
+// the same SKUVault outflow, e.g. one per business unit.
+// ClientSecret and TokenFile are paths; a missing token is
+// authorized once at the console and saved to TokenFile.
+// Processed, failed, and hold folders must be shared with
+// the account for its files to be moved there.
+type DriveAccount struct {
+	Name         string
+	ClientSecret string
+	TokenFile    string
+	Folders      []string
+}
+
+var (
+	// accountDrives holds each extra account's Drive handle.
+	accountDrives = map[string]*drive.Service{}
+
+	// fileDrives remembers which account listed a file,
+	// by file id; files missing from it are the main account's.
+	fileDrives sync.Map
+)
+
+// initAccounts connects to every extra Drive account.
+func initAccounts() {
+	for _, a := range cfg.Accounts {
+		b, err := readSecret(a.ClientSecret)
+		if err != nil {
+			log.Fatalf("Unable to read %s client secret: %v", a.Name, err)
+		}
+		config, err := google.ConfigFromJSON(b, driveScope())
+		if err != nil {
+			log.Fatalf("Unable to parse %s client secret: %v", a.Name, err)
+		}
+		tok, err := oTokenFromFile(a.TokenFile)
+		if isCorrupt(err) {
+			log.Fatalf("Unable to use %s cached Drive token: %v", a.Name, err)
+		}
+		if err != nil {
+			fmt.Printf("Authorizing Drive account %s\n", a.Name)
+			tok = authorize(config)
+			saveOToken(a.TokenFile, tok)
+		}
+		srv, err := drive.New(config.Client(context.Background(), tok))
+		if err != nil {
+			log.Fatalf("Unable to retrieve %s drive Service: %v", a.Name, err)
+		}
+		accountDrives[a.Name] = srv
+	}
+}
+
+// accountFiles lists the pending files in every extra
+// account's folders, remembering which account each is from.
+func accountFiles() []*drive.File {
+	var fls []*drive.File
+	for _, a := range cfg.Accounts {
+		if len(a.Folders) == 0 {
+			continue
+		}
+		in := make([]string, len(a.Folders))
+		for i, id := range a.Folders {
+			in[i] = fmt.Sprintf(`'%s' in parents`, id)
+		}
+		q := fmt.Sprintf(`(%s) and trashed = false`, strings.Join(in, " or "))
+		srv := accountDrives[a.Name]
+		listed, err := listPending(srv, q)
+		if err != nil {
+			log.Printf("Unable to list %s files: %v", a.Name, explainDrive(err))
+			continue
+		}
+		for _, f := range listed {
+			fileDrives.Store(f.Id, srv)
+		}
+		fls = append(fls, listed...)
+	}
+	return fls
+}
+
+// driveFor gives the Drive handle of the account a file
+// was listed from.
+func driveFor(id string) *drive.Service {
+	if srv, ok := fileDrives.Load(id); ok {
+		return srv.(*drive.Service)
+	}
+	return drv
+}
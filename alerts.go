@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AlertRule fires when a metric goes above a threshold:
+//
+//	item_failure_pct     percent of a run's items not accepted
+//	payload_failure_pct  percent of a run's payloads rejected
+//	errors               errors recorded in a run
+//	hours_since_files    hours since a run last had files
+//	hours_since_run      hours since a run last finished
+//	ack_latency_hours    longest a run's items took from
+//	                     landing in Drive to being acknowledged
+//
+// The hours_since metrics are also checked on a timer in
+// daemon mode, between runs.
+type AlertRule struct {
+	Name   string
+	Metric string
+	Above  float64
+}
+
+// alertsFile remembers when each rule last fired.
+const alertsFile = "alerts.json"
+
+// alertMetrics are measured per run; timeMetrics are the
+// ones that also change while idle.
+var (
+	alertMetrics = map[string]bool{"item_failure_pct": true, "payload_failure_pct": true, "errors": true, "ack_latency_hours": true}
+	timeMetrics  = map[string]bool{"hours_since_files": true, "hours_since_run": true}
+)
+
+// runMetrics measures a finished run for the alert rules.
+func runMetrics(r runRecord) map[string]float64 {
+	m := timedMetrics()
+	m["errors"] = float64(len(r.Errors))
+	if r.AckLatency > 0 {
+		m["ack_latency_hours"] = r.AckLatency.Hours()
+	}
+	if r.Items > 0 {
+		m["item_failure_pct"] = 100 * float64(r.Items-r.ItemsSent) / float64(r.Items)
+	}
+	if r.Payloads > 0 {
+		m["payload_failure_pct"] = 100 * float64(r.Payloads-r.Succeeded) / float64(r.Payloads)
+	}
+	return m
+}
+
+// timedMetrics measures how long ago runs last finished
+// and last had files, from the run history.
+func timedMetrics() map[string]float64 {
+	m := map[string]float64{}
+	runs, err := loadRuns(time.Time{})
+	if err != nil {
+		log.Printf("Unable to read run history for alerts: %v", err)
+		return m
+	}
+	var lastRun, lastFiles time.Time
+	for _, r := range runs {
+		if r.End.After(lastRun) {
+			lastRun = r.End
+		}
+		if len(r.Files) > 0 && r.End.After(lastFiles) {
+			lastFiles = r.End
+		}
+	}
+	if !lastRun.IsZero() {
+		m["hours_since_run"] = time.Since(lastRun).Hours()
+	}
+	if !lastFiles.IsZero() {
+		m["hours_since_files"] = time.Since(lastFiles).Hours()
+	}
+	return m
+}
+
+// evaluateAlerts fires every rule whose metric is above its
+// threshold, and every stale feed, no more than once per
+// AlertRepeat each, LatencySLO included. With timedOnly, only
+// the hours_since rules are considered.
+func evaluateAlerts(m map[string]float64, timedOnly bool) {
+	defer sendDigest()
+	rules := cfg.Alerts
+	if rule, ok := sloRule(); ok {
+		rules = append(rules[:len(rules):len(rules)], rule)
+	}
+	if len(rules) == 0 && !staleChecks() {
+		return
+	}
+	fired := map[string]time.Time{}
+	readJSON(statePath(alertsFile), &fired)
+
+	changed := staleFeeds(fired)
+	for _, rule := range rules {
+		if timedOnly && !timeMetrics[rule.Metric] {
+			continue
+		}
+		v, ok := m[rule.Metric]
+		if !ok || v <= rule.Above {
+			continue
+		}
+		if time.Since(fired[rule.Name]) < cfg.AlertRepeat.Duration {
+			continue
+		}
+		alert(fmt.Sprintf("%s: %s is %.1f, above %.1f", rule.Name, rule.Metric, v, rule.Above))
+		fired[rule.Name] = time.Now()
+		changed = true
+	}
+	if changed {
+		if err := writeJSON(statePath(alertsFile), fired); err != nil {
+			log.Printf("Unable to save alert state: %v", err)
+		}
+	}
+}
+
+// alert sends a message to every configured destination,
+// or holds it for the next digest when Digest is set.
+func alert(msg string) {
+	say("Alert: " + msg)
+	if cfg.Digest.Duration > 0 {
+		queueDigest(msg)
+		return
+	}
+	notify("Drive2Sku alert", msg)
+}
+
+// notify sends a message to the AlertEmail addresses and
+// the AlertWebhook, which gets a Slack-style {"text": ...} body.
+func notify(subject, msg string) {
+	if len(cfg.AlertEmail) > 0 && cfg.SMTP.Addr != "" {
+		if err := sendMail(cfg.AlertEmail, subject, strings.Replace(msg, "\n", "\r\n", -1)+"\r\n", "", nil); err != nil {
+			log.Printf("Unable to email %s: %v", subject, err)
+		}
+	}
+	if cfg.AlertWebhook != "" {
+		b, _ := json.Marshal(map[string]string{"text": subject + ": " + msg})
+		res, err := http.Post(cfg.AlertWebhook, "application/json", bytes.NewReader(b))
+		if err != nil {
+			log.Printf("Unable to post %s: %v", subject, err)
+			return
+		}
+		res.Body.Close()
+		if res.StatusCode >= 400 {
+			log.Printf("Alert webhook answered %s", res.Status)
+		}
+	}
+}
+
+// validateAlerts rejects rules naming unknown metrics.
+func validateAlerts() {
+	for _, rule := range cfg.Alerts {
+		if !alertMetrics[rule.Metric] && !timeMetrics[rule.Metric] {
+			log.Fatalf("Alert %q has unknown metric %q", rule.Name, rule.Metric)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// snapshotDir holds each vendor's last accepted quantities,
+// keyed by stock position.
+const snapshotDir = "snapshots"
+
+// snapshotPath locates a vendor's snapshot file.
+func snapshotPath(vendor string) string {
+	return statePath(filepath.Join(snapshotDir, vendor+".json"))
+}
+
+// anomalies compares each vendor's feed with its previous
+// snapshot, describing any whose total quantity swings more
+// than AnomalyChange percent or whose SKUs go to zero beyond
+// AnomalyZeroed percent.
+func anomalies(vsd map[string]map[string]Item) []string {
+	var found []string
+	for _, vendor := range vendorOrder(vsd) {
+		prev := map[string]int{}
+		if err := readJSON(snapshotPath(vendor), &prev); err != nil {
+			continue
+		}
+		var before, after, zeroed int
+		for _, q := range prev {
+			before += q
+		}
+		for _, iv := range vsd[vendor] {
+			after += iv.Quantity
+			if iv.Quantity == 0 && prev[keyOf(vendor, iv).String()] > 0 {
+				zeroed++
+			}
+		}
+
+		if cfg.AnomalyChange > 0 && before > 0 {
+			change := 100 * float64(after-before) / float64(before)
+			if change > cfg.AnomalyChange || -change > cfg.AnomalyChange {
+				found = append(found, fmt.Sprintf("%s total quantity %d -> %d (%+.0f%%)", vendor, before, after, change))
+			}
+		}
+		if n := len(vsd[vendor]); cfg.AnomalyZeroed > 0 && n > 0 {
+			if pct := 100 * float64(zeroed) / float64(n); pct > cfg.AnomalyZeroed {
+				found = append(found, fmt.Sprintf("%s %d of %d SKUs went to zero (%.0f%%)", vendor, zeroed, n, pct))
+			}
+		}
+	}
+	return found
+}
+
+// anomalyChecked reports whether files are checked for
+// anomalies against their vendors' snapshots.
+func anomalyChecked() bool {
+	return cfg.AnomalyChange > 0 || cfg.AnomalyZeroed > 0
+}
+
+// saveSnapshots records each vendor's quantities as the
+// baseline for its next file, once SKUVault has accepted
+// them.
+func saveSnapshots(vsd map[string]map[string]Item) {
+	if *readOnly {
+		return
+	}
+	if err := os.MkdirAll(statePath(snapshotDir), 0700); err != nil {
+		log.Printf("Unable to create snapshot directory: %v", err)
+		return
+	}
+	for vendor, v := range vsd {
+		qty := make(map[string]int, len(v))
+		for _, iv := range v {
+			qty[keyOf(vendor, iv).String()] = iv.Quantity
+		}
+		if err := writeJSON(snapshotPath(vendor), qty); err != nil {
+			log.Printf("Unable to save %s snapshot: %v", vendor, err)
+		}
+	}
+}
+
+// screenFile checks a file against its vendors' contracts,
+// for anomalies, and against the run's change caps unless
+// it was approved, reporting whether it may be sent. Files
+// breaking a contract or a cap are held or failed;
+// anomalous files are held in HoldFolder when one is set.
+func screenFile(f drive.File, vsd map[string]map[string]Item) bool {
+	anomalyChecks := anomalyChecked()
+	if !anomalyChecks && !contracted(vsd) && changes == nil {
+		return true
+	}
+	ok := approved(f)
+	if !ok {
+		if found := violations(vsd); len(found) > 0 {
+			breachFile(f, found)
+			return false
+		}
+	}
+	if !ok && anomalyChecks {
+		if found := anomalies(vsd); len(found) > 0 {
+			for _, a := range found {
+				say(fmt.Sprintf("Anomaly in %s: %s", f.Name, a))
+				summary.recordError(f.Name + ": " + a)
+			}
+			if cfg.HoldFolder != "" {
+				holdFile(f, found[0])
+				return false
+			}
+		}
+	}
+	if changes != nil {
+		if why := changes.admit(vsd, ok); why != "" {
+			capFile(f, why)
+			return false
+		}
+	}
+	return true
+}
+
+// holdFile moves a file to the hold folder to await approval.
+func holdFile(f drive.File, why string) {
+	if readOnlySkip(fmt.Sprintf("moving %s to the hold folder: %s", f.Name, why)) {
+		return
+	}
+	say(fmt.Sprintf(`Holding file "%s" (%s) for approval`, f.Name, f.Id))
+	_, err := driveFor(f.Id).Files.Update(f.Id, &drive.File{Description: "Drive2Sku: held, " + why}).
+		AddParents(cfg.HoldFolder).RemoveParents(parentsOf(f)).Do()
+	if err != nil {
+		log.Printf("Unable to move %s to the hold folder: %v", f.Name, explainDrive(err))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxWarnings bounds the distinct warnings a run keeps.
+const maxWarnings = 50
+
+// vaultAnswer is everything SKUVault said to one payload
+// post, taken once from its decoded body for reporting.
+type vaultAnswer struct {
+	Code      int
+	Status    string
+	RequestID string
+	Items     int
+	Errors    []ErrorBody
+	Warnings  []string
+}
+
+// readAnswer gathers a payload post's answer.
+func readAnswer(pl Payload, res *http.Response, body ResponseBody) vaultAnswer {
+	a := vaultAnswer{Code: res.StatusCode, Status: body.Status, Items: len(pl.Items), Errors: body.Errors, Warnings: body.Warnings}
+	if res.Request != nil {
+		a.RequestID = res.Request.Header.Get("X-Request-Id")
+	}
+	if a.Status == "" {
+		a.Status = strings.TrimSpace(strings.TrimPrefix(res.Status, fmt.Sprint(res.StatusCode)))
+	}
+	return a
+}
+
+// key names the answer's kind in the run's status tally,
+// e.g. "200 Success".
+func (a vaultAnswer) key() string {
+	return fmt.Sprintf("%d %s", a.Code, a.Status)
+}
+
+// recordAnswer tallies an answer's status and keeps its
+// warnings, each once.
+func (s *runSummary) recordAnswer(a vaultAnswer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Statuses == nil {
+		s.Statuses = map[string]int{}
+	}
+	s.Statuses[a.key()]++
+	for _, w := range a.Warnings {
+		if len(s.Warnings) >= maxWarnings {
+			break
+		}
+		dup := false
+		for _, seen := range s.Warnings {
+			if seen == w {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			s.Warnings = append(s.Warnings, w)
+		}
+	}
+}
+
+// statusLine sums up the run's answers, most common first.
+// Callers hold the summary's lock.
+func (s *runSummary) statusLine() string {
+	keys := make([]string, 0, len(s.Statuses))
+	for k := range s.Statuses {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if s.Statuses[keys[i]] != s.Statuses[keys[j]] {
+			return s.Statuses[keys[i]] > s.Statuses[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s ×%d", k, s.Statuses[k])
+	}
+	return strings.Join(parts, ", ")
+}
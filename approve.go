@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// approvalsTable audits every release of a held file.
+const approvalsTable = "approvals"
+
+// approval is one audited release of a held file.
+type approval struct {
+	Time time.Time
+	File string
+	Name string
+	By   string
+	Via  string
+	Held string
+}
+
+// audit records an approval in the approvals table and log.
+func audit(a approval) {
+	a.Time = time.Now()
+	say(fmt.Sprintf(`Approved file "%s" (%s) by %s via %s`, a.Name, a.File, a.By, a.Via))
+	if err := appendRecord(approvalsTable, a); err != nil {
+		log.Printf("Unable to record approval of %s: %v", a.File, err)
+	}
+}
+
+// approved reports whether a file was released from hold,
+// by command or endpoint, or by moving it to ApprovedFolder.
+func approved(f drive.File) bool {
+	if f.AppProperties["approved"] == "true" {
+		return true
+	}
+	if cfg.ApprovedFolder == "" || !inFolder(f, cfg.ApprovedFolder) {
+		return false
+	}
+	audit(approval{File: f.Id, Name: f.Name, By: "Drive", Via: "folder", Held: f.Description})
+	return true
+}
+
+// inFolder reports whether a file sits directly in a folder.
+func inFolder(f drive.File, folder string) bool {
+	for _, p := range f.Parents {
+		if p == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// inboxFolder reports whether files in a folder are picked
+// up by runs: the pending folder, and the approved folder.
+func inboxFolder(id string) bool {
+	return id == pendingFolder || (cfg.ApprovedFolder != "" && id == cfg.ApprovedFolder)
+}
+
+// parentsOf lists a file's folders for moving it elsewhere,
+// assuming the pending folder when they were not fetched.
+func parentsOf(f drive.File) string {
+	if len(f.Parents) == 0 {
+		return pendingFolder
+	}
+	return strings.Join(f.Parents, ",")
+}
+
+// approveFile releases a held file back to the pending
+// folder, marked so it skips the anomaly check.
+func approveFile(id, by, via string) error {
+	f, err := drv.Files.Get(id).Fields("id,name,parents,description").Do()
+	if err != nil {
+		return err
+	}
+	_, err = drv.Files.Update(id, &drive.File{AppProperties: map[string]string{"approved": "true"}}).
+		AddParents(pendingFolder).RemoveParents(parentsOf(*f)).Do()
+	if err != nil {
+		return err
+	}
+	audit(approval{File: id, Name: f.Name, By: by, Via: via, Held: f.Description})
+	return nil
+}
+
+// approveCmd releases held files back to the pending folder.
+//
+//	drive2sku approve [-by name] <file-id>...
+func approveCmd(args []string) {
+	by := "unknown"
+	if u, err := user.Current(); err == nil {
+		by = u.Username
+	}
+	fs := flag.NewFlagSet("approve", flag.ExitOnError)
+	fs.StringVar(&by, "by", by, "who is approving, for the audit log")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku approve [-by name] <file-id>...")
+		os.Exit(2)
+	}
+
+	readConfig()
+	initDriveAndVault()
+	for _, id := range fs.Args() {
+		if err := approveFile(id, by, "command"); err != nil {
+			log.Fatalf("Unable to approve %s: %v", id, err)
+		}
+	}
+}
+
+// handleApprove releases a held file over HTTP:
+// POST /approve?id=<file-id>&by=<name> with the
+// ApproveToken as a bearer token. Without an ApproveToken
+// the endpoint is not served at all.
+func handleApprove(w http.ResponseWriter, r *http.Request) {
+	if cfg.ApproveToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST to approve a file", http.StatusMethodNotAllowed)
+		return
+	}
+	// compared in constant time so the token cannot be
+	// guessed a byte at a time
+	got, want := []byte(r.Header.Get("Authorization")), []byte("Bearer "+cfg.ApproveToken)
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		http.Error(w, "bad approve token", http.StatusForbidden)
+		return
+	}
+	id, by := r.URL.Query().Get("id"), r.URL.Query().Get("by")
+	if id == "" || by == "" {
+		http.Error(w, "id and by are required", http.StatusBadRequest)
+		return
+	}
+
+	connect()
+	if err := approveFile(id, by, "endpoint "+r.RemoteAddr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"approved": id})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// downloadLimit paces every Drive download together to
+// DownloadRate, however many run at once.
+var downloadLimit byteLimiter
+
+// byteLimiter hands out a byte rate, reserving each read's
+// share of it in turn.
+type byteLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until n more bytes fit within rate bytes per
+// second, or the context ends.
+func (l *byteLimiter) wait(ctx context.Context, n, rate int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(rate))
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedReader reads no faster than DownloadRate allows.
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// rateChunk is the most read at once from a limited
+// download, keeping the pace smooth at low rates.
+const rateChunk = 16 << 10
+
+func (lr limitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateChunk {
+		p = p[:rateChunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := downloadLimit.wait(lr.ctx, n, cfg.DownloadRate); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// limitDownload paces a download's body when DownloadRate
+// is set.
+func limitDownload(ctx context.Context, r io.Reader) io.Reader {
+	if cfg.DownloadRate <= 0 {
+		return r
+	}
+	return limitedReader{ctx, r}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// batch follows the payloads chunked from a set of files,
+// finishing the files only once every payload is answered:
+// deleted or archived if SKUVault accepted them all, failed
+// otherwise.
+type batch struct {
+	mu      sync.Mutex
+	files   []drive.File
+	pending int
+	failed  int
+	err     error
+	sealed  bool
+	cancel  func()
+
+	// landed is when the oldest file landed in Drive.
+	landed time.Time
+
+	// vsd is the files' items, saved as their vendors'
+	// snapshots once SKUVault accepts them all; nil when
+	// anomalies are not checked.
+	vsd map[string]map[string]Item
+}
+
+// newBatch starts following the given files' payloads,
+// calling cancel once they are finished.
+func newBatch(fs []drive.File, cancel func()) *batch {
+	b := &batch{files: fs, cancel: cancel}
+	for _, f := range fs {
+		if mod := modifiedTime(f); b.landed.IsZero() || mod.Before(b.landed) {
+			b.landed = mod
+		}
+	}
+	return b
+}
+
+// add counts a payload about to be queued.
+func (b *batch) add() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.pending++
+	b.mu.Unlock()
+}
+
+// done counts a payload answered, or given up on.
+func (b *batch) done(ok bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.pending--
+	if !ok {
+		b.failed++
+	}
+	b.mu.Unlock()
+	b.finish()
+}
+
+// fail fails the files whatever their payloads' outcome.
+func (b *batch) fail(err error) {
+	b.mu.Lock()
+	b.err = err
+	b.mu.Unlock()
+}
+
+// seal marks every payload queued, so the files can be
+// finished once the outstanding ones are answered.
+func (b *batch) seal() {
+	b.mu.Lock()
+	b.sealed = true
+	b.mu.Unlock()
+	b.finish()
+}
+
+// finish deletes or fails the files once sealed with no
+// payloads outstanding, exactly once.
+func (b *batch) finish() {
+	b.mu.Lock()
+	if !b.sealed || b.pending > 0 || b.files == nil {
+		b.mu.Unlock()
+		return
+	}
+	fs, err := b.files, b.err
+	if err == nil && b.failed > 0 {
+		err = fmt.Errorf("SKUVault did not accept %d payloads", b.failed)
+	}
+	b.files = nil
+	b.mu.Unlock()
+	b.cancel()
+
+	for _, f := range fs {
+		if err != nil && stopping() {
+			forgetFile(f)
+			unstage(f)
+			log.Printf("Leaving %s pending; shutting down", f.Name)
+		} else if err != nil {
+			forgetFile(f)
+			failFile(f, err)
+		} else {
+			deleteFile(f)
+		}
+	}
+	if err == nil && b.vsd != nil {
+		saveSnapshots(b.vsd)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// benchCmd measures how fast a local file parses, assembles
+// into payloads, and posts to an unthrottled fake vault, then
+// projects a backlog's wall-clock time under the throttle.
+//
+//	drive2sku bench [-n 5] [-backlog items] <file>
+func benchCmd(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := fs.Int("n", 5, "iterations of each stage")
+	backlog := fs.Int("backlog", 0, "items to project for (default: the file's count)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *n < 1 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku bench [-n 5] [-backlog items] <file>")
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+
+	readConfig()
+	readBufferSettings()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Unable to read %s: %v", path, err)
+	}
+
+	// parse
+	var vsd map[string]map[string]Item
+	start := time.Now()
+	for i := 0; i < *n; i++ {
+		if vsd, err = decodeFile(path, bytes.NewReader(b)); err != nil {
+			log.Fatalf("Unable to decode %s: %v", path, err)
+		}
+	}
+	parse := time.Since(start) / time.Duration(*n)
+
+	// assemble
+	var pls []Payload
+	t := time.Now()
+	start = time.Now()
+	for i := 0; i < *n; i++ {
+		var items []Item
+		for _, vendor := range vendorOrder(vsd) {
+			for _, iv := range vsd[vendor] {
+				items = append(items, applyBuffer(vendor, iv, t))
+			}
+		}
+		pls = chunkItems(items)
+	}
+	assemble := time.Since(start) / time.Duration(*n)
+
+	count := 0
+	for _, pl := range pls {
+		count += len(pl.Items)
+	}
+	if count == 0 {
+		log.Fatalf("%s has no items to benchmark", path)
+	}
+
+	// post, against the fake without its rate limit
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Unable to start bench vault: %v", err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, http.HandlerFunc(mockSetItemQuantities))
+	url := "http://" + ln.Addr().String() + "/"
+
+	start = time.Now()
+	for i := 0; i < *n; i++ {
+		for _, pl := range pls {
+			pl.TenantToken, pl.UserToken = mockTokens.TenantToken, mockTokens.UserToken
+			res, err := http.Post(url, "application/json", bytes.NewReader(struct2JSON(pl)))
+			if err != nil {
+				log.Fatalf("Unable to post to bench vault: %v", err)
+			}
+			ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+	}
+	post := time.Since(start) / time.Duration(*n)
+
+	echo(fmt.Sprintf("%d items in %d payloads", count, len(pls)))
+	report := func(stage string, d time.Duration) {
+		fmt.Printf("  %-10s %12v  %12.0f items/sec\n", stage, d, float64(count)/d.Seconds())
+	}
+	report("parse", parse)
+	report("assemble", assemble)
+	report("post", post)
+
+	if *backlog <= 0 {
+		*backlog = count
+	}
+	payloads := (*backlog + plCap - 1) / plCap
+	scale := float64(*backlog) / float64(count)
+	work := time.Duration(float64(parse+assemble) * scale)
+	ticks := (payloads + postsPerTick() - 1) / postsPerTick()
+	wall := time.Duration(ticks) * throttleInterval()
+	if perPost := time.Duration(float64(post) / float64(len(pls))); perPost > throttleInterval() {
+		wall = time.Duration(ticks) * perPost
+	}
+	echo(fmt.Sprintf("Projected %d items: %v (%d payloads at %d per %v)",
+		*backlog, (work + wall).Round(time.Second), payloads, postsPerTick(), throttleInterval()))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Budget is how many calls a SKUVault function takes
+// per window.
+type Budget struct {
+	Calls int
+	Per   duration
+}
+
+// budgetWindow paces calls to one function within its
+// budget, remembering when each call in the window went out.
+type budgetWindow struct {
+	mu    sync.Mutex
+	calls int
+	per   time.Duration
+	sent  []time.Time
+}
+
+var (
+	budgets   = map[string]*budgetWindow{}
+	budgetsMu sync.Mutex
+)
+
+// singleBudget paces SingleFunction when Budgets has no entry
+// for it, since single-item payloads post once per item.
+var singleBudget = Budget{Calls: 60, Per: duration{time.Minute}}
+
+// budgetFor gives a function's budget window, nil when
+// the function has no budget of its own. Shards split
+// each budget evenly.
+func budgetFor(fn string) *budgetWindow {
+	b, ok := cfg.Budgets[fn]
+	if !ok && fn == cfg.SingleFunction {
+		b, ok = singleBudget, true
+	}
+	if !ok {
+		return nil
+	}
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+	w := budgets[fn]
+	if w == nil {
+		shards := cfg.Shards
+		if shards < 1 {
+			shards = 1
+		}
+		w = &budgetWindow{calls: b.Calls, per: time.Duration(shards) * b.Per.Duration}
+		budgets[fn] = w
+	}
+	return w
+}
+
+// wait blocks until the window has room for one more call,
+// then counts it, or gives up when the context ends.
+func (w *budgetWindow) wait(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	for {
+		w.mu.Lock()
+		now := time.Now()
+		for len(w.sent) > 0 && now.Sub(w.sent[0]) >= w.per {
+			w.sent = w.sent[1:]
+		}
+		if len(w.sent) < w.calls {
+			w.sent = append(w.sent, now)
+			w.mu.Unlock()
+			return nil
+		}
+		d := w.per - now.Sub(w.sent[0])
+		w.mu.Unlock()
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// validateBudgets rejects budgets that would never let
+// a call through.
+func validateBudgets() {
+	for fn, b := range cfg.Budgets {
+		if b.Calls < 1 || b.Per.Duration <= 0 {
+			log.Fatalf("Budget for %s needs Calls of at least 1 and a Per window", fn)
+		}
+	}
+}
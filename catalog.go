@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// catalogPageSize is the most products getProducts returns
+// in one page.
+const catalogPageSize = 10000
+
+// catalogFile caches the catalog in the state directory.
+const catalogFile = "catalog.json"
+
+// catalog is a local copy of the SKUs SKUVault knows,
+// with the component lines of those that are kits.
+type catalog struct {
+	Fetched time.Time
+	Skus    []string
+	Kits    map[string][]kitLine
+
+	// ReorderPoints holds the SKUs that have one set;
+	// Suppliers lists SKUs by their SKUVault supplier.
+	ReorderPoints map[string]int      `json:",omitempty"`
+	Suppliers     map[string][]string `json:",omitempty"`
+
+	set map[string]bool
+}
+
+var (
+	skuCatalog *catalog
+	catalogMu  sync.Mutex
+)
+
+// cachedCatalog is the catalog as last cached, without
+// asking SKUVault; nil if there is none.
+func cachedCatalog() *catalog {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	if skuCatalog == nil {
+		c := &catalog{}
+		err := readJSON(statePath(catalogFile), c)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Unable to read SKU catalog: %v", err)
+		}
+		if err == nil {
+			skuCatalog = c
+		}
+	}
+	return skuCatalog
+}
+
+// loadCatalog gives the cached catalog, first refetching
+// it from SKUVault once it is older than CatalogRefresh;
+// a stale copy is kept if refetching fails.
+func loadCatalog() *catalog {
+	c := cachedCatalog()
+	if c != nil && (cfg.CatalogRefresh.Duration <= 0 || c.age() < cfg.CatalogRefresh.Duration) {
+		return c
+	}
+
+	fresh, err := fetchCatalog()
+	if err != nil {
+		log.Printf("Unable to fetch SKU catalog: %v", err)
+		return c
+	}
+	if err := writeJSON(statePath(catalogFile), fresh); err != nil {
+		log.Printf("Unable to cache SKU catalog: %v", err)
+	}
+	echoAt(levelVerbose, fmt.Sprintf("Refreshed SKU catalog: %d SKUs", len(fresh.Skus)))
+
+	catalogMu.Lock()
+	skuCatalog = fresh
+	catalogMu.Unlock()
+	return fresh
+}
+
+// age is how long ago the catalog was fetched.
+func (c *catalog) age() time.Duration {
+	return time.Since(c.Fetched)
+}
+
+// has reports whether SKUVault knows a SKU; a missing
+// catalog knows every SKU.
+func (c *catalog) has(sku string) bool {
+	if c == nil {
+		return true
+	}
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	if c.set == nil {
+		c.set = make(map[string]bool, len(c.Skus))
+		for _, s := range c.Skus {
+			c.set[s] = true
+		}
+	}
+	return c.set[sku]
+}
+
+// fetchCatalog pages through SKUVault's products and kits.
+func fetchCatalog() (*catalog, error) {
+	c := &catalog{
+		Fetched:       time.Now(),
+		Kits:          map[string][]kitLine{},
+		ReorderPoints: map[string]int{},
+		Suppliers:     map[string][]string{},
+	}
+	ctx := runContext
+	ps, err := vault.GetProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ps {
+		c.Skus = append(c.Skus, p.Sku)
+		if p.Supplier != "" {
+			c.Suppliers[p.Supplier] = append(c.Suppliers[p.Supplier], p.Sku)
+		}
+		if p.ReorderPoint > 0 {
+			c.ReorderPoints[p.Sku] = p.ReorderPoint
+		}
+	}
+	ks, err := vault.GetKits(ctx)
+	for _, k := range ks {
+		c.Kits[k.Sku] = k.KitLines
+	}
+	return c, err
+}
+
+// suggestSkus finds up to n catalog SKUs closest to sku,
+// ignoring case, within a few edits of it.
+func (c *catalog) suggestSkus(sku string, n int) []string {
+	if c == nil {
+		return nil
+	}
+	want := strings.ToUpper(sku)
+	limit := len(want)/3 + 1
+	type match struct {
+		sku  string
+		dist int
+	}
+	var ms []match
+	for _, s := range c.Skus {
+		d := len(s) - len(want)
+		if d > limit || -d > limit {
+			continue
+		}
+		if d = editDistance(want, strings.ToUpper(s)); d <= limit {
+			ms = append(ms, match{s, d})
+		}
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].dist != ms[j].dist {
+			return ms[i].dist < ms[j].dist
+		}
+		return ms[i].sku < ms[j].sku
+	})
+	var out []string
+	for i := 0; i < len(ms) && i < n; i++ {
+		out = append(out, ms[i].sku)
+	}
+	return out
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// min3 is the least of three ints.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// skuNotFound reports whether an item error says SKUVault
+// has no such SKU.
+func skuNotFound(e ErrorBody) bool {
+	for _, m := range e.ErrorMessages {
+		m = strings.ToLower(m)
+		if strings.Contains(m, "sku") && (strings.Contains(m, "not found") || strings.Contains(m, "does not exist")) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportUnknownSku reports a SKU SKUVault does not know,
+// along with the closest ones it does know.
+func reportUnknownSku(status int, sku, why string) {
+	msg := fmt.Sprintf("Sku %q %s", sku, why)
+	sugg := loadCatalog().suggestSkus(sku, 3)
+	if len(sugg) > 0 {
+		msg += "; did you mean " + strings.Join(sugg, ", ") + "?"
+	}
+	say(msg)
+	summary.recordError(msg)
+	reportItemErrors(status, "Sku "+why, map[string]interface{}{
+		"sku":         sku,
+		"suggestions": sugg,
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// runChanges tallies what the run's files have changed
+// against the inventory believed set in SKUVault when the
+// run began.
+type runChanges struct {
+	mu    sync.Mutex
+	base  map[string]int
+	total int
+	skus  map[string]bool
+	moved int
+}
+
+// changes is the current run's tally, reset by each relay.
+var changes *runChanges
+
+// changeCapped reports whether either change cap is set.
+func changeCapped() bool {
+	return cfg.MaxChangedSkus > 0 || cfg.MaxChangePercent > 0
+}
+
+// resetChanges starts a run's tally from the latest
+// inventory history.
+func resetChanges() {
+	changes = nil
+	if !changeCapped() {
+		return
+	}
+	ps, err := inventoryOn(time.Now().Format("2006-01-02"))
+	if err != nil {
+		log.Printf("Unable to read inventory history; not capping changes: %v", err)
+		return
+	}
+	if len(ps) == 0 {
+		echo("No inventory history yet; change caps apply from the next run")
+		return
+	}
+	c := &runChanges{base: map[string]int{}, skus: map[string]bool{}}
+	for _, p := range ps {
+		c.base[positionKey(p)] = p.Quantity
+		c.total += p.Quantity
+	}
+	changes = c
+}
+
+// admit adds a file's changes to the run's tally unless
+// they would take it past a cap, describing the cap passed.
+// Forced files are added regardless. Merged runs admit each
+// file in turn, leaving one past a cap out of the merge.
+func (c *runChanges) admit(vsd map[string]map[string]Item, force bool) string {
+	t := time.Now()
+	skus := map[string]bool{}
+	moved := 0
+	for _, vendor := range vendorOrder(vsd) {
+		for _, iv := range vsd[vendor] {
+			for _, part := range splitItem(vendor, applyBuffer(vendor, iv, t)) {
+				key := positionKey(position{Sku: part.Sku, WarehouseID: part.WarehouseID, LocationCode: part.LocationCode, LotNumber: part.LotNumber})
+				old, known := c.base[key]
+				if known && old == part.Quantity {
+					continue
+				}
+				skus[part.Sku] = true
+				if d := part.Quantity - old; d > 0 {
+					moved += d
+				} else {
+					moved -= d
+				}
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.skus)
+	for sku := range skus {
+		if !c.skus[sku] {
+			n++
+		}
+	}
+	var why string
+	switch {
+	case cfg.MaxChangedSkus > 0 && n > cfg.MaxChangedSkus:
+		why = fmt.Sprintf("run would change %d SKUs, over the cap of %d", n, cfg.MaxChangedSkus)
+	case cfg.MaxChangePercent > 0 && c.total > 0 && 100*float64(c.moved+moved)/float64(c.total) > cfg.MaxChangePercent:
+		why = fmt.Sprintf("run would move %.1f%% of catalog quantity, over the cap of %g%%",
+			100*float64(c.moved+moved)/float64(c.total), cfg.MaxChangePercent)
+	}
+	if why != "" && !force {
+		return why
+	}
+	for sku := range skus {
+		c.skus[sku] = true
+	}
+	c.moved += moved
+	return ""
+}
+
+// capFile holds a file that would take the run past a
+// change cap, or fails it when there is no HoldFolder.
+func capFile(f drive.File, why string) {
+	say(fmt.Sprintf("Change cap reached at %s: %s", f.Name, why))
+	summary.recordError(f.Name + ": " + why)
+	if cfg.HoldFolder != "" {
+		holdFile(f, why)
+		return
+	}
+	failFile(f, errors.New(why))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// commands maps each subcommand name to its handler;
+// running without a subcommand performs the normal sync.
+var commands = map[string]func(args []string){
+	"approve":  approveCmd,
+	"bench":    benchCmd,
+	"compare":  compareCmd,
+	"daemon":   daemonCmd,
+	"diff":     diffCmd,
+	"doctor":   doctorCmd,
+	"genmap":   genmapCmd,
+	"janitor":  janitorCmd,
+	"po":       poCmd,
+	"pull":     pullCmd,
+	"replay":   replayCmd,
+	"report":   reportCmd,
+	"run":      runCmd,
+	"serve":    serveCmd,
+	"service":  serviceCmd,
+	"status":   statusCmd,
+	"stock":    stockCmd,
+	"tail":     tailCmd,
+	"validate": validateCmd,
+	"vendor":   vendorCmd,
+	"watch":    watchCmd,
+}
+
+// runCommand dispatches to the named subcommand,
+// exiting with usage if it does not exist.
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+		os.Exit(2)
+	}
+	cmd(args)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runSide is one side of a comparison: a single run or
+// every run of a day, with the day whose inventory it left.
+type runSide struct {
+	Label string
+	Day   string
+	Runs  []runRecord
+}
+
+// compareCmd compares two runs, or two days of runs, by
+// vendor, error category, failing SKUs, and the quantities
+// left set in SKUVault at each day's end.
+//
+//	drive2sku compare [-top 20] <run-id|yyyy-mm-dd> <run-id|yyyy-mm-dd>
+func compareCmd(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	top := fs.Int("top", 20, "most quantity changes to list")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku compare [-top 20] <run-id|yyyy-mm-dd> <run-id|yyyy-mm-dd>")
+		os.Exit(2)
+	}
+
+	readConfig()
+	readBufferSettings()
+	runs, err := loadRuns(time.Time{})
+	if err != nil {
+		log.Fatalf("Unable to read run history: %v", err)
+	}
+	a := pickSide(fs.Arg(0), runs)
+	b := pickSide(fs.Arg(1), runs)
+
+	echo(fmt.Sprintf("Comparing %s with %s", a.Label, b.Label))
+	compareTotals(a, b)
+	compareVendors(a, b)
+	compareErrors(a, b)
+	compareFailing(a, b)
+	compareStock(a, b, *top)
+}
+
+// pickSide finds the runs an argument names: a run ID or a
+// day, yyyy-mm-dd.
+func pickSide(arg string, runs []runRecord) runSide {
+	if _, err := time.Parse("2006-01-02", arg); err == nil {
+		s := runSide{Label: arg, Day: arg}
+		for _, r := range runs {
+			if r.Start.Format("2006-01-02") == arg {
+				s.Runs = append(s.Runs, r)
+			}
+		}
+		if len(s.Runs) == 0 {
+			say(fmt.Sprintf("No runs recorded on %s", arg))
+		}
+		return s
+	}
+	for _, r := range runs {
+		if r.ID == arg {
+			return runSide{Label: "run " + arg, Day: r.Start.Format("2006-01-02"), Runs: []runRecord{r}}
+		}
+	}
+	log.Fatalf("No run %q in the history; give a run ID or a day, yyyy-mm-dd", arg)
+	return runSide{}
+}
+
+// compareTotals prints how the sides' totals moved.
+func compareTotals(a, b runSide) {
+	type totals struct{ runs, files, items, sent, failed, errs, held int }
+	sum := func(s runSide) totals {
+		var t totals
+		for _, r := range s.Runs {
+			t.runs++
+			t.files += len(r.Files)
+			t.items += r.Items
+			t.sent += r.ItemsSent
+			t.failed += r.Payloads - r.Succeeded
+			t.errs += len(r.Errors)
+			t.held += r.Quarantined
+		}
+		return t
+	}
+	ta, tb := sum(a), sum(b)
+	echo("Totals")
+	for _, row := range []struct {
+		name string
+		a, b int
+	}{
+		{"runs", ta.runs, tb.runs},
+		{"files", ta.files, tb.files},
+		{"items queued", ta.items, tb.items},
+		{"items sent", ta.sent, tb.sent},
+		{"payloads failed", ta.failed, tb.failed},
+		{"errors", ta.errs, tb.errs},
+		{"items held", ta.held, tb.held},
+	} {
+		fmt.Printf("  %-16s %7d -> %-7d (%+d)\n", row.name, row.a, row.b, row.b-row.a)
+	}
+}
+
+// compareVendors prints vendors whose items or rejects
+// moved, and vendors present on only one side.
+func compareVendors(a, b runSide) {
+	sum := func(s runSide) map[string]vendorStats {
+		m := map[string]vendorStats{}
+		for _, r := range s.Runs {
+			for vendor, st := range r.Vendors {
+				t := m[vendor]
+				t.Items += st.Items
+				t.Rejected += st.Rejected
+				m[vendor] = t
+			}
+		}
+		return m
+	}
+	va, vb := sum(a), sum(b)
+	names := map[string]bool{}
+	for vendor := range va {
+		names[vendor] = true
+	}
+	for vendor := range vb {
+		names[vendor] = true
+	}
+	var changed []string
+	for vendor := range names {
+		if va[vendor] != vb[vendor] {
+			changed = append(changed, vendor)
+		}
+	}
+	sort.Strings(changed)
+
+	echo(fmt.Sprintf("Vendors changed %d", len(changed)))
+	for _, vendor := range changed {
+		x, y := va[vendor], vb[vendor]
+		note := ""
+		if _, ok := va[vendor]; !ok {
+			note = " (new)"
+		} else if _, ok := vb[vendor]; !ok {
+			note = " (missing)"
+		}
+		fmt.Printf("  %-16s items %d -> %d (%+d), rejected %d -> %d%s\n",
+			vendor, x.Items, y.Items, y.Items-x.Items, x.Rejected, y.Rejected, note)
+	}
+}
+
+var (
+	quotedPattern = regexp.MustCompile(`"[^"]*"`)
+	numberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// errorCategory reduces a recorded error to its kind,
+// dropping the file or row it came from, quoted values,
+// numbers, and catalog suggestions.
+func errorCategory(msg string) string {
+	if i := strings.Index(msg, "; did you mean"); i >= 0 {
+		msg = msg[:i]
+	}
+	if i := strings.Index(msg, "Sku \""); i > 0 {
+		msg = msg[i:]
+	} else if i := strings.Index(msg, ": "); i > 0 && !strings.Contains(msg[:i], " ") {
+		msg = msg[i+2:]
+	}
+	msg = quotedPattern.ReplaceAllString(msg, `"…"`)
+	return numberPattern.ReplaceAllString(msg, "N")
+}
+
+// compareErrors prints the error categories whose counts moved.
+func compareErrors(a, b runSide) {
+	count := func(s runSide) map[string]int {
+		m := map[string]int{}
+		for _, r := range s.Runs {
+			for _, e := range r.Errors {
+				m[errorCategory(e)]++
+			}
+		}
+		return m
+	}
+	ca, cb := count(a), count(b)
+	var cats []string
+	for c := range ca {
+		if ca[c] != cb[c] {
+			cats = append(cats, c)
+		}
+	}
+	for c := range cb {
+		if _, ok := ca[c]; !ok {
+			cats = append(cats, c)
+		}
+	}
+	sort.Slice(cats, func(i, j int) bool {
+		di, dj := abs(cb[cats[i]]-ca[cats[i]]), abs(cb[cats[j]]-ca[cats[j]])
+		if di != dj {
+			return di > dj
+		}
+		return cats[i] < cats[j]
+	})
+
+	echo(fmt.Sprintf("Error categories changed %d", len(cats)))
+	for _, c := range cats {
+		fmt.Printf("  %5d -> %-5d %s\n", ca[c], cb[c], c)
+	}
+}
+
+// compareFailing prints SKUs that started or stopped failing.
+func compareFailing(a, b runSide) {
+	failing := func(s runSide) map[string]bool {
+		m := map[string]bool{}
+		for _, r := range s.Runs {
+			for _, e := range r.Errors {
+				if sm := skuPattern.FindStringSubmatch(e); sm != nil {
+					m[sm[1]] = true
+				}
+			}
+		}
+		return m
+	}
+	fa, fb := failing(a), failing(b)
+	var started, stopped []string
+	for sku := range fb {
+		if !fa[sku] {
+			started = append(started, sku)
+		}
+	}
+	for sku := range fa {
+		if !fb[sku] {
+			stopped = append(stopped, sku)
+		}
+	}
+	sort.Strings(started)
+	sort.Strings(stopped)
+
+	echo(fmt.Sprintf("SKUs started failing %d", len(started)))
+	for _, sku := range started {
+		fmt.Printf("  + %s\n", sku)
+	}
+	echo(fmt.Sprintf("SKUs stopped failing %d", len(stopped)))
+	for _, sku := range stopped {
+		fmt.Printf("  - %s\n", sku)
+	}
+}
+
+// compareStock prints the positions whose quantity differs
+// between the sides' days, largest moves first.
+func compareStock(a, b runSide, top int) {
+	if a.Day == b.Day {
+		echo("Both sides fall on " + a.Day + "; quantities are kept by day, so none compared")
+		return
+	}
+	load := func(day string) map[string]position {
+		ps, err := inventoryOn(day)
+		if err != nil {
+			log.Fatalf("Unable to read inventory history: %v", err)
+		}
+		m := make(map[string]position, len(ps))
+		for _, p := range ps {
+			m[positionKey(p)] = p
+		}
+		return m
+	}
+	pa, pb := load(a.Day), load(b.Day)
+
+	type move struct {
+		p      position
+		before int
+	}
+	var moves []move
+	for k, p := range pb {
+		if q, ok := pa[k]; !ok || q.Quantity != p.Quantity {
+			moves = append(moves, move{p, q.Quantity})
+		}
+	}
+	for k, p := range pa {
+		if _, ok := pb[k]; !ok {
+			q := p
+			q.Quantity = 0
+			moves = append(moves, move{q, p.Quantity})
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		di := abs(moves[i].p.Quantity - moves[i].before)
+		dj := abs(moves[j].p.Quantity - moves[j].before)
+		if di != dj {
+			return di > dj
+		}
+		return positionKey(moves[i].p) < positionKey(moves[j].p)
+	})
+
+	echo(fmt.Sprintf("Quantities changed %d between %s and %s", len(moves), a.Day, b.Day))
+	for i, m := range moves {
+		if i == top {
+			fmt.Printf("  … %d more\n", len(moves)-top)
+			break
+		}
+		k := keyOf(m.p.Vendor, Item{Sku: m.p.Sku, WarehouseID: m.p.WarehouseID, LocationCode: m.p.LocationCode, LotNumber: m.p.LotNumber})
+		fmt.Printf("  ~ %s qty=%d -> %d (%+d)\n", k, m.before, m.p.Quantity, m.p.Quantity-m.before)
+	}
+}
+
+// abs gives the size of a change.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
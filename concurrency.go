@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// fetched is a downloaded, decoded file along with the
+// deadline its processing must finish by, if any.
+// Interrupted files are left for the next run: cut short
+// by the run deadline or shutdown, or changed since listed. Held counts
+// the items kept in memory; spooled files' items wait on
+// disk instead.
+type fetched struct {
+	vsd         map[string]map[string]Item
+	deadline    time.Time
+	err         error
+	interrupted bool
+	held        int
+	spooled     string
+}
+
+// fetchFeeds downloads and decodes files concurrently,
+// within the global and per-vendor limits, returning
+// each file's result in the files' order.
+func fetchFeeds(fls []*drive.File) []fetched {
+	fetches, ready := fetchAsync(fls, false)
+	for _, r := range ready {
+		<-r
+	}
+	return fetches
+}
+
+// fetchAsync starts fetching files as fetchFeeds does,
+// without waiting; each file's channel is closed once its
+// result is in. With spill, files decoded past MemoryItems
+// are spooled to disk.
+func fetchAsync(fls []*drive.File, spill bool) ([]fetched, []chan struct{}) {
+	dlSem := make(chan struct{}, limit(cfg.MaxDownloads))
+	parseSem := make(chan struct{}, limit(cfg.MaxParsers))
+	vendorSems := map[string]chan struct{}{}
+	for vendor, vs := range settings {
+		if vs.MaxDownloads > 0 {
+			vendorSems[vendor] = make(chan struct{}, vs.MaxDownloads)
+		}
+	}
+
+	fetches := make([]fetched, len(fls))
+	ready := make([]chan struct{}, len(fls))
+	for i, f := range fls {
+		ready[i] = make(chan struct{})
+		go func(i int, f drive.File) {
+			defer close(ready[i])
+
+			if vendor, ok := fileVendor(f.Name); ok && vendorSems[vendor] != nil {
+				vendorSems[vendor] <- struct{}{}
+				defer func() { <-vendorSems[vendor] }()
+			}
+
+			ctx := runContext
+			if cfg.FileTimeout.Duration > 0 {
+				fetches[i].deadline = time.Now().Add(cfg.FileTimeout.Duration)
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, fetches[i].deadline)
+				defer cancel()
+			}
+
+			if nativeDoc(f) {
+				fetches[i].err = fmt.Errorf("is a Google Docs file (%s); upload it as CSV or JSON instead", f.MimeType)
+				return
+			}
+
+			// a copy staged by a run cut short is used as is
+			var err error
+			b, resumed := staged(f)
+			if resumed {
+				echoAt(levelVerbose, fmt.Sprintf("Resuming %s from its staged copy", f.Name))
+			} else {
+				dlSem <- struct{}{}
+				b, err = downloadFile(ctx, f)
+				if err == nil && verifyDownload(f, b) != nil {
+					// a transfer cut short is tried once more
+					b, err = downloadFile(ctx, f)
+				}
+				<-dlSem
+				if accessLost(err) {
+					// deleted or unshared since it was listed
+					fileLost(f, "download", err)
+					fetches[i].interrupted = true
+					fetches[i].err = explainDrive(err)
+					return
+				}
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Fatalf("Unable to download file: %v", explainDrive(err))
+					}
+					fetches[i].interrupted = runContext.Err() != nil
+					fetches[i].err = fmt.Errorf("timed out downloading after %v", cfg.FileTimeout.Duration)
+					return
+				}
+				if err := verifyDownload(f, b); err != nil {
+					// most likely replaced since it was listed
+					say(fmt.Sprintf("Leaving %s for the next run; %v", f.Name, err))
+					fetches[i].interrupted = true
+					fetches[i].err = err
+					return
+				}
+				stageFile(f, b)
+			}
+
+			parseSem <- struct{}{}
+			fetches[i].vsd, err = decodeFile(f.Name, bytes.NewReader(b))
+			<-parseSem
+			if ctx.Err() != nil {
+				fetches[i].err = fmt.Errorf("timed out parsing after %v", cfg.FileTimeout.Duration)
+			} else if err != nil {
+				fetches[i].err = fmt.Errorf("unable to decode: %v", err)
+			} else {
+				sampleItems(fetches[i].vsd)
+				if !replaying {
+					recordArrival(f, len(b), fetches[i].vsd)
+				}
+				if spill {
+					holdItems(f, &fetches[i])
+				}
+			}
+		}(i, *f)
+	}
+	return fetches, ready
+}
+
+// limit treats unset concurrency limits as one at a time.
+func limit(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds program-wide settings read from config.json.
+// Every setting is optional; a missing file keeps the defaults.
+type Config struct {
+	// VaultURL, VaultPath, and VaultVersion locate the SKUVault
+	// API, e.g. a sandbox host or a versioned path segment.
+	VaultURL     string
+	VaultPath    string
+	VaultVersion string
+
+	// MergeFiles folds all pending files into one deduplicated
+	// run where the latest modified file wins per SKU/location.
+	MergeFiles bool
+
+	// Interval is how long the daemon waits between runs.
+	Interval duration
+
+	// Leader elects one active daemon among replicas:
+	// "kubernetes" holds a coordination Lease, "drive" a lock
+	// file in LockFolder; empty runs without election.
+	Leader        string
+	LeaseName     string
+	LeaseDuration duration
+	LockFolder    string
+
+	// Shards is how many instances share the pending folder,
+	// each posting at its share of SKUVault's rate budget.
+	// Files are claimed once downloaded, whatever the count.
+	Shards        int
+	ClaimDuration duration
+
+	// WatchToken is the shared secret Drive echoes back on
+	// change notifications, rejecting any that lack it.
+	WatchToken string
+
+	// SentryDSN, when set, reports pipeline and item errors
+	// to Sentry, tagged with SentryEnvironment.
+	SentryDSN         string
+	SentryEnvironment string
+
+	// LogShipping names extra log destinations, "syslog" and/or
+	// "cloud" (Google Cloud Logging, via default credentials).
+	LogShipping  []string
+	SyslogAddr   string
+	CloudProject string
+	CloudLog     string
+
+	// DebugAddr serves pprof and expvar for long-running modes,
+	// e.g. "localhost:6060"; empty disables it.
+	DebugAddr string
+
+	// StateDir holds the program's state files.
+	StateDir string
+
+	// HealthAddr serves GET /healthz in daemon mode, and
+	// GET /events for tail. Health fails once the last run
+	// is older than HealthMaxAge, by default two intervals
+	// plus an hour.
+	HealthAddr   string
+	HealthMaxAge duration
+
+	// AccessRetry is how long the daemon waits between runs
+	// while the Drive folder is inaccessible, 30m by default.
+	AccessRetry duration
+
+	// ProcessedFolder, when set, archives finished files into
+	// that Drive folder instead of deleting them.
+	ProcessedFolder string
+
+	// Retention is how long the janitor keeps each kind of
+	// leftover: "processed" Drive files, the "spool",
+	// "inventory", and "staging" state directories,
+	// and rows of any state table by name (e.g. "runs"). Kinds
+	// not listed are kept.
+	Retention map[string]duration
+
+	// MaxDownloads, MaxParsers, and MaxPosts bound concurrent
+	// Drive downloads, file parses, and in-flight SKUVault posts.
+	MaxDownloads int
+	MaxParsers   int
+	MaxPosts     int
+
+	// FairShare works through each vendor's files side by side,
+	// taking turns between vendors' payloads, each vendor
+	// sending as many in a row as its Priority, rather than
+	// finishing one file before starting the next.
+	FairShare bool
+
+	// PostsPerTick starts up to this many payload posts in each
+	// throttle interval rather than one, for SKUVault accounts
+	// allowed concurrent calls; MaxPosts still bounds how many
+	// are in flight.
+	PostsPerTick int
+
+	// MemoryItems caps the decoded items held in memory while
+	// earlier files post; files decoded past it wait in the
+	// "spool" state directory until their turn. Zero keeps
+	// every file in memory.
+	MemoryItems int
+
+	// DownloadRate caps Drive downloads, all together, at this
+	// many bytes per second so runs leave room on a shared
+	// line; zero is no cap.
+	DownloadRate int
+
+	// FileTimeout limits each file's download, parse, and
+	// posting; files running over are moved to FailedFolder,
+	// or left pending when no such folder is set.
+	FileTimeout  duration
+	FailedFolder string
+
+	// RunDeadline stops a run from starting new files once it
+	// has gone on this long; the rest wait for the next run.
+	RunDeadline duration
+
+	// ProgressEvery is how often a run reports its progress.
+	ProgressEvery duration
+
+	// Gzip compresses SKUVault request bodies, falling back to
+	// plain bodies if SKUVault refuses them.
+	Gzip bool
+
+	// MaxPayloadBytes caps a payload's serialized size, closing
+	// it early when long location codes would otherwise draw
+	// a 413; zero leaves only the 100-item cap.
+	MaxPayloadBytes int
+
+	// QuarantineFolder, when set, receives a CSV of each run's
+	// items held back for warehouses SKUVault does not know.
+	QuarantineFolder string
+
+	// CatalogRefresh is how old the cached SKUVault catalog may
+	// get before it is fetched again. PreValidate holds back
+	// items whose SKU is not in the catalog.
+	CatalogRefresh duration
+	PreValidate    bool
+
+	// Kits says what to do with SKUs the catalog lists as kits:
+	// "skip" them with a warning, or "expand" them into their
+	// components' quantities. Unset, the default, posts them
+	// as they are without loading the catalog.
+	Kits string
+
+	// LotFunction is the SKUVault function that takes
+	// quantities for lot-tracked items.
+	LotFunction string
+
+	// PriceFolder, when set, holds vendor price files whose
+	// cost and prices are posted to updateProducts, one call
+	// per PriceThrottle, after each stock run.
+	PriceFolder   string
+	PriceThrottle duration
+
+	// AnomalyChange and AnomalyZeroed flag a vendor whose total
+	// quantity moves by more than that percent since its last
+	// file, or whose SKUs go to zero beyond that percent; zero
+	// turns a check off. Flagged files wait in HoldFolder for
+	// approval when it is set.
+	AnomalyChange float64
+	AnomalyZeroed float64
+	HoldFolder    string
+
+	// MaxChangedSkus and MaxChangePercent cap what one run may
+	// change: the SKUs whose quantities differ from the
+	// inventory history, and the quantity moved as a percent
+	// of the history's total. A file that would pass a cap is
+	// held like an anomaly, or failed without a HoldFolder;
+	// zero turns a cap off.
+	MaxChangedSkus   int
+	MaxChangePercent float64
+
+	// TrendFactor holds items for review, with the quarantined
+	// ones, whose quantity is over that many times the median
+	// of their last TrendHistory posted quantities, or under
+	// the median divided by it; zero turns it off.
+	TrendFactor  float64
+	TrendHistory int
+
+	// ApprovedFolder, when set, is picked up like the pending
+	// folder, its files released from hold. ApproveToken
+	// enables POST /approve in serve mode as a bearer token.
+	ApprovedFolder string
+	ApproveToken   string
+
+	// ControlFolder, when set, is checked every TriggerPoll
+	// (a minute by default) between daemon runs for a file
+	// named TriggerName ("RUN_NOW" by default), which starts
+	// a run at once and is then deleted.
+	ControlFolder string
+	TriggerName   string
+	TriggerPoll   duration
+
+	// ConfirmItems is how many items a file may hold before
+	// -confirm asks whether to post it.
+	ConfirmItems int
+
+	// RejectPercent rejects files whose items fail validation
+	// beyond that percent, emailing each vendor's Contact the
+	// problem rows through SMTP; zero turns it off.
+	RejectPercent float64
+	SMTP          SMTPConfig
+
+	// Alerts are checked after every run, and on a timer in
+	// daemon mode; each rule fires at most once per AlertRepeat
+	// to AlertEmail through SMTP and to AlertWebhook.
+	Alerts       []AlertRule
+	AlertRepeat  duration
+	AlertEmail   []string
+	AlertWebhook string
+
+	// LatencySLO alerts, as the "latency_slo" rule, when a
+	// run's items take longer than this from their file
+	// landing in Drive to SKUVault acknowledging them.
+	LatencySLO duration
+
+	// Digest holds alerts back and sends one summary per
+	// period instead: runs, alerts, top failing SKUs, and
+	// vendors with no feed. Zero sends each alert as it fires.
+	Digest duration
+
+	// Accounts are extra Google Drive accounts whose folders
+	// are read alongside the pending folder each run.
+	Accounts []DriveAccount
+
+	// DriveScope is the Drive access requested: "drive" for
+	// full access, or the narrower "drive.file" with folders
+	// shared as the README describes.
+	DriveScope string
+
+	// AuthFlow is how Drive is first authorized: "device" for
+	// the device code grant, anything else the browser flow.
+	// Google grants device codes only narrower Drive scopes.
+	AuthFlow string
+
+	// Secrets keeps client_secret.json, the SKUVault account
+	// file, and cached tokens in a secret store instead of
+	// plain files.
+	Secrets SecretsConfig
+
+	// Dedup skips files whose content was already relayed
+	// within a window, remembered in memory, the state
+	// directory, or Redis.
+	Dedup DedupConfig
+
+	// TokenRotation is how old SKUVault tokens may get before
+	// a run exchanges the account login for new ones; zero
+	// keeps the cached tokens until they are deleted.
+	TokenRotation duration
+
+	// Retries is how many times a throttled SKUVault call is
+	// sent again, and a payload resubmitted after a timeout or
+	// server error, waiting Retry-After or else RetryBackoff,
+	// doubled each time. Rejections such as an unknown SKU or
+	// warehouse are reported at once.
+	Retries      int
+	RetryBackoff duration
+
+	// SingleItemMax sends payloads of up to this many items
+	// one item at a time to SingleFunction, which SKUVault
+	// limits apart from the bulk endpoint; zero never does.
+	SingleItemMax  int
+	SingleFunction string
+
+	// FeedExtensions and FeedMimeTypes, when either is set,
+	// limit which pending files are downloaded as feeds, e.g.
+	// [".csv", ".json"] or ["text/csv", "application/*"].
+	// Other files, like PDFs or readmes, are reported and
+	// left in the folder.
+	FeedExtensions []string
+	FeedMimeTypes  []string
+
+	// FileNames is the naming convention pending files must
+	// follow, a regular expression whose named groups vendor,
+	// type, and date are read from each name, e.g.
+	// "^(?P<vendor>[A-Z]+)_(?P<type>[A-Z]+)_(?P<date>\\d{8})\\.".
+	// Files not matching are failed. The date, parsed with
+	// FileDateLayout ("20060102" by default), orders files
+	// and dates vendor freshness.
+	FileNames      string
+	FileDateLayout string
+
+	// StaleAfter alerts when a vendor in buffers.json has sent
+	// no file for this long; zero turns it off.
+	StaleAfter duration
+
+	// Budgets caps calls to SKUVault functions by name, e.g.
+	// "products/updateProducts", at Calls per Per split across
+	// Shards, so one function's calls cannot use up another's
+	// limit; a call waits for room in its own budget.
+	// Functions not listed are paced only by their callers,
+	// except SingleFunction, which defaults to 60 calls a minute.
+	Budgets map[string]Budget
+
+	// SampleItems logs each file's first items as they were
+	// read, at DEBUG severity, masking the Item fields named
+	// in SampleRedact (e.g. "LocationCode"); zero logs none.
+	SampleItems  int
+	SampleRedact []string
+}
+
+// duration is a time.Duration written in config
+// as a string such as "90s", "2h", or "30d".
+type duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a quoted duration string.
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := parseAge(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// parseAge parses a Go duration, also accepting whole days as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// MarshalJSON writes the duration back in its string form.
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// cfg is the program-wide configuration.
+var cfg Config
+
+// readConfig pulls in config.json, if present, over the defaults.
+func readConfig() {
+	cfg = Config{
+		VaultURL:        "https://app.skuvault.com",
+		VaultPath:       "api",
+		Interval:        duration{time.Hour},
+		LeaseName:       "drive2sku",
+		LeaseDuration:   duration{time.Minute},
+		LockFolder:      pendingFolder,
+		ClaimDuration:   duration{2 * time.Hour},
+		CloudLog:        "drive2sku",
+		StateDir:        ".",
+		MaxDownloads:    4,
+		MaxParsers:      runtime.NumCPU(),
+		MaxPosts:        1,
+		MaxPayloadBytes: 64 << 10,
+		CatalogRefresh:  duration{24 * time.Hour},
+		LotFunction:     "inventory/setLotItemQuantities",
+		AlertRepeat:     duration{6 * time.Hour},
+		DriveScope:      "drive",
+		TokenRotation:   duration{7 * 24 * time.Hour},
+		Retries:         3,
+		RetryBackoff:    duration{10 * time.Second},
+		SingleFunction:  "inventory/setItemQuantity",
+		ConfirmItems:    1000,
+		TrendHistory:    10,
+	}
+	err := readJSON("config.json", &cfg)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Unable to read config: %v", err)
+	}
+	switch cfg.Kits {
+	case "", "skip", "expand":
+	default:
+		log.Fatalf("Unknown Kits setting %q; use \"skip\" or \"expand\"", cfg.Kits)
+	}
+	switch cfg.Dedup.Backend {
+	case "", "memory", "file", "redis":
+	default:
+		log.Fatalf("Unknown Dedup backend %q; use \"memory\", \"file\", or \"redis\"", cfg.Dedup.Backend)
+	}
+	compileFileNames()
+	validateAlerts()
+	validateBudgets()
+	if err := os.MkdirAll(cfg.StateDir, 0700); err != nil {
+		log.Fatalf("Unable to create state directory: %v", err)
+	}
+	initLogging()
+	if *mockVault {
+		startMockVault()
+	}
+}
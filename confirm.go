@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	confirmOps = flag.Bool("confirm", false, "ask before deleting Drive files or posting files over ConfirmItems")
+	assumeYes  = flag.Bool("yes", false, "answer yes to every confirmation")
+)
+
+// confirmMu keeps prompts from files processed side by
+// side from running into each other.
+var confirmMu sync.Mutex
+
+// confirmOp asks before a destructive step when -confirm
+// is given; -yes, or not being asked at all, lets it go
+// ahead. Without a console to ask on, the answer is no.
+func confirmOp(question string) bool {
+	if !*confirmOps || *assumeYes {
+		return true
+	}
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		say(fmt.Sprintf("%s No console to confirm on; skipping", question))
+		return false
+	}
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+	return confirm(question)
+}
+
+// confirmPost asks before posting a file whose items
+// number more than ConfirmItems.
+func confirmPost(name string, items int) bool {
+	if items <= cfg.ConfirmItems {
+		return true
+	}
+	return confirmOp(fmt.Sprintf("Post %d items from %s to SKUVault at %s?", items, name, cfg.VaultURL))
+}
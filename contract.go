@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Contract is what a vendor has agreed its feed files hold.
+type Contract struct {
+	// Required names the Item fields every item must fill:
+	// LocationCode, WarehouseID, LotNumber, or ExpirationDate.
+	Required []string `json:",omitempty"`
+
+	// Warehouses lists the warehouse IDs the vendor may stock;
+	// empty allows any.
+	Warehouses []int `json:",omitempty"`
+
+	// MinSkus and MaxSkus bound how many SKUs a file lists;
+	// zero leaves that end open.
+	MinSkus int `json:",omitempty"`
+	MaxSkus int `json:",omitempty"`
+}
+
+// contractFields reports whether an item fills each field
+// a contract may require.
+var contractFields = map[string]func(Item) bool{
+	"LocationCode":   func(iv Item) bool { return iv.LocationCode != "" },
+	"WarehouseID":    func(iv Item) bool { return iv.WarehouseID > 0 },
+	"LotNumber":      func(iv Item) bool { return iv.LotNumber != "" },
+	"ExpirationDate": func(iv Item) bool { return iv.ExpirationDate != "" },
+}
+
+// contractExamples is how many offending items a
+// violation names.
+const contractExamples = 5
+
+// validateContracts rejects contracts requiring fields
+// that cannot be checked.
+func validateContracts() {
+	for vendor, vs := range settings {
+		if vs.Contract == nil {
+			continue
+		}
+		for _, field := range vs.Contract.Required {
+			if contractFields[field] == nil {
+				log.Fatalf("%s Contract requires unknown field %q", vendor, field)
+			}
+		}
+	}
+}
+
+// contracted reports whether any vendor in a file has
+// a contract.
+func contracted(vsd map[string]map[string]Item) bool {
+	for vendor := range vsd {
+		if settings[vendor].Contract != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// violations describes each way a file breaks its vendors'
+// contracts, naming a few of the offending items.
+func violations(vsd map[string]map[string]Item) []string {
+	var found []string
+	for _, vendor := range vendorOrder(vsd) {
+		c := settings[vendor].Contract
+		if c == nil {
+			continue
+		}
+		keys := make([]string, 0, len(vsd[vendor]))
+		for key := range vsd[vendor] {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keyLess(keys[i], keys[j]) })
+
+		for _, field := range c.Required {
+			var bad []string
+			for _, key := range keys {
+				if !contractFields[field](vsd[vendor][key]) {
+					bad = append(bad, key)
+				}
+			}
+			if len(bad) > 0 {
+				found = append(found, fmt.Sprintf("%s: %d items missing %s (%s)", vendor, len(bad), field, examples(bad)))
+			}
+		}
+
+		if len(c.Warehouses) > 0 {
+			allowed := map[int]bool{}
+			for _, id := range c.Warehouses {
+				allowed[id] = true
+			}
+			bad := map[int][]string{}
+			var ids []int
+			for _, key := range keys {
+				id := vsd[vendor][key].WarehouseID
+				if allowed[id] {
+					continue
+				}
+				if bad[id] == nil {
+					ids = append(ids, id)
+				}
+				bad[id] = append(bad[id], key)
+			}
+			sort.Ints(ids)
+			for _, id := range ids {
+				found = append(found, fmt.Sprintf("%s: %d items in warehouse %d, which is not allowed (%s)", vendor, len(bad[id]), id, examples(bad[id])))
+			}
+		}
+
+		skus := map[string]bool{}
+		for _, iv := range vsd[vendor] {
+			skus[iv.Sku] = true
+		}
+		if n := len(skus); c.MinSkus > 0 && n < c.MinSkus {
+			found = append(found, fmt.Sprintf("%s: %d SKUs, expected at least %d", vendor, n, c.MinSkus))
+		} else if c.MaxSkus > 0 && n > c.MaxSkus {
+			found = append(found, fmt.Sprintf("%s: %d SKUs, expected at most %d", vendor, n, c.MaxSkus))
+		}
+	}
+	return found
+}
+
+// examples names the first few of the given item keys.
+func examples(keys []string) string {
+	if len(keys) <= contractExamples {
+		return "items " + strings.Join(keys, ", ")
+	}
+	return fmt.Sprintf("items %s, and %d more", strings.Join(keys[:contractExamples], ", "), len(keys)-contractExamples)
+}
+
+// breachFile reports a file's contract violations, holding
+// it in HoldFolder when one is set and failing it otherwise.
+func breachFile(f drive.File, found []string) {
+	for _, v := range found {
+		say(fmt.Sprintf("Contract violation in %s: %s", f.Name, v))
+		summary.recordError(f.Name + ": " + v)
+	}
+	report := "contract violations: " + strings.Join(found, "; ")
+	if cfg.HoldFolder != "" {
+		holdFile(f, report)
+		return
+	}
+	failFile(f, errors.New(report))
+}
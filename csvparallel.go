@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+)
+
+// csvChunkMin is the smallest share of a CSV file worth
+// parsing on its own goroutine.
+const csvChunkMin = 4 << 20
+
+// csvRows parses a CSV file, splitting a large one into byte
+// ranges on line boundaries that are parsed in parallel and
+// joined back in file order.
+func csvRows(r io.Reader) ([][]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	n := len(b) / csvChunkMin
+	if cpus := runtime.NumCPU(); n > cpus {
+		n = cpus
+	}
+	if n < 2 {
+		return parseCSV(b, 0)
+	}
+
+	chunks := csvChunks(b, n)
+	rows := make([][][]string, len(chunks))
+	errs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	line := 0
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk []byte, line int) {
+			defer wg.Done()
+			rows[i], errs[i] = parseCSV(chunk, line)
+		}(i, chunk, line)
+		line += bytes.Count(chunk, []byte{'\n'})
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range chunks {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		total += len(rows[i])
+	}
+	all := make([][]string, 0, total)
+	for _, rs := range rows {
+		all = append(all, rs...)
+	}
+	return all, nil
+}
+
+// csvChunks splits CSV bytes into about n ranges, each
+// ending at a newline outside any quoted field.
+func csvChunks(b []byte, n int) [][]byte {
+	size := len(b) / n
+	var chunks [][]byte
+	start, quotes := 0, 0
+	for i, c := range b {
+		switch {
+		case c == '"':
+			quotes++
+		case c == '\n' && quotes%2 == 0 && i+1-start >= size && len(chunks) < n-1:
+			chunks = append(chunks, b[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(b) {
+		chunks = append(chunks, b[start:])
+	}
+	return chunks
+}
+
+// parseCSV parses one range of a CSV file whose first line
+// follows the given number of lines, so errors give the
+// line within the whole file.
+func parseCSV(b []byte, line int) ([][]string, error) {
+	cr := csv.NewReader(bytes.NewReader(b))
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if pe, ok := err.(*csv.ParseError); ok {
+		pe.StartLine += line
+		pe.Line += line
+	}
+	return rows, err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// daemonCmd keeps relaying the pending vendors folder,
+// one run per interval, until the process is stopped.
+//
+//	drive2sku daemon [-interval 1h] [-read-only]
+func daemonCmd(args []string) {
+	runDaemon(daemonFlags("daemon", args), nil)
+}
+
+// daemonFlags loads the config and parses the daemon's flags,
+// returning the interval between runs.
+func daemonFlags(name string, args []string) time.Duration {
+	readConfig()
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	interval := fs.Duration("interval", cfg.Interval.Duration, "time between runs")
+	fs.StringVar(&cfg.DebugAddr, "debug-addr", cfg.DebugAddr, "serve pprof and expvar here, e.g. localhost:6060")
+	fs.StringVar(&cfg.HealthAddr, "health-addr", cfg.HealthAddr, "serve GET /healthz here, e.g. :8081")
+	fs.BoolVar(readOnly, "read-only", *readOnly, "never post to SKUVault or change Drive; only list, download, validate, and report")
+	fs.Parse(args)
+	return *interval
+}
+
+// runDaemon connects once, then performs a full run every
+// interval. A close of stop ends it between runs; SIGINT or
+// SIGTERM ends it at once, cutting short the current run.
+func runDaemon(interval time.Duration, stop <-chan struct{}) {
+	initDriveAndVault()
+	readBufferSettings()
+	startSystemd()
+	handlePauseSignals()
+	handleShutdown()
+	startDebug()
+	startEvents()
+	startHealth()
+	defer sdNotify("STOPPING=1")
+
+	if l := newLeasor(); l != nil && !*readOnly {
+		defer startElection(l)()
+	}
+
+	beatT := time.NewTicker(5 * time.Second)
+	defer beatT.Stop()
+	freshT := time.NewTicker(15 * time.Minute)
+	defer freshT.Stop()
+	trigT := time.NewTicker(triggerPoll())
+	defer trigT.Stop()
+	for {
+		if isLeader() {
+			runStart := time.Now()
+			sdNotify("STATUS=Relaying vendor files")
+			syncDrive()
+			timeTrack(runStart)
+			if stopping() {
+				return
+			}
+			if !*readOnly {
+				janitor()
+			}
+		} else {
+			echo("Standing by; another replica is leader")
+		}
+
+		wait := interval
+		if !driveLostSince().IsZero() && accessRetry() > wait {
+			wait = accessRetry()
+		}
+		next := time.Now().Add(wait)
+		echo(fmt.Sprintf("Next run at %s", next.Format("15:04:05")))
+		sdNotify("STATUS=Idle until " + next.Format("15:04:05"))
+		nextT := time.NewTimer(wait)
+		for idle := true; idle; {
+			select {
+			case <-stop:
+				nextT.Stop()
+				return
+			case <-shutdownCtx.Done():
+				nextT.Stop()
+				return
+			case <-beatT.C:
+				heartbeat()
+			case <-freshT.C:
+				if isLeader() {
+					evaluateAlerts(timedMetrics(), true)
+				}
+			case <-trigT.C:
+				if isLeader() && runTriggered() {
+					nextT.Stop()
+					idle = false
+				}
+			case <-nextT.C:
+				idle = false
+			}
+		}
+	}
+}
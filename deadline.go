@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// runDeadline overrides the configured run deadline.
+var runDeadline = flag.Duration("deadline", 0, "stop starting new files after this long, e.g. 2h")
+
+// runContext ends at the current run's deadline or on
+// shutdown; downloads cut short by it leave their files
+// for the next run.
+var runContext context.Context = shutdownCtx
+
+// runLimit is how long a run may start new files for;
+// zero is no limit.
+func runLimit() time.Duration {
+	if *runDeadline > 0 {
+		return *runDeadline
+	}
+	return cfg.RunDeadline.Duration
+}
+
+// pastRunDeadline reports whether the current run has gone
+// on long enough that no new file should be started.
+func pastRunDeadline() bool {
+	d := runLimit()
+	return d > 0 && time.Since(summary.Start) > d
+}
+
+// startRunContext sets runContext for the run just started,
+// returning the func that ends it once the run is over.
+func startRunContext() func() {
+	var cancel context.CancelFunc
+	if d := runLimit(); d > 0 {
+		runContext, cancel = context.WithDeadline(shutdownCtx, summary.Start.Add(d))
+	} else {
+		runContext, cancel = context.WithCancel(shutdownCtx)
+	}
+	return func() {
+		cancel()
+		runContext = shutdownCtx
+	}
+}
+
+// spillOver leaves files untouched for the next run,
+// noting them in the run's summary.
+func spillOver(fls []*drive.File, why string) {
+	say(fmt.Sprintf("%s; leaving %d files for the next run", why, len(fls)))
+	summary.mu.Lock()
+	for _, f := range fls {
+		summary.Spillover = append(summary.Spillover, f.Name)
+	}
+	summary.mu.Unlock()
+}
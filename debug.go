@@ -0,0 +1,35 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+func init() {
+	expvar.Publish("run", expvar.Func(func() interface{} { return summary.snapshot() }))
+	expvar.Publish("paused", expvar.Func(func() interface{} { return isPaused() }))
+	expvar.Publish("leader", expvar.Func(func() interface{} { return isLeader() }))
+}
+
+// startDebug serves pprof profiles and expvar counters on
+// the configured address, meant to be a localhost port.
+func startDebug() {
+	if cfg.DebugAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	echo(fmt.Sprintf("Diagnostics on http://%s/debug/pprof/", cfg.DebugAddr))
+	go func() {
+		log.Printf("Diagnostics server stopped: %v", http.ListenAndServe(cfg.DebugAddr, mux))
+	}()
+}
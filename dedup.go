@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// DedupConfig skips files whose exact content was already
+// relayed within Window, by their Drive MD5 checksum. The
+// store is "memory" (one process), "file" (the state
+// directory, one node), or "redis" (shared by every node).
+// Merged runs are not deduplicated.
+type DedupConfig struct {
+	Backend string
+	Window  duration
+
+	// RedisAddr is host:port; keys are RedisPrefix plus the
+	// checksum, "drive2sku:dedup:" by default.
+	RedisAddr     string
+	RedisPassword string
+	RedisPrefix   string
+}
+
+// dedupStore remembers relayed content for a while.
+type dedupStore interface {
+	// claim records a key unless it is already recorded,
+	// reporting whether this caller recorded it.
+	claim(key string, ttl time.Duration) (bool, error)
+	release(key string) error
+}
+
+var (
+	dedup     dedupStore
+	dedupOnce sync.Once
+)
+
+// dedupBackend gives the configured dedup store, nil when
+// deduplication is off.
+func dedupBackend() dedupStore {
+	dedupOnce.Do(func() {
+		d := cfg.Dedup
+		switch d.Backend {
+		case "":
+		case "memory":
+			dedup = &memoryDedup{keys: map[string]time.Time{}}
+		case "file":
+			dedup = fileDedup{}
+		case "redis":
+			if d.RedisAddr == "" {
+				log.Fatalf("Dedup backend \"redis\" needs a RedisAddr")
+			}
+			if d.RedisPrefix == "" {
+				d.RedisPrefix = "drive2sku:dedup:"
+			}
+			dedup = redisDedup{d}
+		default:
+			log.Fatalf("Unknown dedup backend %q; use \"memory\", \"file\", or \"redis\"", d.Backend)
+		}
+	})
+	return dedup
+}
+
+// dedupWindow is how long relayed content is remembered.
+func dedupWindow() time.Duration {
+	if cfg.Dedup.Window.Duration > 0 {
+		return cfg.Dedup.Window.Duration
+	}
+	return 24 * time.Hour
+}
+
+// duplicateFile reports whether a file's content was relayed
+// within the window, otherwise recording it as relayed now.
+// A store that cannot be reached lets the file through.
+func duplicateFile(f drive.File) bool {
+	store := dedupBackend()
+	if store == nil || f.Md5Checksum == "" || *readOnly {
+		return false
+	}
+	ok, err := store.claim(f.Md5Checksum, dedupWindow())
+	if err != nil {
+		log.Printf("Unable to check %s for duplicates: %v", f.Name, err)
+		return false
+	}
+	if !ok {
+		say(fmt.Sprintf("Skipping %s; the same content was relayed within %v", f.Name, dedupWindow()))
+	}
+	return !ok
+}
+
+// forgetFile lets a file's content be relayed again, as
+// when it failed.
+func forgetFile(f drive.File) {
+	store := dedupBackend()
+	if store == nil || f.Md5Checksum == "" || *readOnly {
+		return
+	}
+	if err := store.release(f.Md5Checksum); err != nil {
+		log.Printf("Unable to forget %s for duplicates: %v", f.Name, err)
+	}
+}
+
+// memoryDedup keeps keys in the process, until they expire.
+type memoryDedup struct {
+	mu   sync.Mutex
+	keys map[string]time.Time
+}
+
+func (m *memoryDedup) claim(key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if exp, ok := m.keys[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	m.keys[key] = now.Add(ttl)
+	return true, nil
+}
+
+func (m *memoryDedup) release(key string) error {
+	m.mu.Lock()
+	delete(m.keys, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// dedupFile holds the file store's keys and their expiry.
+const dedupFile = "dedup.json"
+
+// fileDedupMu serializes the file store within the process.
+var fileDedupMu sync.Mutex
+
+// fileDedup keeps keys in the state directory, pruning
+// expired ones on every write.
+type fileDedup struct{}
+
+// update loads the keys, lets fn change them, and saves them.
+func (fileDedup) update(fn func(keys map[string]time.Time) bool) (bool, error) {
+	fileDedupMu.Lock()
+	defer fileDedupMu.Unlock()
+	keys := map[string]time.Time{}
+	if err := readJSON(statePath(dedupFile), &keys); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	now := time.Now()
+	for k, exp := range keys {
+		if !now.Before(exp) {
+			delete(keys, k)
+		}
+	}
+	ok := fn(keys)
+	return ok, writeJSON(statePath(dedupFile), keys)
+}
+
+func (d fileDedup) claim(key string, ttl time.Duration) (bool, error) {
+	return d.update(func(keys map[string]time.Time) bool {
+		if _, ok := keys[key]; ok {
+			return false
+		}
+		keys[key] = time.Now().Add(ttl)
+		return true
+	})
+}
+
+func (d fileDedup) release(key string) error {
+	_, err := d.update(func(keys map[string]time.Time) bool {
+		delete(keys, key)
+		return true
+	})
+	return err
+}
+
+// redisDedup keeps keys in Redis with SET NX and an expiry,
+// so every node shares one window.
+type redisDedup struct {
+	DedupConfig
+}
+
+func (r redisDedup) claim(key string, ttl time.Duration) (bool, error) {
+	reply, err := r.do("SET", r.RedisPrefix+key, "1", "NX", "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	return reply == "OK", err
+}
+
+func (r redisDedup) release(key string) error {
+	_, err := r.do("DEL", r.RedisPrefix+key)
+	return err
+}
+
+// do sends one command over a fresh connection, giving the
+// reply's simple, integer, or bulk value; nil is "".
+func (r redisDedup) do(args ...string) (string, error) {
+	conn, err := net.DialTimeout("tcp", r.RedisAddr, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	rd := bufio.NewReader(conn)
+
+	if r.RedisPassword != "" {
+		if _, err := redisCommand(conn, rd, "AUTH", r.RedisPassword); err != nil {
+			return "", err
+		}
+	}
+	return redisCommand(conn, rd, args...)
+}
+
+// redisCommand writes a command in RESP and reads its reply.
+func redisCommand(conn net.Conn, rd *bufio.Reader, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply from redis")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return "", err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+	return "", fmt.Errorf("unexpected reply from redis: %q", line)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// ItemDefaults fill in the fields a vendor's feed
+// leaves out.
+type ItemDefaults struct {
+	WarehouseID  int    `json:",omitempty"`
+	LocationCode string `json:",omitempty"`
+}
+
+// applyDefaults fills in each vendor's Defaults where its
+// items leave a field out, marking the items that relied
+// on one.
+func applyDefaults(vsd map[string]map[string]Item) {
+	for vendor, items := range vsd {
+		d := settings[vendor].Defaults
+		if d == nil {
+			continue
+		}
+		for key, iv := range items {
+			if iv.WarehouseID == 0 && d.WarehouseID != 0 {
+				iv.WarehouseID = d.WarehouseID
+				iv.defaulted = true
+			}
+			if iv.LocationCode == "" && d.LocationCode != "" {
+				iv.LocationCode = d.LocationCode
+				iv.defaulted = true
+			}
+			items[key] = iv
+		}
+	}
+}
+
+// locationData is what a LocationTemplate can refer to,
+// e.g. {{.Warehouse}}-OVERSTOCK.
+type locationData struct {
+	Vendor         string
+	Sku            string
+	Warehouse      int
+	Quantity       int
+	LotNumber      string
+	ExpirationDate string
+}
+
+// locationTemplates holds each vendor's parsed LocationTemplate.
+var locationTemplates map[string]*template.Template
+
+// parseLocationTemplates parses every vendor's
+// LocationTemplate, trying each once so mistakes
+// surface at startup rather than mid-run.
+func parseLocationTemplates() {
+	locationTemplates = map[string]*template.Template{}
+	for vendor, vs := range settings {
+		if vs.LocationTemplate == "" {
+			continue
+		}
+		t, err := template.New(vendor).Parse(vs.LocationTemplate)
+		if err == nil {
+			err = t.Execute(&bytes.Buffer{}, locationData{})
+		}
+		if err != nil {
+			log.Fatalf("Unable to parse %s LocationTemplate: %v", vendor, err)
+		}
+		locationTemplates[vendor] = t
+	}
+}
+
+// deriveLocations fills in the LocationCode of items that
+// came without one from their vendor's LocationTemplate.
+func deriveLocations(vsd map[string]map[string]Item) {
+	for vendor, items := range vsd {
+		t := locationTemplates[vendor]
+		if t == nil {
+			continue
+		}
+		for key, iv := range items {
+			if iv.LocationCode != "" {
+				continue
+			}
+			var b bytes.Buffer
+			err := t.Execute(&b, locationData{vendor, iv.Sku, iv.WarehouseID, iv.Quantity, iv.LotNumber, iv.ExpirationDate})
+			if err != nil {
+				log.Printf("Unable to derive %s LocationCode for %s: %v", vendor, iv.Sku, err)
+				continue
+			}
+			iv.LocationCode = strings.TrimSpace(b.String())
+			items[key] = iv
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// itemKey identifies one stock position across feeds,
+// independent of how a vendor keyed it inside the file.
+type itemKey struct {
+	Vendor       string
+	Sku          string
+	WarehouseID  int
+	LocationCode string
+	LotNumber    string
+}
+
+// keyOf gives the stock position a vendor's item updates.
+func keyOf(vendor string, iv Item) itemKey {
+	return itemKey{vendor, iv.Sku, iv.WarehouseID, iv.LocationCode, iv.LotNumber}
+}
+
+// String renders the key for console reports.
+func (k itemKey) String() string {
+	s := fmt.Sprintf("%s/%s wh=%d", k.Vendor, k.Sku, k.WarehouseID)
+	if k.LocationCode != "" {
+		s += " loc=" + k.LocationCode
+	}
+	if k.LotNumber != "" {
+		s += " lot=" + k.LotNumber
+	}
+	return s
+}
+
+// diffCmd reports SKUs added, removed, and quantity-changed
+// between an older and a newer vendor file.
+//
+//	drive2sku diff old.json new.json
+func diffCmd(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku diff <old-file> <new-file>")
+		os.Exit(2)
+	}
+
+	readConfig()
+	readBufferSettings()
+	old := loadPositions(fs.Arg(0))
+	cur := loadPositions(fs.Arg(1))
+
+	var added, removed, changed []itemKey
+	for k := range cur {
+		if _, ok := old[k]; !ok {
+			added = append(added, k)
+		} else if old[k] != cur[k] {
+			changed = append(changed, k)
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	echo(fmt.Sprintf("Added %d", len(added)))
+	for _, k := range sortKeys(added) {
+		fmt.Printf("  + %s qty=%d\n", k, cur[k])
+	}
+	echo(fmt.Sprintf("Removed %d", len(removed)))
+	for _, k := range sortKeys(removed) {
+		fmt.Printf("  - %s qty=%d\n", k, old[k])
+	}
+	echo(fmt.Sprintf("Changed %d", len(changed)))
+	for _, k := range sortKeys(changed) {
+		fmt.Printf("  ~ %s qty=%d -> %d (%+d)\n", k, old[k], cur[k], cur[k]-old[k])
+	}
+	echo(fmt.Sprintf("%d unchanged", len(cur)-len(added)-len(changed)))
+}
+
+// loadPositions reads a local vendor file into quantities by key.
+func loadPositions(path string) map[itemKey]int {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Unable to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	vsd, err := decodeFile(path, f)
+	if err != nil {
+		log.Fatalf("Unable to decode %s: %v", path, err)
+	}
+	return positions(vsd)
+}
+
+// positions flattens a decoded feed into quantities by key.
+func positions(vsd map[string]map[string]Item) map[itemKey]int {
+	qty := map[itemKey]int{}
+	for vendor, v := range vsd {
+		for _, iv := range v {
+			qty[keyOf(vendor, iv)] = iv.Quantity
+		}
+	}
+	return qty
+}
+
+// sortKeys orders keys for stable, readable reports.
+func sortKeys(ks []itemKey) []itemKey {
+	sort.Slice(ks, func(i, j int) bool {
+		return ks[i].String() < ks[j].String()
+	})
+	return ks
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// digestFile holds the alerts waiting for the next digest
+// and when the last one went out.
+const digestFile = "digest.json"
+
+// digestTop is how many failing SKUs a digest lists.
+const digestTop = 10
+
+// digestState is what digestFile holds.
+type digestState struct {
+	Last   time.Time
+	Alerts []string
+}
+
+// queueDigest holds an alert for the next digest.
+func queueDigest(msg string) {
+	var st digestState
+	readJSON(statePath(digestFile), &st)
+	if st.Last.IsZero() {
+		st.Last = time.Now()
+	}
+	st.Alerts = append(st.Alerts, time.Now().Format("Jan 2 15:04")+" "+msg)
+	if err := writeJSON(statePath(digestFile), st); err != nil {
+		log.Printf("Unable to save alert for the digest: %v", err)
+	}
+}
+
+// sendDigest sends the digest of everything since the last
+// one, once Digest has passed; the first call only starts
+// the clock.
+func sendDigest() {
+	if cfg.Digest.Duration <= 0 {
+		return
+	}
+	var st digestState
+	readJSON(statePath(digestFile), &st)
+	if !st.Last.IsZero() && time.Since(st.Last) < cfg.Digest.Duration {
+		return
+	}
+	if !st.Last.IsZero() {
+		notify("Drive2Sku digest", digestText(st))
+	}
+	if err := writeJSON(statePath(digestFile), digestState{Last: time.Now()}); err != nil {
+		log.Printf("Unable to save digest state: %v", err)
+	}
+}
+
+// skuPattern finds the SKU a recorded error is about.
+var skuPattern = regexp.MustCompile(`Sku "([^"]*)"`)
+
+// digestText sums up the runs, alerts, failing SKUs, and
+// silent vendors since the last digest.
+func digestText(st digestState) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Since %s:\n", st.Last.Format(time.RFC1123))
+
+	runs, err := loadRuns(st.Last)
+	if err != nil {
+		log.Printf("Unable to read run history for the digest: %v", err)
+	}
+	var withFiles, items, sent, payloads, failed int
+	failing := map[string]int{}
+	for _, r := range runs {
+		if len(r.Files) > 0 {
+			withFiles++
+		}
+		items += r.Items
+		sent += r.ItemsSent
+		payloads += r.Payloads
+		failed += r.Payloads - r.Succeeded
+		for _, e := range r.Errors {
+			if m := skuPattern.FindStringSubmatch(e); m != nil {
+				failing[m[1]]++
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d runs, %d with files; %d of %d items sent; %d of %d payloads failed\n",
+		len(runs), withFiles, sent, items, failed, payloads)
+
+	if len(st.Alerts) > 0 {
+		fmt.Fprintf(&b, "\nAlerts (%d):\n", len(st.Alerts))
+		for _, a := range st.Alerts {
+			fmt.Fprintf(&b, "  %s\n", a)
+		}
+	}
+
+	if len(failing) > 0 {
+		skus := make([]string, 0, len(failing))
+		for sku := range failing {
+			skus = append(skus, sku)
+		}
+		sort.Slice(skus, func(i, j int) bool {
+			if failing[skus[i]] != failing[skus[j]] {
+				return failing[skus[i]] > failing[skus[j]]
+			}
+			return skus[i] < skus[j]
+		})
+		if len(skus) > digestTop {
+			skus = skus[:digestTop]
+		}
+		b.WriteString("\nTop failing SKUs:\n")
+		for _, sku := range skus {
+			fmt.Fprintf(&b, "  %s (%d)\n", sku, failing[sku])
+		}
+	}
+
+	if last, _, err := lastArrivals(); err == nil {
+		var silent []string
+		for _, vendor := range vendorNames() {
+			if !settings[vendor].Disabled && last[vendor].Before(st.Last) {
+				silent = append(silent, vendor)
+			}
+		}
+		if len(silent) > 0 {
+			fmt.Fprintf(&b, "\nVendors with no feed: %s\n", strings.Join(silent, ", "))
+		}
+		if d := disabledVendors(); len(d) > 0 {
+			fmt.Fprintf(&b, "\nDisabled vendors: %s\n", strings.Join(d, ", "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2/google"
+)
+
+// minSpoolSpace is the free disk space the spool
+// should have before a run.
+const minSpoolSpace = 100 << 20
+
+// doctorCmd checks that a run can succeed: config, Drive
+// connectivity and folder access, the SKUVault tokens, and
+// spool disk space, printing each as pass or fail. It
+// exits non-zero if any check fails.
+//
+//	drive2sku doctor
+func doctorCmd(args []string) {
+	readConfig()
+
+	ok := true
+	check := func(name string, err error) bool {
+		if err != nil {
+			fmt.Printf("[FAIL] %s: %v\n", name, err)
+			ok = false
+			return false
+		}
+		fmt.Printf("[PASS] %s\n", name)
+		return true
+	}
+
+	problems := configProblems()
+	for _, p := range problems {
+		check("Config", fmt.Errorf("%s", p))
+	}
+	if len(problems) == 0 {
+		check("Config", nil)
+	}
+	check("Spool disk space", spoolSpace())
+
+	if check("Client secret", clientSecret()) {
+		initDriveAndVault()
+		_, err := drv.Files.List().PageSize(1).Fields("files(id)").Do()
+		if check("Drive connection", explainDrive(err)) {
+			for _, f := range doctorFolders() {
+				_, err := driveFor(f.id).Files.Get(f.id).Fields("id,name").Do()
+				check(f.name+" folder", explainDrive(err))
+			}
+		}
+		check("SKUVault tokens", vaultTokens())
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// folderRef names a configured Drive folder.
+type folderRef struct {
+	name, id string
+}
+
+// doctorFolders lists every Drive folder the config uses.
+func doctorFolders() []folderRef {
+	fs := []folderRef{{"Pending", pendingFolder}}
+	for _, f := range []folderRef{
+		{"Processed", cfg.ProcessedFolder},
+		{"Failed", cfg.FailedFolder},
+		{"Hold", cfg.HoldFolder},
+		{"Approved", cfg.ApprovedFolder},
+		{"Quarantine", cfg.QuarantineFolder},
+		{"Price", cfg.PriceFolder},
+		{"Control", cfg.ControlFolder},
+	} {
+		if f.id != "" {
+			fs = append(fs, f)
+		}
+	}
+	if cfg.Leader == "drive" && cfg.LockFolder != pendingFolder {
+		fs = append(fs, folderRef{"Lock", cfg.LockFolder})
+	}
+	for _, a := range cfg.Accounts {
+		for _, id := range a.Folders {
+			fs = append(fs, folderRef{a.Name + " account", id})
+		}
+	}
+	return fs
+}
+
+// clientSecret checks the Drive client secret can be read.
+func clientSecret() error {
+	b, err := readSecret("client_secret.json")
+	if err != nil {
+		return err
+	}
+	_, err = google.ConfigFromJSON(b, driveScope())
+	return err
+}
+
+// vaultTokens makes a harmless SKUVault call
+// to check the cached tokens are accepted.
+func vaultTokens() error {
+	_, err := vault.GetWarehouses(runContext, 0)
+	return err
+}
+
+// spoolSpace checks the spool's disk has room.
+func spoolSpace() error {
+	free, err := diskFree(cfg.StateDir)
+	if err != nil {
+		return err
+	}
+	if free >= 0 && free < minSpoolSpace {
+		return fmt.Errorf("only %d MB free in %s", free>>20, cfg.StateDir)
+	}
+	return nil
+}
+
+// configProblems lists settings that would break a run.
+func configProblems() []string {
+	var ps []string
+	if cfg.Interval.Duration <= 0 {
+		ps = append(ps, "Interval must be positive")
+	}
+	if cfg.MaxDownloads < 1 || cfg.MaxParsers < 1 || cfg.MaxPosts < 1 {
+		ps = append(ps, "MaxDownloads, MaxParsers, and MaxPosts must be at least 1")
+	}
+	if cfg.Shards < 0 {
+		ps = append(ps, "Shards cannot be negative")
+	}
+	switch cfg.Leader {
+	case "", "kubernetes", "drive":
+	default:
+		ps = append(ps, fmt.Sprintf("unknown Leader %q", cfg.Leader))
+	}
+	switch cfg.DriveScope {
+	case "drive", "drive.file":
+	default:
+		ps = append(ps, fmt.Sprintf("unknown DriveScope %q", cfg.DriveScope))
+	}
+	switch cfg.Secrets.Backend {
+	case "", "file":
+	case "vault":
+		if cfg.Secrets.VaultAddr == "" && os.Getenv("VAULT_ADDR") == "" {
+			ps = append(ps, "Secrets uses vault but no VaultAddr or $VAULT_ADDR is set")
+		}
+	case "gcp":
+		if cfg.Secrets.GCPProject == "" {
+			ps = append(ps, "Secrets uses gcp but no GCPProject is set")
+		}
+	default:
+		ps = append(ps, fmt.Sprintf("unknown Secrets backend %q", cfg.Secrets.Backend))
+	}
+	if cfg.RejectPercent < 0 || cfg.RejectPercent > 100 {
+		ps = append(ps, "RejectPercent must be between 0 and 100")
+	}
+	if cfg.RejectPercent > 0 && cfg.SMTP.Addr == "" {
+		ps = append(ps, "RejectPercent is set but SMTP has no Addr to email vendors")
+	}
+	if len(cfg.AlertEmail) > 0 && cfg.SMTP.Addr == "" {
+		ps = append(ps, "AlertEmail is set but SMTP has no Addr")
+	}
+	if (len(cfg.Alerts) > 0 || cfg.Digest.Duration > 0 || cfg.LatencySLO.Duration > 0) && len(cfg.AlertEmail) == 0 && cfg.AlertWebhook == "" {
+		ps = append(ps, "Alerts have neither AlertEmail nor AlertWebhook to go to")
+	}
+	for _, a := range cfg.Accounts {
+		if a.Name == "" || a.ClientSecret == "" || a.TokenFile == "" {
+			ps = append(ps, "every account needs a Name, ClientSecret, and TokenFile")
+			break
+		}
+	}
+	return ps
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// driveAccess tracks whether the Drive folders have become
+// unreachable, so the daemon can wait it out instead of
+// crash-looping.
+var driveAccess struct {
+	sync.Mutex
+	lost time.Time
+}
+
+// accessReasons are the Drive error reasons that mean the
+// folder is gone or no longer shared, as opposed to a rate
+// limit or a passing outage.
+var accessReasons = map[string]bool{
+	"forbidden":                   true,
+	"insufficientPermissions":     true,
+	"insufficientFilePermissions": true,
+	"appNotAuthorizedToFile":      true,
+	"notFound":                    true,
+	"cannotAddParent":             true,
+	"teamDriveMembershipRequired": true,
+}
+
+// accessLost reports whether a Drive error means what was
+// asked for became inaccessible: revoked, moved, or deleted.
+// Only listing the pending folder treats it as losing the
+// folder; for one file it fails that file alone.
+func accessLost(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok || (gerr.Code != 403 && gerr.Code != 404) {
+		return false
+	}
+	if len(gerr.Errors) == 0 {
+		return true
+	}
+	for _, e := range gerr.Errors {
+		if accessReasons[e.Reason] {
+			return true
+		}
+	}
+	return false
+}
+
+// fileLost reports a file that was deleted or unshared
+// after it was listed.
+func fileLost(f drive.File, what string, err error) {
+	msg := fmt.Sprintf("Unable to %s %s; it is no longer accessible: %v", what, f.Name, explainDrive(err))
+	say(msg)
+	summary.recordError(msg)
+}
+
+// driveLost notes that Drive access is gone, alerting once
+// with what to check, right away even when digesting.
+func driveLost(err error) {
+	driveAccess.Lock()
+	first := driveAccess.lost.IsZero()
+	if first {
+		driveAccess.lost = time.Now()
+	}
+	driveAccess.Unlock()
+
+	if !first {
+		echo(fmt.Sprintf("Drive still inaccessible: %v", err))
+		return
+	}
+	msg := fmt.Sprintf("Drive folder %s is no longer accessible: %v\n"+
+		"Check that the folder still exists and is not in the trash, that it was not moved "+
+		"out of a shared drive, and that it is still shared with the authorized account as an editor. "+
+		"Files are left pending; runs will retry every %v until access returns.",
+		pendingFolder, explainDrive(err), accessRetry())
+	say("Alert: " + msg)
+	notify("Drive2Sku: Drive access lost", msg)
+}
+
+// driveRestored clears a loss of Drive access, if there was one.
+func driveRestored() {
+	driveAccess.Lock()
+	since := driveAccess.lost
+	driveAccess.lost = time.Time{}
+	driveAccess.Unlock()
+	if since.IsZero() {
+		return
+	}
+	msg := fmt.Sprintf("Drive access restored after %v", time.Since(since).Round(time.Minute))
+	say(msg)
+	notify("Drive2Sku: Drive access restored", msg)
+}
+
+// driveLostSince gives when Drive access was lost, zero
+// while it is fine.
+func driveLostSince() time.Time {
+	driveAccess.Lock()
+	defer driveAccess.Unlock()
+	return driveAccess.lost
+}
+
+// accessRetry is how long the daemon waits between runs
+// while Drive is inaccessible.
+func accessRetry() time.Duration {
+	if cfg.AccessRetry.Duration > 0 {
+		return cfg.AccessRetry.Duration
+	}
+	return 30 * time.Minute
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// DropGroup makes a vendor's files that only make sense
+// together, such as per-warehouse splits, one drop: it is
+// posted once complete, all files or none, and archived or
+// failed as a set.
+type DropGroup struct {
+	// Key is a regular expression on file names whose first
+	// group names the drop, e.g. "^acme_(\\d{8})_".
+	Key string
+
+	// Files is how many files make up a drop. A drop with a
+	// Manifest is instead complete once every file named in
+	// its manifest is pending; Manifest is a glob on the
+	// manifest's name, e.g. "acme_*_manifest.csv".
+	Files    int    `json:",omitempty"`
+	Manifest string `json:",omitempty"`
+
+	// Wait is how long after its manifest lands a drop still
+	// missing files is waited on before being held, an hour
+	// by default.
+	Wait *duration `json:",omitempty"`
+}
+
+// manifestEntry is one line of a drop's manifest, given as
+// name[,rows[,md5]]: the file's name, and optionally how many
+// items it holds and its MD5 checksum in hex. A header line
+// is skipped. Files not matching their entry hold the drop.
+type manifestEntry struct {
+	Name string
+	Rows int
+	MD5  string
+}
+
+// dropKeys holds each vendor's compiled DropGroup Key.
+var dropKeys map[string]*regexp.Regexp
+
+// validateDrops compiles each vendor's drop key, rejecting
+// groups that cannot tell when a drop is complete.
+func validateDrops() {
+	dropKeys = map[string]*regexp.Regexp{}
+	for vendor, vs := range settings {
+		d := vs.Drop
+		if d == nil {
+			continue
+		}
+		re, err := regexp.Compile(d.Key)
+		if err != nil {
+			log.Fatalf("%s Drop Key: %v", vendor, err)
+		}
+		if re.NumSubexp() < 1 {
+			log.Fatalf("%s Drop Key needs a group naming the drop", vendor)
+		}
+		if d.Files <= 0 && d.Manifest == "" {
+			log.Fatalf("%s Drop needs a number of Files or a Manifest", vendor)
+		}
+		dropKeys[vendor] = re
+	}
+}
+
+// drop is one vendor drop found pending.
+type drop struct {
+	vendor   string
+	key      string
+	files    []*drive.File
+	manifest *drive.File
+
+	// entries caches the manifest once read.
+	entries []manifestEntry
+}
+
+// String names the drop for the console.
+func (d *drop) String() string {
+	return d.vendor + " drop " + d.key
+}
+
+// dropOf finds the vendor drop a file belongs to, and
+// whether it is the drop's manifest.
+func dropOf(name string) (vendor, key string, manifest, ok bool) {
+	base := filepath.Base(name)
+	for vendor, re := range dropKeys {
+		m := re.FindStringSubmatch(base)
+		if m == nil {
+			continue
+		}
+		d := settings[vendor].Drop
+		if d.Manifest != "" {
+			manifest, _ = filepath.Match(d.Manifest, base)
+		}
+		return vendor, m[1], manifest, true
+	}
+	return "", "", false, false
+}
+
+// processDrops posts each complete drop among the pending
+// files, leaving incomplete ones pending, and gives the
+// files that belong to no drop.
+func processDrops(fls []*drive.File) []*drive.File {
+	if len(dropKeys) == 0 {
+		return fls
+	}
+	drops := map[string]*drop{}
+	var rest []*drive.File
+	for _, f := range fls {
+		vendor, key, manifest, ok := dropOf(f.Name)
+		if !ok {
+			rest = append(rest, f)
+			continue
+		}
+		id := vendor + "\x00" + key
+		if drops[id] == nil {
+			drops[id] = &drop{vendor: vendor, key: key}
+		}
+		if manifest {
+			drops[id].manifest = f
+		} else {
+			drops[id].files = append(drops[id].files, f)
+		}
+	}
+
+	ids := make([]string, 0, len(drops))
+	for id := range drops {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		d := drops[id]
+		if d.missing() != "" {
+			// watch runs see only the files that changed
+			d.fill()
+		}
+		if stopping() || pastRunDeadline() {
+			say(fmt.Sprintf("Leaving %s pending; the run is ending", d))
+			continue
+		}
+		if why := d.missing(); why != "" {
+			if d.manifest != nil && time.Since(modifiedTime(*d.manifest)) > d.wait() {
+				holdDrop(d, why)
+				continue
+			}
+			say(fmt.Sprintf("Waiting on %s: %s", d, why))
+			continue
+		}
+		sendDrop(d)
+	}
+	return rest
+}
+
+// missing describes what the drop still lacks, or is
+// empty once it is complete.
+func (d *drop) missing() string {
+	g := settings[d.vendor].Drop
+	if g.Manifest == "" {
+		if len(d.files) < g.Files {
+			return fmt.Sprintf("%d of %d files", len(d.files), g.Files)
+		}
+		return ""
+	}
+	if d.manifest == nil {
+		return "no manifest yet"
+	}
+	entries, err := d.listed()
+	if err != nil {
+		return fmt.Sprintf("unable to read manifest %s: %v", d.manifest.Name, err)
+	}
+	have := map[string]bool{}
+	for _, f := range d.files {
+		have[f.Name] = true
+	}
+	var absent []string
+	for _, e := range entries {
+		if !have[e.Name] {
+			absent = append(absent, e.Name)
+		}
+	}
+	if len(absent) > 0 {
+		return "missing " + strings.Join(absent, ", ")
+	}
+	return ""
+}
+
+// fill adds the drop's other files still pending in Drive.
+func (d *drop) fill() {
+	fls, err := listPending(drv, pendingQuery())
+	if err != nil {
+		log.Printf("Unable to list the rest of %s: %v", d, explainDrive(err))
+		return
+	}
+	have := map[string]bool{}
+	for _, f := range d.files {
+		have[f.Id] = true
+	}
+	for _, f := range fls {
+		vendor, key, manifest, ok := dropOf(f.Name)
+		if !ok || vendor != d.vendor || key != d.key || have[f.Id] {
+			continue
+		}
+		if manifest {
+			if d.manifest == nil {
+				d.manifest = f
+			}
+			continue
+		}
+		d.files = append(d.files, f)
+	}
+}
+
+// listed reads the drop's manifest.
+func (d *drop) listed() ([]manifestEntry, error) {
+	if d.entries != nil {
+		return d.entries, nil
+	}
+	b, err := downloadFile(runContext, *d.manifest)
+	if err != nil {
+		return nil, explainDrive(err)
+	}
+	cr := csv.NewReader(bytes.NewReader(b))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	d.entries = []manifestEntry{}
+	for i, row := range rows {
+		e := manifestEntry{Name: strings.TrimSpace(row[0]), Rows: -1}
+		if e.Name == "" {
+			continue
+		}
+		if len(row) > 1 && strings.TrimSpace(row[1]) != "" {
+			n, err := strconv.Atoi(strings.TrimSpace(row[1]))
+			if err != nil && i == 0 {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: rows: %v", i+1, err)
+			}
+			e.Rows = n
+		}
+		if len(row) > 2 {
+			e.MD5 = strings.ToLower(strings.TrimSpace(row[2]))
+		}
+		d.entries = append(d.entries, e)
+	}
+	return d.entries, nil
+}
+
+// wait is how long the drop's missing files are waited on.
+func (d *drop) wait() time.Duration {
+	if w := settings[d.vendor].Drop.Wait; w != nil {
+		return w.Duration
+	}
+	return time.Hour
+}
+
+// verify checks the drop's files against the checksums and
+// item counts in its manifest, describing any mismatch.
+func (d *drop) verify(files []*drive.File, fetches []fetched) string {
+	if d.manifest == nil || approved(*d.manifest) {
+		return ""
+	}
+	entries, err := d.listed()
+	if err != nil {
+		return fmt.Sprintf("unable to read manifest %s: %v", d.manifest.Name, err)
+	}
+	byName := map[string]manifestEntry{}
+	for _, e := range entries {
+		byName[e.Name] = e
+	}
+	var bad []string
+	for i, f := range files {
+		e, ok := byName[f.Name]
+		if !ok {
+			bad = append(bad, f.Name+" is not in the manifest")
+			continue
+		}
+		if e.MD5 != "" && f.Md5Checksum != "" && e.MD5 != f.Md5Checksum {
+			bad = append(bad, fmt.Sprintf("%s checksum is %s, manifest says %s", f.Name, f.Md5Checksum, e.MD5))
+		}
+		if n := feedItems(fetches[i].vsd); e.Rows >= 0 && fetches[i].err == nil && n != e.Rows {
+			bad = append(bad, fmt.Sprintf("%s has %d items, manifest says %d", f.Name, n, e.Rows))
+		}
+	}
+	return strings.Join(bad, "; ")
+}
+
+// holdDrop sets every file of a drop aside, its manifest
+// included: held in HoldFolder when one is set, failed
+// otherwise.
+func holdDrop(d *drop, why string) {
+	say(fmt.Sprintf("Holding %s: %s", d, why))
+	summary.recordError(d.String() + ": " + why)
+	fs := d.files
+	if d.manifest != nil {
+		fs = append(fs[:len(fs):len(fs)], d.manifest)
+	}
+	for _, f := range fs {
+		if cfg.HoldFolder != "" {
+			holdFile(*f, why)
+		} else {
+			failFile(*f, errors.New(why))
+		}
+	}
+}
+
+// sendDrop posts a complete drop as one batch once every
+// file decodes and passes screening; otherwise the whole
+// drop is left pending, less any file failed or held.
+func sendDrop(d *drop) {
+	echo(fmt.Sprintf("Processing %s (%d files)", d, len(d.files)))
+	byModified(d.files)
+	files, fetches := claimFiles(d.files, fetchFeeds(d.files))
+	if len(files) < len(d.files) {
+		say(fmt.Sprintf("Leaving %s to the instance holding part of it", d))
+		leaveDrop(d.files, nil)
+		return
+	}
+
+	for _, fe := range fetches {
+		if fe.interrupted {
+			leaveDrop(files, nil)
+			return
+		}
+	}
+	if why := d.verify(files, fetches); why != "" {
+		leaveDrop(files, nil)
+		holdDrop(d, why)
+		return
+	}
+
+	merged := map[string]map[string]Item{}
+	var deadline time.Time
+	for i, f := range files {
+		setRunFile(f.Name)
+		fe := fetches[i]
+		if fe.err != nil {
+			failFile(*f, fe.err)
+			say(fmt.Sprintf("Leaving the rest of %s pending; %s failed", d, f.Name))
+			leaveDrop(files, f)
+			return
+		}
+		if rejectFile(*f, fe.vsd) || !screenFile(*f, fe.vsd) {
+			say(fmt.Sprintf("Leaving the rest of %s pending; %s was held back", d, f.Name))
+			leaveDrop(files, f)
+			return
+		}
+		if deadline.IsZero() || fe.deadline.Before(deadline) {
+			deadline = fe.deadline
+		}
+		for vendor, v := range fe.vsd {
+			if merged[vendor] == nil {
+				merged[vendor] = map[string]Item{}
+			}
+			for _, iv := range v {
+				merged[vendor][keyOf(vendor, iv).String()] = iv
+			}
+		}
+	}
+	if !confirmPost(d.String(), feedItems(merged)) {
+		say(fmt.Sprintf("Leaving %s pending", d))
+		leaveDrop(files, nil)
+		return
+	}
+
+	fs := make([]drive.File, 0, len(files)+1)
+	for _, f := range files {
+		fs = append(fs, *f)
+	}
+	if d.manifest != nil {
+		fs = append(fs, *d.manifest)
+	}
+	summary.expect(len(fs), feedItems(merged))
+	sendPayloads(merged, deadline, fs...)
+}
+
+// leaveDrop unstages a drop's files, but the one already
+// failed or held, so they stay pending.
+func leaveDrop(files []*drive.File, but *drive.File) {
+	for _, f := range files {
+		if f != but {
+			unstage(*f)
+		}
+	}
+}
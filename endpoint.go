@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// singleItem is the body of a one-item quantity post.
+type singleItem struct {
+	Item
+	TenantToken string
+	UserToken   string
+}
+
+// singleItems reports whether a payload posts item by item:
+// when its vendor asks for it, or when it holds no more than
+// SingleItemMax items. Lot items always post in bulk.
+func singleItems(pl Payload) bool {
+	if len(pl.Items) == 0 || pl.Items[0].LotNumber != "" {
+		return false
+	}
+	switch settings[pl.vendor].Endpoint {
+	case "single":
+		return true
+	case "bulk":
+		return false
+	}
+	return len(pl.Items) <= cfg.SingleItemMax
+}
+
+// postPayload sends a payload to its endpoint and decodes
+// the answer, also giving how many of its items SKUVault
+// answered for. Single-item posts are gathered into the
+// worst response and every item's errors, stopping at the
+// first one worth retrying.
+func postPayload(pl Payload) (*http.Response, ResponseBody, int, error) {
+	ctx := pl.context()
+	var body ResponseBody
+	if !singleItems(pl) {
+		var res *http.Response
+		var err error
+		if len(pl.Items) > 0 && pl.Items[0].LotNumber != "" {
+			res, body, err = vault.SetLotItemQuantities(ctx, pl.Items)
+		} else {
+			res, body, err = vault.SetItemQuantities(ctx, pl.Items)
+		}
+		if err != nil || transient(res, body, nil) {
+			return res, body, 0, err
+		}
+		return res, body, len(pl.Items), nil
+	}
+
+	var worst *http.Response
+	for i, iv := range pl.Items {
+		res, one, err := vault.SetItemQuantity(ctx, iv)
+		if err != nil {
+			return res, body, i, err
+		}
+		if transient(res, one, nil) {
+			body.Status = one.Status
+			return res, body, i, nil
+		}
+
+		for _, e := range one.Errors {
+			if e.Sku == "" {
+				e.Sku, e.WarehouseID, e.LocationCode = iv.Sku, iv.WarehouseID, iv.LocationCode
+			}
+			body.Errors = append(body.Errors, e)
+		}
+		if worst == nil || res.StatusCode > worst.StatusCode {
+			worst = res
+			body.Status = one.Status
+		}
+	}
+	return worst, body, len(pl.Items), nil
+}
+
+// settlePart records the first n items of a payload, which
+// SKUVault answered for before a post worth retrying, with
+// their errors, and gives the payload of items left to retry.
+func settlePart(pl Payload, n int, d time.Duration, errs []ErrorBody) Payload {
+	head := pl
+	head.Items = pl.Items[:n:n]
+	summary.recordPost(d, n, true)
+	summary.recordSent(head, errs)
+	reportRejects(head, http.StatusOK, errs)
+	pl.Items = pl.Items[n:]
+	return pl
+}
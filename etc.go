@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -17,8 +23,13 @@ import (
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 )
 
+// deviceAuth picks the device code grant for this run's
+// Drive authorization, overriding AuthFlow.
+var deviceAuth = flag.Bool("device-auth", false, "authorize Drive with a code entered on another device")
+
 // getClientAndSkuTokens uses a Context and Config to retrieve a Token
 // then generate a Client. It returns the generated Client.
 func getClientAndSkuTokens(ctx context.Context, config *oauth2.Config) (*drive.Service, *SkuTokens) {
@@ -29,14 +40,23 @@ func getClientAndSkuTokens(ctx context.Context, config *oauth2.Config) (*drive.S
 
 	// drive token
 	tok, err := oTokenFromFile(cacheDriveFile)
+	if isCorrupt(err) {
+		log.Fatalf("Unable to use cached Drive token: %v", err)
+	}
 	if err != nil {
-		tok = getOTokenFromWeb(config)
+		tok = authorize(config)
 		saveOToken(cacheDriveFile, tok)
 	}
 
-	// skuvault token
+	// skuvault token; the mock vault needs none, and must
+	// never overwrite the real cache with its own
 	toks, err := tokensFromFile(cacheSkuFile)
-	if err != nil {
+	if isCorrupt(err) && !*mockVault {
+		log.Printf("Fetching new SKUVault tokens; %v", err)
+	}
+	if *mockVault {
+		toks = mockTokens
+	} else if err != nil {
 		toks = getTokensFromWeb()
 		saveTokens(cacheSkuFile, toks)
 	}
@@ -68,6 +88,35 @@ func getOTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 	return tok
 }
 
+// getOTokenFromDevice uses the device authorization grant,
+// for servers without a browser: the operator enters a code
+// on any other device while this polls for the Token.
+func getOTokenFromDevice(config *oauth2.Config) *oauth2.Token {
+	if config.Endpoint.DeviceAuthURL == "" {
+		config.Endpoint.DeviceAuthURL = google.Endpoint.DeviceAuthURL
+	}
+	ctx := context.Background()
+	da, err := config.DeviceAuth(ctx, oauth2.AccessTypeOffline)
+	if err != nil {
+		log.Fatalf("Unable to start device authorization: %v", err)
+	}
+	fmt.Printf("On any device, go to %v and enter the code %v\n", da.VerificationURI, da.UserCode)
+
+	tok, err := config.DeviceAccessToken(ctx, da)
+	if err != nil {
+		log.Fatalf("Unable to retrieve token from device authorization: %v", err)
+	}
+	return tok
+}
+
+// authorize obtains a new Token with the configured flow.
+func authorize(config *oauth2.Config) *oauth2.Token {
+	if *deviceAuth || cfg.AuthFlow == "device" {
+		return getOTokenFromDevice(config)
+	}
+	return getOTokenFromWeb(config)
+}
+
 // tokenCacheFiles generates credential file path/filename.
 // It returns the generated credential path/filename.
 func tokenCacheFiles() (string, string, error) {
@@ -86,57 +135,82 @@ func tokenCacheFiles() (string, string, error) {
 // oTokenFromFile retrieves a Token from a given file path.
 // It returns the retrieved Token and any read error encountered.
 func oTokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+	b, err := readSecret(file)
 	if err != nil {
 		return nil, err
 	}
 	t := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(t)
-	defer f.Close()
-	return t, err
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, corruptCache{file, err}
+	}
+	if t.AccessToken == "" && t.RefreshToken == "" {
+		return nil, corruptCache{file, errors.New("no token in it")}
+	}
+	return t, nil
 }
 
 // SkuTokens holds
 type SkuTokens struct {
 	TenantToken string
 	UserToken   string
+
+	// Fetched is when the tokens were issued,
+	// zero for caches older than rotation.
+	Fetched time.Time
 }
 
 // tokensFromFile retrieves a Token from a given file path.
 // It returns the retrieved Token and any read error encountered.
 func tokensFromFile(file string) (*SkuTokens, error) {
-	f, err := os.Open(file)
+	b, err := readSecret(file)
 	if err != nil {
 		return nil, err
 	}
 	t := &SkuTokens{}
-	err = json.NewDecoder(f).Decode(t)
-	defer f.Close()
-	return t, err
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, corruptCache{file, err}
+	}
+	if t.TenantToken == "" || t.UserToken == "" {
+		return nil, corruptCache{file, errors.New("no tokens in it")}
+	}
+	return t, nil
+}
+
+// corruptCache is a token cache that exists but cannot be
+// used, left by an old crash mid-write or a hand edit.
+type corruptCache struct {
+	file string
+	err  error
+}
+
+func (c corruptCache) Error() string {
+	return fmt.Sprintf("%s is corrupt (%v); delete it and run drive2sku again to re-authorize", c.file, c.err)
+}
+
+// isCorrupt reports whether an error is a corrupt cache.
+func isCorrupt(err error) bool {
+	_, ok := err.(corruptCache)
+	return ok
 }
 
 // saveOToken uses a file path to create a file and store the
 // token in it.
 func saveOToken(file string, token *oauth2.Token) {
 	fmt.Printf("Saving Drive credential file to: %s\n", file)
-	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
+	b, _ := json.Marshal(token)
+	if err := writeSecret(file, b); err != nil {
 		log.Fatalf("Unable to cache oauth token: %v", err)
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
 }
 
 // saveTokens uses a file path to create a file and store the
 // token in it.
 func saveTokens(file string, toks *SkuTokens) {
 	fmt.Printf("Saving SkuVault credential file to: %s\n", file)
-	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
+	b, _ := json.Marshal(toks)
+	if err := writeSecret(file, b); err != nil {
 		log.Fatalf("Unable to cache sku tokens: %v", err)
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(toks)
 }
 
 // readJSON, using a file name and a structure,
@@ -150,54 +224,183 @@ func readJSON(name string, v interface{}) error {
 	return json.NewDecoder(f).Decode(v)
 }
 
-// struct2JSON converts a data structure
-// in type format into a JSON-reader
-func struct2JSON(v interface{}) *strings.Reader {
-	// convert interface to JSON bytes
+// writeJSON, using a file name and a structure,
+// saves it as an indented JSON file.
+func writeJSON(name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, b, 0600)
+}
+
+// writeFileAtomic writes a file through a temporary file
+// in the same directory renamed over it, so a crash leaves
+// either the old contents or the new, never a torn file.
+func writeFileAtomic(name string, b []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// struct2JSON converts a data structure in type format
+// into JSON bytes, which a request can read again for
+// every attempt where a one-shot reader could not.
+func struct2JSON(v interface{}) []byte {
 	b, err := json.Marshal(v)
 	if err != nil {
-		log.Fatalf("Unable to convert interface to reader: %v", err)
+		log.Fatalf("Unable to convert interface to JSON: %v", err)
 	}
+	return b
+}
 
-	// return reader of stringified JSON bytes
-	return strings.NewReader(string(b))
+// replayable gives a request a body that is rewound for
+// every attempt: GetBody hands the client a fresh reader
+// over the same bytes when it redirects or resends, so
+// no retry goes out with a drained, empty body.
+func replayable(req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+}
+
+// vaultURL builds the full address of a SKUVault
+// API function from the configured endpoint.
+func vaultURL(fn string) string {
+	u := strings.TrimRight(cfg.VaultURL, "/") + "/"
+	for _, seg := range []string{cfg.VaultPath, cfg.VaultVersion} {
+		if seg = strings.Trim(seg, "/"); seg != "" {
+			u += seg + "/"
+		}
+	}
+	return u + fn
+}
+
+// userAgent identifies Drive2Sku to SKUVault.
+const userAgent = "Drive2Sku/1.0 (+https://github.com/WedgeNix/Drive2Sku)"
+
+// correlationHeaders are the response headers SKUVault
+// support may ask for when tracing a call.
+var correlationHeaders = []string{"X-Request-Id", "X-Correlation-Id", "Request-Id", "X-Amzn-Trace-Id"}
+
+// requestID makes an ID for one SKUVault call, prefixed
+// with the run so calls can be grouped by run.
+func requestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	runCtx.Lock()
+	run := runCtx.run
+	runCtx.Unlock()
+	if run == "" {
+		return hex.EncodeToString(b)
+	}
+	return run + "-" + hex.EncodeToString(b)
 }
 
 // vaultRequest asks SKUVault of the passed in function,
-// supplying a reader on a JSON string
-func vaultRequest(fn string, jsn *strings.Reader) (*http.Response, error) {
+// supplying the JSON request body; use vault's methods
+// rather than calling it directly.
+func vaultRequest(ctx context.Context, fn string, b []byte) (*http.Response, error) {
+	if !gzipOn() {
+		return postVault(ctx, fn, b, false)
+	}
+
+	res, err := postVault(ctx, fn, gzipBody(b), true)
+	if err != nil || !gzipRefused(res) {
+		return res, err
+	}
+	res.Body.Close()
+	rejectGzip()
+	return postVault(ctx, fn, b, false)
+}
+
+// gzipRefused reports whether a response turns down
+// a gzipped body rather than its contents.
+func gzipRefused(res *http.Response) bool {
+	return res.StatusCode == http.StatusUnsupportedMediaType ||
+		res.StatusCode == http.StatusNotImplemented
+}
+
+// postVault sends one POST to a SKUVault function. Each
+// call builds a new request over the body's bytes, so the
+// attempts vaultClient.call makes each send it whole.
+func postVault(ctx context.Context, fn string, body []byte, gzipped bool) (*http.Response, error) {
 	// get official POST request from SKUVault
-	req, err := http.NewRequest("POST", "https://app.skuvault.com/api/"+fn, jsn)
+	req, err := http.NewRequest("POST", vaultURL(fn), nil)
 	if err != nil {
 		log.Fatalf("Unable to obtain SKUVault request: %v", err)
 	}
+	replayable(req, body)
+	req = req.WithContext(ctx)
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("content-type", "application/json")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Request-Id", requestID())
 
 	// http client based on request initialized
 	client := &http.Client{}
-	return client.Do(req)
+	if faulty() {
+		client.Transport = faultTransport{http.DefaultTransport}
+	}
+	res, err := client.Do(req)
+	if err == nil {
+		logCorrelation(fn, res)
+	}
+	return res, err
+}
+
+// logCorrelation prints the request ID sent and any
+// correlation headers SKUVault sent back, for -v.
+func logCorrelation(fn string, res *http.Response) {
+	if verbosity() < levelVerbose {
+		return
+	}
+	ids := []string{"sent " + res.Request.Header.Get("X-Request-Id")}
+	for _, h := range correlationHeaders {
+		if v := res.Header.Get(h); v != "" {
+			ids = append(ids, h+" "+v)
+		}
+	}
+	echo(fmt.Sprintf("%s %d: %s", fn, res.StatusCode, strings.Join(ids, ", ")))
 }
 
 // getSkuCredentials gets the tokens needed for SKU vault
 // api calls.
 func getTokensFromWeb() *SkuTokens {
-	//  Asking for email for SKU Vault account
-	// fmt.Printf("SKU Vault email and password: ")
-	// fmt.Printf("Enter your SKU Valut Email address.\n")
-	// var usrEmail string
-	// var pass string
-	// _, err := fmt.Scanf("%s %s\n", &usrEmail, &pass)
-	// if err != nil {
-	// 	log.Fatalf("Unable to read email or password. %v", err)
-	// }
-
-	//  Asking for password for SKU Vault account
-	// fmt.Printf("Enter your SKU Valut Password.\n")
-	// if _, err := fmt.Scan(&pass); err != nil {
-	// 	log.Fatalf("Unable to read password %v", err)
-	// }
+	toks, err := exchangeTokens()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return toks
+}
 
+// exchangeTokens trades the SKUVault account login
+// in skuvault-acc.json for fresh tokens.
+func exchangeTokens() (*SkuTokens, error) {
 	type Login struct {
 		Email    string
 		Password string
@@ -206,38 +409,28 @@ func getTokensFromWeb() *SkuTokens {
 	// getting SKUVault account login JSON file path
 	usr, err := user.Current()
 	if err != nil {
-		log.Fatalf("Unable to set as user (OS): %v", err)
+		return nil, fmt.Errorf("Unable to set as user (OS): %v", err)
 	}
 	tokenCacheDir := filepath.Join(usr.HomeDir, ".credentials")
 	os.MkdirAll(tokenCacheDir, 0700)
 
 	// getting SKUVault account login file
-	f, err := os.Open(filepath.Join(tokenCacheDir, url.QueryEscape("skuvault-acc.json")))
+	b, err := readSecret(filepath.Join(tokenCacheDir, url.QueryEscape("skuvault-acc.json")))
 	if err != nil {
-		log.Fatalf("Unable to open SKUVault account file: %v", err)
+		return nil, fmt.Errorf("Unable to open SKUVault account file: %v", err)
 	}
-	defer f.Close()
 
 	lgn := Login{}
-	err = json.NewDecoder(f).Decode(&lgn)
+	err = json.Unmarshal(b, &lgn)
 	if err != nil {
-		log.Fatalf("Unable to decode skuvault-acc.json: %v", err)
+		return nil, fmt.Errorf("Unable to decode skuvault-acc.json: %v", err)
 	}
 
-	res, err := vaultRequest(`getTokens`, struct2JSON(lgn))
+	toks, err := vault.GetTokens(runContext, lgn.Email, lgn.Password)
 	if err != nil {
-		log.Fatalf("Unable to get SKUVault tokens: %v", err)
+		return nil, fmt.Errorf("Unable to get SKUVault tokens: %v", err)
 	}
-	defer res.Body.Close()
-
-	// grab the SKUVault account POST tokens
-	toks := &SkuTokens{}
-	err = json.NewDecoder(res.Body).Decode(toks)
-	if err != nil {
-		log.Fatalf("Unable to decode SKUVault tokens {\n\t%s,\n\t%s\n}\n: %v", toks.TenantToken, toks.UserToken, err)
-	}
-
-	return toks
+	return toks, nil
 }
 
 func printResponse(res *http.Response) {
@@ -248,34 +441,48 @@ func printResponse(res *http.Response) {
 	fmt.Println(string(b))
 }
 
-// responseStatus
-func responseStatus(res *http.Response) string {
-	body := ResponseBody{}
-	json.NewDecoder(res.Body).Decode(&body)
-	defer res.Body.Close()
-	for _, err := range body.Errors {
-		return strings.Join(err.ErrorMessages[:], `, `)
+// responseStatus gives every error's messages in one line,
+// blank when SKUVault reported none.
+func responseStatus(body ResponseBody) string {
+	var msgs []string
+	for _, e := range body.Errors {
+		if m := strings.Join(e.ErrorMessages, ", "); m != "" {
+			msgs = append(msgs, m)
+		}
 	}
-	return ""
+	return strings.Join(msgs, "; ")
 }
 
 // echo center-formats messages in a specific style,
-// only for the console though.
+// only for the console though; -q silences it.
 func echo(s string) {
+	if verbosity() < levelNormal {
+		return
+	}
+	say(s)
+}
+
+// say echoes a message regardless of -q, for warnings
+// and summaries.
+func say(s string) {
 	L := "[:::"
 	R := ":::]"
 	IP := 120 - len(L) - len(R)
 	LP := IP/2 - len(s)/2
 	RP := IP - len(s) - LP
+	if LP < 0 || RP < 0 {
+		LP, RP = 0, 0
+	}
 	LS := strings.Repeat(".", LP)
 	RS := strings.Repeat(".", RP)
 
 	fmt.Printf("%s%s%s%s%s\n", L, LS, s, RS, R)
+	shipLog("INFO", s)
 }
 
 // timeTrack tracks time spent executing any func
 // this is to better understand how long a run will be.
 func timeTrack(start time.Time) {
 	elapsed := time.Since(start)
-	echo(fmt.Sprintf("Drive2Sku took %v seconds.", time.Duration(elapsed)))
+	say(fmt.Sprintf("Drive2Sku took %v seconds.", time.Duration(elapsed)))
 }
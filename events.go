@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// event is one line of a run's progress as streamed to
+// tail: what say and echo print, and logged errors.
+type event struct {
+	Time     time.Time
+	Severity string
+	Msg      string
+}
+
+// eventBuffer is how many events a slow watcher may fall
+// behind before it misses some.
+const eventBuffer = 256
+
+// eventHub passes each event on to whoever is watching.
+type eventHub struct {
+	mu       sync.Mutex
+	watchers map[chan event]bool
+}
+
+// events is the daemon's hub, nil outside daemon mode.
+var events *eventHub
+
+// startEvents ships the daemon's progress and errors
+// to the hub for /events.
+func startEvents() {
+	events = &eventHub{watchers: map[chan event]bool{}}
+	shippers = append(shippers, events)
+	log.SetOutput(logWriter{})
+}
+
+// ship passes an event to every watcher without waiting
+// on any of them.
+func (h *eventHub) ship(severity, msg string) {
+	e := event{time.Now(), severity, msg}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.watchers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (h *eventHub) flush() {}
+
+// watch registers a watcher, returning its events and
+// a function ending the watch.
+func (h *eventHub) watch() (<-chan event, func()) {
+	ch := make(chan event, eventBuffer)
+	h.mu.Lock()
+	h.watchers[ch] = true
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.watchers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// handleEvents streams events as server-sent events, one
+// JSON object per message, until the watcher goes away.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if events == nil || !ok {
+		http.Error(w, "no events to stream", http.StatusNotFound)
+		return
+	}
+	ch, stop := events.watch()
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fl.Flush()
+	gone := r.Context().Done()
+	for {
+		select {
+		case e := <-ch:
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			fl.Flush()
+		case <-gone:
+			return
+		}
+	}
+}
+
+// tailCmd prints a running daemon's events as they happen.
+//
+//	drive2sku tail [-addr localhost:8081]
+func tailCmd(args []string) {
+	readConfig()
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	addr := fs.String("addr", cfg.HealthAddr, "the daemon's health address")
+	fs.Parse(args)
+	if *addr == "" {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku tail -addr host:port (or set HealthAddr)")
+		os.Exit(2)
+	}
+	if strings.HasPrefix(*addr, ":") {
+		*addr = "localhost" + *addr
+	}
+
+	res, err := http.Get("http://" + *addr + "/events")
+	if err != nil {
+		log.Fatalf("Unable to reach the daemon: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Fatalf("Daemon answered %s", res.Status)
+	}
+	sc := bufio.NewScanner(res.Body)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(line[len("data: "):]), &e); err != nil {
+			continue
+		}
+		fmt.Printf("%s %-5s %s\n", e.Time.Format("15:04:05"), e.Severity, e.Msg)
+	}
+	fmt.Println("Daemon closed the stream.")
+}
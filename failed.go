@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// failFile sets a file aside with the reason it failed,
+// moving it to the failed folder when one is configured
+// and otherwise leaving it pending for the next run.
+func failFile(f drive.File, reason error) {
+	msg := fmt.Sprintf("%s: %v", f.Name, reason)
+	summary.recordError(msg)
+	unstage(f)
+
+	if replaying {
+		log.Printf("Unable to replay %s", msg)
+		return
+	}
+	if cfg.FailedFolder == "" {
+		log.Printf("Leaving failed file pending: %s", msg)
+		return
+	}
+
+	if readOnlySkip(fmt.Sprintf("moving %s to the failed folder: %v", f.Name, reason)) {
+		return
+	}
+	say(fmt.Sprintf(`Failing file "%s" (%s): %v`, f.Name, f.Id, reason))
+	_, err := driveFor(f.Id).Files.Update(f.Id, &drive.File{Description: "Drive2Sku: " + reason.Error()}).
+		AddParents(cfg.FailedFolder).RemoveParents(parentsOf(f)).Do()
+	if err != nil {
+		log.Printf("Unable to move %s to the failed folder: %v", f.Name, explainDrive(err))
+	}
+}
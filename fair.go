@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sync"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// fairDepth is how many payloads each vendor may have
+// waiting in the fair queue before its files hold off.
+const fairDepth = 10
+
+// fair is the run's fair queue, nil unless FairShare is set.
+var fair *fairQueue
+
+// fairQueue holds queued payloads by vendor and hands them
+// out in turns, each vendor sending as many payloads in a row
+// as its priority, so one vendor's backlog cannot hold up the
+// rest until it is done.
+type fairQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues map[string][]Payload
+	order  []string
+	turn   int
+	served int
+	closed bool
+}
+
+// newFairQueue starts an empty fair queue.
+func newFairQueue() *fairQueue {
+	q := &fairQueue{queues: map[string][]Payload{}}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// fairWeight is how many payloads a vendor sends per turn.
+func fairWeight(vendor string) int {
+	return limit(settings[vendor].Priority)
+}
+
+// push queues a payload behind its vendor's others, waiting
+// while the vendor already has fairDepth queued; it reports
+// false if the payload's context ends first.
+func (q *fairQueue) push(pl Payload) bool {
+	ctx := pl.context()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.cond.Broadcast()
+			q.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.queues[pl.vendor]) >= fairDepth {
+		if ctx.Err() != nil {
+			return false
+		}
+		q.cond.Wait()
+	}
+	if len(q.queues[pl.vendor]) == 0 {
+		q.order = append(q.order, pl.vendor)
+	}
+	q.queues[pl.vendor] = append(q.queues[pl.vendor], pl)
+	q.cond.Broadcast()
+	return true
+}
+
+// pop takes the next payload in turn, waiting for one;
+// it reports false once the queue is closed and empty.
+func (q *fairQueue) pop() (Payload, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.order) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.order) == 0 {
+		return Payload{}, false
+	}
+	if q.turn >= len(q.order) {
+		q.turn = 0
+	}
+	vendor := q.order[q.turn]
+	pl := q.queues[vendor][0]
+	q.queues[vendor] = q.queues[vendor][1:]
+	q.served++
+	if len(q.queues[vendor]) == 0 {
+		// the next vendor moves up into this turn
+		delete(q.queues, vendor)
+		q.order = append(q.order[:q.turn], q.order[q.turn+1:]...)
+		q.served = 0
+	} else if q.served >= fairWeight(vendor) {
+		q.turn++
+		q.served = 0
+	}
+	q.cond.Broadcast()
+	return pl, true
+}
+
+// feed passes payloads in turn to the relay until closed.
+func (q *fairQueue) feed() {
+	for {
+		pl, ok := q.pop()
+		if !ok {
+			return
+		}
+		lastPlCh <- pl
+	}
+}
+
+// drain empties the queue, giving back what it held.
+func (q *fairQueue) drain() []Payload {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var pls []Payload
+	for _, vendor := range q.order {
+		pls = append(pls, q.queues[vendor]...)
+	}
+	q.queues = map[string][]Payload{}
+	q.order = nil
+	q.cond.Broadcast()
+	return pls
+}
+
+// close ends feeding once the queue is empty.
+func (q *fairQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// lanes groups files into the sequences processed one file
+// at a time: a single lane in listing order, or with
+// FairShare one lane per vendor, running side by side so
+// their payloads can interleave. Files not claimed by a
+// vendor's mapping share a lane.
+func lanes(fls []*drive.File) [][]int {
+	if !cfg.FairShare {
+		idx := make([]int, len(fls))
+		for i := range idx {
+			idx[i] = i
+		}
+		return [][]int{idx}
+	}
+	var out [][]int
+	lane := map[string]int{}
+	for i, f := range fls {
+		vendor, _ := fileVendor(f.Name)
+		n, ok := lane[vendor]
+		if !ok {
+			n = len(out)
+			lane[vendor] = n
+			out = append(out, nil)
+		}
+		out[n] = append(out[n], i)
+	}
+	return out
+}
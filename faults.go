@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault-injection flags for exercising retry, backoff,
+// and spooling against controlled SKUVault misbehavior.
+// They are meant for testing only.
+var (
+	faultFail  = flag.Float64("fault-fail", 0, "fraction of SKUVault calls failing with a network error (testing)")
+	fault429   = flag.Float64("fault-429", 0, "fraction of SKUVault calls answered 429 (testing)")
+	faultDelay = flag.Duration("fault-delay", 0, "random delay up to this long before SKUVault calls (testing)")
+)
+
+// faultTransport injects the configured faults in front
+// of a real transport.
+type faultTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip delays, fails, or throttles a request at random,
+// otherwise passing it through untouched.
+func (t faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if *faultDelay > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(*faultDelay))))
+	}
+	if rand.Float64() < *faultFail {
+		return nil, errors.New("injected fault: connection reset")
+	}
+	if rand.Float64() < *fault429 {
+		body := `{"Status":"Throttled","Errors":[{"ErrorMessages":["injected fault: too many requests"]}]}`
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests)),
+			StatusCode:    http.StatusTooManyRequests,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}, "Retry-After": {"60"}},
+			Body:          ioutil.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return t.next.RoundTrip(req)
+}
+
+// faulty reports whether any fault injection is enabled.
+func faulty() bool {
+	return *faultFail > 0 || *fault429 > 0 || *faultDelay > 0
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// plCap is the most items SKUVault accepts in one payload.
+const plCap = 100
+
+// decodeFeed reads an entire vendor JSON file, a mapping of
+// vendor names to their keyed items.
+func decodeFeed(r io.Reader) (map[string]map[string]Item, error) {
+	vsd := map[string]map[string]Item{}
+	err := json.NewDecoder(r).Decode(&vsd)
+	return vsd, err
+}
+
+// errEmptyFile and errNoItems reject files that decode
+// without error yet hold nothing to post.
+var (
+	errEmptyFile = errors.New("file is empty")
+	errNoItems   = errors.New("file has no items")
+)
+
+// decodeFile reads a vendor file of any supported format,
+// failing files that are empty or hold no items, and
+// fills in the fields its vendors left out before running
+// their rules.
+func decodeFile(name string, r io.Reader) (map[string]map[string]Item, error) {
+	vsd, err := decodeFormat(name, r)
+	if err == io.EOF {
+		return nil, errEmptyFile
+	}
+	if err != nil {
+		return nil, err
+	}
+	if feedItems(vsd) == 0 {
+		return nil, errNoItems
+	}
+	convertUnits(vsd)
+	applyDefaults(vsd)
+	deriveLocations(vsd)
+	if err := applyRules(vsd); err != nil {
+		return nil, err
+	}
+	stampOrigin(name, vsd)
+	return vsd, nil
+}
+
+// stampOrigin marks each item with its vendor, and its file
+// and row, or its key for native JSON files.
+func stampOrigin(name string, vsd map[string]map[string]Item) {
+	_, _, mapped := vendorMapping(name)
+	for vendor, items := range vsd {
+		for key, iv := range items {
+			iv.vendor = vendor
+			if mapped {
+				iv.origin = fmt.Sprintf("%s row %s", name, key)
+			} else {
+				iv.origin = fmt.Sprintf("%s item %s", name, key)
+			}
+			items[key] = iv
+		}
+	}
+}
+
+// decodeFormat reads a file by its format. Files claimed by
+// a vendor's transform are converted by it, those claimed by
+// its mapping are read as rows, and anything else must be a
+// native vendor JSON file.
+func decodeFormat(name string, r io.Reader) (map[string]map[string]Item, error) {
+	if vendor, t, ok := vendorTransform(name); ok {
+		items, err := runTransform(t, name, r)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]map[string]Item{vendor: items}, nil
+	}
+	vendor, m, ok := vendorMapping(name)
+	if !ok {
+		return decodeFeed(r)
+	}
+	rows, err := readRows(name, r)
+	if err != nil {
+		return nil, err
+	}
+	items, err := applyMapping(m, rows)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]map[string]Item{vendor: items}, nil
+}
+
+// applyBuffer zeroes an item's quantity when it is at or
+// under the vendor's buffer for the given day of the week.
+func applyBuffer(vendor string, iv Item, t time.Time) Item {
+	switch t.Weekday() {
+	case time.Friday, time.Saturday, time.Sunday:
+		if iv.Quantity <= settings[vendor].WeekendBuffer {
+			iv.Quantity = 0
+		}
+	default:
+		if iv.Quantity <= settings[vendor].WeekdayBuffer {
+			iv.Quantity = 0
+		}
+	}
+	return iv
+}
+
+// chunkItems splits items into payloads filled up to
+// the item and byte caps, the last possibly partial.
+func chunkItems(items []Item) []Payload {
+	var pls []Payload
+	pl := Payload{Items: make([]Item, 0, plCap)}
+	size := payloadBytes(pl)
+	for _, iv := range items {
+		n := itemBytes(iv)
+		if !fits(pl, size, iv, n) {
+			pls = append(pls, pl)
+			pl = Payload{Items: make([]Item, 0, plCap)}
+			size = payloadBytes(pl)
+		}
+		pl.Items = append(pl.Items, iv)
+		size += n
+	}
+	if len(pl.Items) > 0 {
+		pls = append(pls, pl)
+	}
+	return pls
+}
+
+// payloadBytes is the serialized size of a payload
+// without its items.
+func payloadBytes(pl Payload) int {
+	b, _ := json.Marshal(Payload{Items: []Item{}, TenantToken: pl.TenantToken, UserToken: pl.UserToken})
+	return len(b)
+}
+
+// itemBytes is an item's share of a serialized payload,
+// counting the comma that separates it from the next.
+func itemBytes(iv Item) int {
+	b, _ := json.Marshal(iv)
+	return len(b) + 1
+}
+
+// fits reports whether an item of n bytes can join a payload
+// already size bytes long without passing the item or byte
+// caps, or mixing lot-tracked and plain items; an empty
+// payload always takes one item.
+func fits(pl Payload, size int, iv Item, n int) bool {
+	switch {
+	case len(pl.Items) == 0:
+		return true
+	case len(pl.Items) >= plCap:
+		return false
+	case (pl.Items[0].LotNumber == "") != (iv.LotNumber == ""):
+		return false
+	}
+	return cfg.MaxPayloadBytes <= 0 || size+n <= cfg.MaxPayloadBytes
+}
+
+// validateItem checks a single item against the shape
+// SKUVault expects before it is allowed into a payload.
+func validateItem(iv Item) error {
+	switch {
+	case iv.Sku == "":
+		return errors.New("missing Sku")
+	case iv.Quantity < 0:
+		return fmt.Errorf("negative Quantity %d", iv.Quantity)
+	case iv.WarehouseID <= 0:
+		return fmt.Errorf("invalid WarehouseID %d", iv.WarehouseID)
+	case iv.ExpirationDate != "" && iv.LotNumber == "":
+		return errors.New("ExpirationDate without LotNumber")
+	case iv.uom != "":
+		return unitErr(iv)
+	}
+	if iv.ExpirationDate != "" {
+		if _, err := time.Parse("2006-01-02", iv.ExpirationDate); err != nil {
+			return fmt.Errorf("ExpirationDate %q is not yyyy-mm-dd", iv.ExpirationDate)
+		}
+	}
+	return nil
+}
+
+// chunker packs a file's items into payloads, handing back
+// each payload once full and the last, partial one once.
+type chunker struct {
+	blank Payload
+	pl    Payload
+	size  int
+	done  bool
+}
+
+// newChunker packs payloads carrying the blank's tokens,
+// batch, and context.
+func newChunker(blank Payload) *chunker {
+	c := &chunker{blank: blank}
+	c.reset()
+	return c
+}
+
+// reset starts a fresh, empty payload.
+func (c *chunker) reset() {
+	c.pl = c.blank
+	c.pl.Items = make([]Item, 0, plCap)
+	c.size = payloadBytes(c.pl)
+}
+
+// add packs a vendor's item, giving the payload it filled
+// when the item had to start the next one.
+func (c *chunker) add(vendor string, iv Item) (Payload, bool) {
+	n := itemBytes(iv)
+	var full Payload
+	ok := false
+	if !fits(c.pl, c.size, iv, n) {
+		full, ok = c.pl, true
+		c.reset()
+	}
+	if len(c.pl.Items) == 0 {
+		c.pl.vendor = vendor
+	} else if c.pl.vendor != vendor {
+		c.pl.vendor = ""
+	}
+	c.pl.Items = append(c.pl.Items, iv)
+	c.size += n
+	return full, ok
+}
+
+// rest gives the last payload, if it holds anything, and
+// nothing on later calls.
+func (c *chunker) rest() (Payload, bool) {
+	if c.done || len(c.pl.Items) == 0 {
+		c.done = true
+		return Payload{}, false
+	}
+	c.done = true
+	pl := c.pl
+	c.reset()
+	return pl, true
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// chunk packs items the way sendPayloads does, giving every
+// payload the chunker hands back.
+func chunk(items []Item) []Payload {
+	var pls []Payload
+	c := newChunker(Payload{TenantToken: "tenant", UserToken: "user"})
+	for _, iv := range items {
+		if full, ok := c.add("acme", iv); ok {
+			pls = append(pls, full)
+		}
+	}
+	if last, ok := c.rest(); ok {
+		pls = append(pls, last)
+	}
+	return pls
+}
+
+// plainItems makes n plain items with distinct SKUs.
+func plainItems(n int) []Item {
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{Sku: fmt.Sprintf("SKU-%04d", i), Quantity: 5, WarehouseID: 1, LocationCode: "A1"}
+	}
+	return items
+}
+
+// sizes lists the payloads' item counts.
+func sizes(pls []Payload) []int {
+	ns := make([]int, len(pls))
+	for i, pl := range pls {
+		ns[i] = len(pl.Items)
+	}
+	return ns
+}
+
+func TestChunkerItemCap(t *testing.T) {
+	defer func(n int) { cfg.MaxPayloadBytes = n }(cfg.MaxPayloadBytes)
+	cfg.MaxPayloadBytes = 0
+
+	for _, tt := range []struct {
+		items int
+		want  []int
+	}{
+		{1, []int{1}},
+		{99, []int{99}},
+		{plCap, []int{plCap}},
+		{plCap + 1, []int{plCap, 1}},
+		{2 * plCap, []int{plCap, plCap}},
+		{3 * plCap, []int{plCap, plCap, plCap}},
+	} {
+		got := sizes(chunk(plainItems(tt.items)))
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%d items packed as %v, want %v", tt.items, got, tt.want)
+		}
+	}
+}
+
+func TestChunkerKeepsEveryItemInOrder(t *testing.T) {
+	defer func(n int) { cfg.MaxPayloadBytes = n }(cfg.MaxPayloadBytes)
+	cfg.MaxPayloadBytes = 0
+
+	items := plainItems(2*plCap + 37)
+	var got []Item
+	for _, pl := range chunk(items) {
+		if pl.TenantToken != "tenant" || pl.UserToken != "user" || pl.vendor != "acme" {
+			t.Errorf("payload lost its blank's fields: %+v", pl)
+		}
+		got = append(got, pl.Items...)
+	}
+	if len(got) != len(items) {
+		t.Fatalf("packed %d items, want %d", len(got), len(items))
+	}
+	for i := range items {
+		if got[i].Sku != items[i].Sku {
+			t.Fatalf("item %d is %s, want %s", i, got[i].Sku, items[i].Sku)
+		}
+	}
+}
+
+func TestChunkerByteCap(t *testing.T) {
+	defer func(n int) { cfg.MaxPayloadBytes = n }(cfg.MaxPayloadBytes)
+	items := plainItems(50)
+	blank := Payload{TenantToken: "tenant", UserToken: "user"}
+	per := itemBytes(items[0])
+	cfg.MaxPayloadBytes = payloadBytes(blank) + 10*per
+
+	pls := chunk(items)
+	if got := sizes(pls); fmt.Sprint(got) != "[10 10 10 10 10]" {
+		t.Fatalf("packed as %v, want five payloads of 10", got)
+	}
+	for i, pl := range pls {
+		b, err := json.Marshal(pl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > cfg.MaxPayloadBytes {
+			t.Errorf("payload %d is %d bytes, over the %d cap", i, len(b), cfg.MaxPayloadBytes)
+		}
+	}
+
+	// an item too big for any payload still goes, alone
+	cfg.MaxPayloadBytes = 1
+	if got := sizes(chunk(plainItems(3))); fmt.Sprint(got) != "[1 1 1]" {
+		t.Errorf("oversized items packed as %v, want one each", got)
+	}
+}
+
+func TestChunkerSeparatesLots(t *testing.T) {
+	defer func(n int) { cfg.MaxPayloadBytes = n }(cfg.MaxPayloadBytes)
+	cfg.MaxPayloadBytes = 0
+
+	items := plainItems(6)
+	for _, i := range []int{2, 3} {
+		items[i].LotNumber = "LOT-1"
+		items[i].ExpirationDate = "2030-01-01"
+	}
+	pls := chunk(items)
+	if got := sizes(pls); fmt.Sprint(got) != "[2 2 2]" {
+		t.Fatalf("packed as %v, want [2 2 2]", got)
+	}
+	for i, pl := range pls {
+		lot := pl.Items[0].LotNumber != ""
+		for _, iv := range pl.Items {
+			if (iv.LotNumber != "") != lot {
+				t.Errorf("payload %d mixes lot and plain items", i)
+			}
+		}
+		if lot != (i == 1) {
+			t.Errorf("payload %d lot = %v", i, lot)
+		}
+	}
+}
+
+func TestChunkerEmpty(t *testing.T) {
+	if pls := chunk(nil); len(pls) != 0 {
+		t.Errorf("an empty file gave %d payloads", len(pls))
+	}
+}
+
+func TestChunkerRestOnce(t *testing.T) {
+	defer func(n int) { cfg.MaxPayloadBytes = n }(cfg.MaxPayloadBytes)
+	cfg.MaxPayloadBytes = 0
+
+	c := newChunker(Payload{})
+	for _, iv := range plainItems(3) {
+		if _, ok := c.add("acme", iv); ok {
+			t.Fatal("3 items filled a payload")
+		}
+	}
+	last, ok := c.rest()
+	if !ok || len(last.Items) != 3 {
+		t.Fatalf("rest gave %d items, %v; want 3, true", len(last.Items), ok)
+	}
+	if pl, ok := c.rest(); ok {
+		t.Errorf("second rest gave %d more items", len(pl.Items))
+	}
+
+	c = newChunker(Payload{})
+	for _, iv := range plainItems(3) {
+		c.add("acme", iv)
+	}
+	c.reset()
+	if pl, ok := c.rest(); ok {
+		t.Errorf("rest after reset gave %d items", len(pl.Items))
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// feedFile reports whether a file is one of the configured
+// feed types, by extension or MIME type; with neither set,
+// every file is. Drop manifests always are.
+func feedFile(f *drive.File) bool {
+	if len(cfg.FeedExtensions) == 0 && len(cfg.FeedMimeTypes) == 0 {
+		return true
+	}
+	if _, _, manifest, _ := dropOf(f.Name); manifest {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(f.Name))
+	for _, e := range cfg.FeedExtensions {
+		if "."+strings.TrimPrefix(strings.ToLower(e), ".") == ext {
+			return true
+		}
+	}
+	for _, m := range cfg.FeedMimeTypes {
+		if m == f.MimeType || strings.HasSuffix(m, "/*") && strings.HasPrefix(f.MimeType, strings.TrimSuffix(m, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// feedFiles gives the pending files that are feeds, reporting
+// the others, which are left where they are.
+func feedFiles(fls []*drive.File) []*drive.File {
+	var feeds []*drive.File
+	var ignored []string
+	for _, f := range fls {
+		if feedFile(f) {
+			feeds = append(feeds, f)
+		} else {
+			ignored = append(ignored, fmt.Sprintf("%s (%s)", f.Name, f.MimeType))
+		}
+	}
+	if len(ignored) > 0 {
+		say(fmt.Sprintf("Ignoring %d files that are not feeds: %s", len(ignored), strings.Join(ignored, ", ")))
+	}
+	return feeds
+}
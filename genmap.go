@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// genmapCmd inspects a sample vendor file and prints a starter
+// vendor settings entry, mapping included, to edit into buffers.json.
+//
+//	drive2sku genmap -vendor "Acme" sample.csv
+func genmapCmd(args []string) {
+	fs := flag.NewFlagSet("genmap", flag.ExitOnError)
+	vendor := fs.String("vendor", "", "vendor name for the generated profile")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku genmap [-vendor name] <sample-file>")
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Unable to open sample file: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := readRows(path, f)
+	if err != nil {
+		log.Fatalf("Unable to read sample file: %v", err)
+	}
+	if len(rows) == 0 {
+		log.Fatalf("Sample file %s has no header row", path)
+	}
+
+	m := inferMapping(rows)
+	m.Match = matchPattern(path)
+
+	if *vendor == "" {
+		*vendor = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	b, err := json.MarshalIndent(map[string]VendorSettings{*vendor: {Mapping: m}}, "", "    ")
+	if err != nil {
+		log.Fatalf("Unable to encode mapping profile: %v", err)
+	}
+	fmt.Println(string(b))
+
+	for _, field := range []struct{ name, col string }{{"Sku", m.Sku}, {"Quantity", m.Quantity}} {
+		if field.col == "" {
+			fmt.Fprintf(os.Stderr, "No column looked like %s; fill it in by hand\n", field.name)
+		}
+	}
+}
+
+// fieldHints are lowercase fragments of column names that
+// suggest which Item field a column holds, checked in order.
+var fieldHints = []struct {
+	field string
+	hints []string
+}{
+	{"ExpirationDate", []string{"expir", "exp date", "best before", "use by"}},
+	{"LotNumber", []string{"lot", "batch"}},
+	{"UOM", []string{"uom", "unit of measure"}},
+	{"WarehouseID", []string{"warehouse", "whse", "wh"}},
+	{"LocationCode", []string{"location", "loc", "bin"}},
+	{"Quantity", []string{"quantity", "qty", "stock", "avail", "onhand", "on hand", "inventory"}},
+	{"Sku", []string{"sku", "upc", "item", "part", "style", "code"}},
+}
+
+// inferMapping guesses column types and the column
+// most likely to fill each Item field.
+func inferMapping(rows [][]string) *Mapping {
+	header := rows[0]
+	m := &Mapping{Columns: map[string]string{}}
+	for i, col := range header {
+		col = strings.TrimSpace(col)
+		m.Columns[col] = columnType(rows[1:], i)
+	}
+
+	for _, fh := range fieldHints {
+		for _, col := range header {
+			col = strings.TrimSpace(col)
+			if !hasHint(col, fh.hints) || taken(m, col) {
+				continue
+			}
+			switch fh.field {
+			case "Sku":
+				m.Sku = col
+			case "Quantity":
+				if m.Columns[col] == "string" {
+					continue
+				}
+				m.Quantity = col
+			case "LocationCode":
+				m.LocationCode = col
+			case "WarehouseID":
+				m.WarehouseID = col
+			case "LotNumber":
+				m.LotNumber = col
+			case "ExpirationDate":
+				m.ExpirationDate = col
+			case "UOM":
+				m.UOM = col
+			}
+			break
+		}
+	}
+	return m
+}
+
+// hasHint reports whether a column name contains any hint.
+func hasHint(col string, hints []string) bool {
+	lc := strings.ToLower(col)
+	for _, h := range hints {
+		if strings.Contains(lc, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// taken reports whether a column is already mapped to a field.
+func taken(m *Mapping, col string) bool {
+	return col == m.Sku || col == m.Quantity || col == m.LocationCode || col == m.WarehouseID ||
+		col == m.LotNumber || col == m.ExpirationDate || col == m.UOM
+}
+
+// columnType infers "int", "float", or "string" for a column
+// from its non-empty sample values.
+func columnType(rows [][]string, i int) string {
+	typ := ""
+	for _, row := range rows {
+		if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+			continue
+		}
+		v := strings.TrimSpace(row[i])
+		switch {
+		case typ != "float" && isInt(v):
+			typ = "int"
+		case isFloat(v):
+			typ = "float"
+		default:
+			return "string"
+		}
+	}
+	if typ == "" {
+		return "string"
+	}
+	return typ
+}
+
+func isInt(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func isFloat(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// matchPattern derives a filename glob from a sample name by
+// wildcarding its digits, so dated uploads keep matching.
+func matchPattern(path string) string {
+	base := filepath.Base(path)
+	var b strings.Builder
+	star := false
+	for _, r := range base {
+		if r >= '0' && r <= '9' {
+			if !star {
+				b.WriteByte('*')
+				star = true
+			}
+			continue
+		}
+		star = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync/atomic"
+)
+
+// gzipRejected is set once SKUVault turns down a gzipped
+// body, so later requests go uncompressed.
+var gzipRejected int32
+
+// gzipOn reports whether request bodies should be gzipped.
+func gzipOn() bool {
+	return cfg.Gzip && atomic.LoadInt32(&gzipRejected) == 0
+}
+
+// rejectGzip stops gzipping request bodies for the rest of
+// the process.
+func rejectGzip() {
+	if atomic.CompareAndSwapInt32(&gzipRejected, 0, 1) {
+		say("SKUVault rejected a gzipped body; sending uncompressed")
+	}
+}
+
+// gzipBody compresses a request body.
+func gzipBody(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// probe checks last-run freshness and exits, for use as
+// a container liveness or readiness command.
+var probe = flag.Bool("probe", false, "exit 0 if the last run is fresh, 1 otherwise")
+
+// statusFile records the latest run's start and finish.
+const statusFile = "status.json"
+
+// runStatus is the persisted state of the latest run.
+type runStatus struct {
+	Started  time.Time
+	Finished time.Time
+
+	// Standby is when this replica last renewed its place
+	// standing by for another's leadership; zero while it
+	// leads or election is off. Led is when it last took
+	// leadership, which counts as fresh until its first run.
+	Standby time.Time `json:",omitempty"`
+	Led     time.Time `json:",omitempty"`
+}
+
+// statePath locates a state file inside the state directory.
+func statePath(name string) string {
+	return filepath.Join(cfg.StateDir, name)
+}
+
+// markRun saves the latest run's status; failures are
+// logged rather than fatal since they only affect probes.
+func markRun(st runStatus) {
+	if err := writeJSON(statePath(statusFile), st); err != nil {
+		log.Printf("Unable to save run status: %v", err)
+	}
+}
+
+// markStandby records whether this replica stands by as of
+// now, keeping the runs it recorded while leading.
+func markStandby(standby bool) {
+	var st runStatus
+	readJSON(statePath(statusFile), &st)
+	st.Standby = time.Time{}
+	if standby {
+		st.Standby = time.Now()
+	} else {
+		st.Led = time.Now()
+	}
+	markRun(st)
+}
+
+// maxRunAge is how stale the last run may be before
+// the process is reported unhealthy.
+func maxRunAge() time.Duration {
+	if cfg.HealthMaxAge.Duration > 0 {
+		return cfg.HealthMaxAge.Duration
+	}
+	return 2*cfg.Interval.Duration + time.Hour
+}
+
+// checkHealth reports why the process is unhealthy, or nil.
+// A run still in progress counts as fresh until it too
+// outlives the allowed age. A replica standing by is healthy
+// while it keeps renewing its standby.
+func checkHealth() (runStatus, error) {
+	var st runStatus
+	if err := readJSON(statePath(statusFile), &st); err != nil {
+		return st, fmt.Errorf("no run recorded: %v", err)
+	}
+	if !st.Standby.IsZero() {
+		if age := time.Since(st.Standby); age > maxRunAge() {
+			return st, fmt.Errorf("standing by, last renewed %v ago, exceeds %v", age.Round(time.Second), maxRunAge())
+		}
+		return st, nil
+	}
+	last := st.Finished
+	if st.Started.After(last) {
+		last = st.Started
+	}
+	if st.Led.After(last) {
+		last = st.Led
+	}
+	if age := time.Since(last); age > maxRunAge() {
+		return st, fmt.Errorf("last run %v ago exceeds %v", age.Round(time.Second), maxRunAge())
+	}
+	return st, nil
+}
+
+// runProbe prints health and exits 0 when fresh, 1 when stale.
+func runProbe() {
+	readConfig()
+	if _, err := checkHealth(); err != nil {
+		fmt.Println("unhealthy:", err)
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+	os.Exit(0)
+}
+
+// handleHealthz answers 200 while the last run is fresh, or
+// while standing by for the leader, and 503 once stale.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	st, err := checkHealth()
+	body := map[string]interface{}{
+		"status":   "ok",
+		"started":  st.Started,
+		"finished": st.Finished,
+		"paused":   isPaused(),
+		"leader":   isLeader(),
+	}
+	if !st.Standby.IsZero() {
+		body["status"] = "standby"
+		body["standby"] = st.Standby
+	}
+	if lost := driveLostSince(); !lost.IsZero() {
+		body["driveLost"] = lost
+	}
+	code := http.StatusOK
+	if err != nil {
+		body["status"] = "unhealthy"
+		body["error"] = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// startHealth serves /healthz, and /events for tail, on
+// the configured address.
+func startHealth() {
+	if cfg.HealthAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/events", handleEvents)
+	go func() {
+		log.Printf("Health server stopped: %v", http.ListenAndServe(cfg.HealthAddr, mux))
+	}()
+}
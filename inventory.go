@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// inventoryDir holds one file per day of the quantities
+// believed set in SKUVault at that day's end, every position
+// carried forward from the days before.
+const inventoryDir = "inventory"
+
+// position is a stock position's quantity as last sent.
+type position struct {
+	Sku          string
+	WarehouseID  int
+	LocationCode string `json:",omitempty"`
+	LotNumber    string `json:",omitempty"`
+	Quantity     int
+	Sent         time.Time
+	Vendor       string
+}
+
+// recordSent notes the items of an accepted payload,
+// less those SKUVault rejected, and how long they took.
+func (s *runSummary) recordSent(pl Payload, errs []ErrorBody) {
+	rejected := map[itemKey]bool{}
+	for _, e := range errs {
+		iv := rejectedItem(pl, e)
+		rejected[keyOf("", iv)] = true
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sent == nil {
+		s.sent = map[itemKey]position{}
+	}
+	acked := map[string]int{}
+	for _, iv := range pl.Items {
+		k := keyOf("", iv)
+		if rejected[k] {
+			continue
+		}
+		s.sent[k] = position{iv.Sku, iv.WarehouseID, iv.LocationCode, iv.LotNumber, iv.Quantity, now, iv.vendor}
+		acked[iv.vendor]++
+		recordTrend(iv)
+	}
+	s.recordAck(pl, acked)
+}
+
+// saveInventory folds the run's sent quantities into today's
+// inventory file. Runs against the mock vault are left out.
+func saveInventory() {
+	summary.mu.Lock()
+	sent := summary.sent
+	summary.mu.Unlock()
+	if len(sent) == 0 || *mockVault {
+		return
+	}
+
+	today := time.Now().Format("2006-01-02")
+	ps, err := inventoryOn(today)
+	if err != nil {
+		log.Printf("Unable to read inventory history: %v", err)
+		return
+	}
+	byKey := map[string]position{}
+	for _, p := range ps {
+		byKey[positionKey(p)] = p
+	}
+	for _, p := range sent {
+		byKey[positionKey(p)] = p
+	}
+	ps = ps[:0]
+	for _, p := range byKey {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return positionKey(ps[i]) < positionKey(ps[j]) })
+
+	os.MkdirAll(statePath(inventoryDir), 0700)
+	if err := writeJSON(filepath.Join(statePath(inventoryDir), today+".json"), ps); err != nil {
+		log.Printf("Unable to save inventory history: %v", err)
+	}
+}
+
+// positionKey identifies a stock position across days.
+func positionKey(p position) string {
+	return fmt.Sprintf("%s\x00%d\x00%s\x00%s", p.Sku, p.WarehouseID, p.LocationCode, p.LotNumber)
+}
+
+// inventoryOn reads the positions believed set at the end
+// of a day (yyyy-mm-dd), from the latest file on or before it.
+func inventoryOn(day string) ([]position, error) {
+	names, err := filepath.Glob(filepath.Join(statePath(inventoryDir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var latest string
+	for _, name := range names {
+		if strings.TrimSuffix(filepath.Base(name), ".json") <= day {
+			latest = name
+		}
+	}
+	if latest == "" {
+		return nil, nil
+	}
+	var ps []position
+	err = readJSON(latest, &ps)
+	return ps, err
+}
+
+// stockCmd shows the quantities believed set in SKUVault
+// for SKUs at the end of a past day.
+//
+//	drive2sku stock [-on yyyy-mm-dd] <sku>...
+func stockCmd(args []string) {
+	fs := flag.NewFlagSet("stock", flag.ExitOnError)
+	on := fs.String("on", time.Now().Format("2006-01-02"), "day to view, yyyy-mm-dd")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku stock [-on yyyy-mm-dd] <sku>...")
+		os.Exit(2)
+	}
+	if _, err := time.Parse("2006-01-02", *on); err != nil {
+		log.Fatalf("Unable to parse -on %q: %v", *on, err)
+	}
+
+	readConfig()
+	ps, err := inventoryOn(*on)
+	if err != nil {
+		log.Fatalf("Unable to read inventory history: %v", err)
+	}
+	want := map[string]bool{}
+	for _, sku := range fs.Args() {
+		want[sku] = true
+	}
+
+	fmt.Printf("%-20s %4s %-12s %-12s %8s  %-16s %s\n", "SKU", "WH", "LOCATION", "LOT", "QTY", "SENT", "VENDOR")
+	found := map[string]bool{}
+	for _, p := range ps {
+		if !want[p.Sku] {
+			continue
+		}
+		found[p.Sku] = true
+		fmt.Printf("%-20s %4d %-12s %-12s %8d  %-16s %s\n", p.Sku, p.WarehouseID, p.LocationCode, p.LotNumber,
+			p.Quantity, p.Sent.Format("2006-01-02 15:04"), p.Vendor)
+	}
+	for _, sku := range fs.Args() {
+		if !found[sku] {
+			fmt.Printf("%-20s never sent by %s\n", sku, *on)
+		}
+	}
+}
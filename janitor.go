@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// janitorCmd purges leftovers older than their retention.
+//
+//	drive2sku janitor
+func janitorCmd(args []string) {
+	fs := flag.NewFlagSet("janitor", flag.ExitOnError)
+	fs.Parse(args)
+
+	readConfig()
+	if _, ok := cfg.Retention["processed"]; ok && cfg.ProcessedFolder != "" {
+		initDriveAndVault()
+	}
+	janitor()
+}
+
+// janitor applies every configured retention period.
+// Failures are logged so one bad kind doesn't stop the rest.
+func janitor() {
+	for kind, keep := range cfg.Retention {
+		cutoff := time.Now().Add(-keep.Duration)
+		var n int
+		var err error
+		switch kind {
+		case "processed":
+			n, err = purgeProcessed(cutoff)
+		case "spool", inventoryDir, stagingDir:
+			n, err = purgeDir(statePath(kind), cutoff)
+		default:
+			n, err = purgeTable(kind, cutoff)
+		}
+		if err != nil {
+			log.Printf("Unable to purge %s: %v", kind, err)
+			continue
+		}
+		if n > 0 {
+			echo(fmt.Sprintf("Purged %d %s older than %v", n, kind, keep.Duration))
+		}
+	}
+}
+
+// purgeProcessed deletes archived Drive files last
+// modified before the cutoff.
+func purgeProcessed(cutoff time.Time) (int, error) {
+	if cfg.ProcessedFolder == "" || drv == nil {
+		return 0, nil
+	}
+	q := fmt.Sprintf(`'%s' in parents and trashed = false and modifiedTime < '%s'`,
+		cfg.ProcessedFolder, cutoff.UTC().Format(time.RFC3339))
+	n := 0
+	for {
+		// deleted files drop out, so relist until none remain
+		fl, err := drv.Files.List().Q(q).Fields("files(id,name)").Do()
+		if err != nil || len(fl.Files) == 0 {
+			return n, err
+		}
+		for _, f := range fl.Files {
+			if err := drv.Files.Delete(f.Id).Do(); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+}
+
+// purgeDir removes files in a state directory last
+// modified before the cutoff.
+func purgeDir(dir string, cutoff time.Time) (int, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, fi := range fis {
+		if fi.IsDir() || !fi.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// purgeTable rewrites a state table without the rows stamped
+// before the cutoff, replacing it atomically. Rows are stamped
+// by a "Time" field, or "Start" for runs.
+func purgeTable(table string, cutoff time.Time) (int, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	var kept []json.RawMessage
+	n := 0
+	err := scanRecords(table, func(raw json.RawMessage) error {
+		var stamp struct {
+			Time  time.Time
+			Start time.Time
+		}
+		json.Unmarshal(raw, &stamp)
+		t := stamp.Time
+		if t.IsZero() {
+			t = stamp.Start
+		}
+		if !t.IsZero() && t.Before(cutoff) {
+			n++
+			return nil
+		}
+		kept = append(kept, append(json.RawMessage(nil), raw...))
+		return nil
+	})
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	path := statePath(table + ".jsonl")
+	tmp, err := ioutil.TempFile(filepath.Dir(path), table+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, raw := range kept {
+		w.Write(raw)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
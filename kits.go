@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// kitLine is one component line of a SKUVault kit: Quantity
+// of any one of Items makes up the line.
+type kitLine struct {
+	LineName string
+	Quantity int
+	Items    []struct{ Sku string }
+}
+
+// kit gives a SKU's kit lines, if it is a kit.
+func (c *catalog) kit(sku string) ([]kitLine, bool) {
+	if c == nil {
+		return nil, false
+	}
+	lines, ok := c.Kits[sku]
+	return lines, ok
+}
+
+// expandKit turns a quantity of kits into the quantities
+// of the first component of each kit line.
+func expandKit(iv Item, lines []kitLine) []Item {
+	var ivs []Item
+	for _, l := range lines {
+		if len(l.Items) == 0 {
+			continue
+		}
+		c := iv
+		c.Sku = l.Items[0].Sku
+		c.Quantity = iv.Quantity * l.Quantity
+		ivs = append(ivs, c)
+	}
+	return ivs
+}
+
+// screenItem gives what should be posted for one item,
+// split over its vendor's warehouses first when it has a
+// Split.
+func screenItem(vendor string, fs []drive.File, iv Item) []Item {
+	parts := splitItem(vendor, iv)
+	if len(parts) == 1 {
+		return screenPart(vendor, fs, parts[0])
+	}
+	var ivs []Item
+	for _, part := range parts {
+		ivs = append(ivs, screenPart(vendor, fs, part)...)
+	}
+	return ivs
+}
+
+// screenPart gives what should be posted for one item:
+// nothing when its unit is unknown, it is quarantined or
+// held as out of line with its history, or it fails
+// pre-validation, its components or nothing when
+// it is a kit, else itself.
+func screenPart(vendor string, fs []drive.File, iv Item) []Item {
+	if iv.uom != "" {
+		msg := fmt.Sprintf("Sku %q not posted: %v", iv.Sku, unitErr(iv))
+		say(msg)
+		summary.recordError(msg)
+		return nil
+	}
+	if !knownWarehouse(iv.WarehouseID) {
+		quarantine(vendor, fs, iv, "")
+		return nil
+	}
+	if why, odd := trendOutlier(vendor, iv); odd {
+		say(fmt.Sprintf("Holding %s %s for review: %s", vendor, iv.Sku, why))
+		quarantine(vendor, fs, iv, why)
+		return nil
+	}
+	if cfg.PreValidate && !cachedCatalog().has(iv.Sku) {
+		reportUnknownSku(0, iv.Sku, "not in SKUVault catalog")
+		return nil
+	}
+	if cfg.Kits == "" {
+		return []Item{iv}
+	}
+	lines, ok := cachedCatalog().kit(iv.Sku)
+	if !ok {
+		return []Item{iv}
+	}
+	if cfg.Kits == "expand" {
+		echoAt(levelVerbose, fmt.Sprintf("Expanding %s kit %s into %d components", vendor, iv.Sku, len(lines)))
+		return expandKit(iv, lines)
+	}
+	say(fmt.Sprintf("Skipping %s kit %s; set Kits to \"expand\" to post its components", vendor, iv.Sku))
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// leasor holds a time-limited lease shared between replicas.
+type leasor interface {
+	// acquire takes or renews the lease for ttl,
+	// reporting whether this replica now holds it.
+	acquire(ttl time.Duration) (bool, error)
+
+	// release gives up the lease if this replica holds it.
+	release() error
+}
+
+// leading is non-zero while this replica may perform runs;
+// without election configured it always may.
+var leading int32 = 1
+
+// isLeader reports whether this replica holds leadership.
+func isLeader() bool {
+	return atomic.LoadInt32(&leading) != 0
+}
+
+// identity names this replica in leases, the pod name under
+// Kubernetes (its hostname) plus the process id.
+func identity() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// newLeasor builds the configured lease backend, or nil
+// when election is off.
+func newLeasor() leasor {
+	switch cfg.Leader {
+	case "":
+		return nil
+	case "kubernetes":
+		l, err := newKubeLease(cfg.LeaseName)
+		if err != nil {
+			log.Fatalf("Unable to set up Kubernetes lease: %v", err)
+		}
+		return l
+	case "drive":
+		return &driveLock{folder: cfg.LockFolder, holder: identity()}
+	}
+	log.Fatalf("Unknown leader election backend %q", cfg.Leader)
+	return nil
+}
+
+// startElection makes a first attempt at the lease before
+// returning, then keeps taking or renewing it in the background.
+// The returned func stops election and releases the lease.
+func startElection(l leasor) func() {
+	ttl := cfg.LeaseDuration.Duration
+	renew := func() {
+		held, err := l.acquire(ttl)
+		if err != nil {
+			log.Printf("Unable to renew leader lease: %v", err)
+			held = false
+		}
+		was := atomic.SwapInt32(&leading, b2i(held))
+		if !held || was != b2i(held) {
+			markStandby(!held)
+		}
+		if was != b2i(held) {
+			if held {
+				echo("Acquired leadership")
+			} else {
+				echo("Lost leadership; standing by")
+			}
+		}
+	}
+	atomic.StoreInt32(&leading, 0)
+	renew()
+
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		renewT := time.NewTicker(ttl / 3)
+		defer renewT.Stop()
+		for {
+			select {
+			case <-quit:
+				if isLeader() {
+					if err := l.release(); err != nil {
+						log.Printf("Unable to release leader lease: %v", err)
+					}
+				}
+				return
+			case <-renewT.C:
+				renew()
+			}
+		}
+	}()
+
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// b2i converts a bool for atomic flags.
+func b2i(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// lockName is the Drive lock file replicas contend for;
+// it is never picked up as a vendor file.
+const lockName = "drive2sku.lock"
+
+// driveLock is a lease kept in a Drive file's appProperties.
+// Drive offers no compare-and-set, so after writing, a holder
+// waits and re-reads to confirm it won any concurrent write.
+// Replicas racing to create the file may each make one; the
+// earliest created, then lowest id, is the lock and the rest
+// are deleted by their makers.
+type driveLock struct {
+	folder string
+	holder string
+	id     string
+}
+
+// acquire takes the lock once it is free or expired,
+// or renews it while held.
+func (d *driveLock) acquire(ttl time.Duration) (bool, error) {
+	f, err := d.find()
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	props := map[string]string{
+		"holder":  d.holder,
+		"expires": now.Add(ttl).Format(time.RFC3339),
+	}
+
+	if f == nil {
+		f, err = drv.Files.Create(&drive.File{
+			Name:          lockName,
+			Parents:       []string{d.folder},
+			AppProperties: props,
+		}).Fields("id").Do()
+		if err != nil {
+			return false, err
+		}
+		return d.settle(f.Id)
+	}
+
+	d.id = f.Id
+	held := f.AppProperties["holder"] == d.holder
+	if !held {
+		exp, err := time.Parse(time.RFC3339, f.AppProperties["expires"])
+		if err == nil && now.Before(exp) && f.AppProperties["holder"] != "" {
+			return false, nil
+		}
+	}
+
+	if _, err := drv.Files.Update(d.id, &drive.File{AppProperties: props}).Do(); err != nil {
+		return false, err
+	}
+	if held {
+		return true, nil
+	}
+	return d.confirm()
+}
+
+// release expires the lock if this replica holds it.
+func (d *driveLock) release() error {
+	if d.id == "" {
+		return nil
+	}
+	_, err := drv.Files.Update(d.id, &drive.File{AppProperties: map[string]string{
+		"holder":  "",
+		"expires": time.Now().UTC().Format(time.RFC3339),
+	}}).Do()
+	return err
+}
+
+// settle waits out any replica creating a lock file at the
+// same time, then keeps the one created if it is the lock,
+// deleting it otherwise.
+func (d *driveLock) settle(id string) (bool, error) {
+	time.Sleep(3 * time.Second)
+	f, err := d.find()
+	if err != nil {
+		return false, err
+	}
+	if f == nil || f.Id != id {
+		if err := drv.Files.Delete(id).Do(); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	d.id = id
+	return d.confirm()
+}
+
+// find looks up the lock file, nil if it does not exist yet.
+func (d *driveLock) find() (*drive.File, error) {
+	q := fmt.Sprintf(`'%s' in parents and name = '%s' and trashed = false`, d.folder, lockName)
+	fl, err := drv.Files.List().Q(q).Fields("files(id,createdTime,appProperties)").Do()
+	if err != nil {
+		return nil, err
+	}
+	return firstLock(fl.Files), nil
+}
+
+// firstLock picks the lock among the lock files replicas
+// made: the earliest created, then the lowest id.
+func firstLock(fls []*drive.File) *drive.File {
+	var first *drive.File
+	for _, f := range fls {
+		// RFC 3339 timestamps in UTC sort lexically
+		if first == nil || f.CreatedTime < first.CreatedTime ||
+			f.CreatedTime == first.CreatedTime && f.Id < first.Id {
+			first = f
+		}
+	}
+	return first
+}
+
+// confirm waits out any racing writer, then checks
+// that the last write standing is this replica's.
+func (d *driveLock) confirm() (bool, error) {
+	time.Sleep(3 * time.Second)
+	f, err := drv.Files.Get(d.id).Fields("appProperties").Do()
+	if err != nil {
+		return false, err
+	}
+	return f.AppProperties["holder"] == d.holder, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestFirstLock(t *testing.T) {
+	if f := firstLock(nil); f != nil {
+		t.Errorf("no lock files gave %s", f.Id)
+	}
+	fls := []*drive.File{
+		{Id: "c", CreatedTime: "2026-01-02T10:00:01.000Z"},
+		{Id: "b", CreatedTime: "2026-01-02T10:00:00.500Z"},
+		{Id: "a", CreatedTime: "2026-01-02T10:00:00.500Z"},
+		{Id: "0", CreatedTime: "2026-01-02T10:00:02.000Z"},
+	}
+	for i := 0; i < len(fls); i++ {
+		// every listing order picks the same lock
+		rot := append(append([]*drive.File(nil), fls[i:]...), fls[:i]...)
+		if f := firstLock(rot); f.Id != "a" {
+			t.Errorf("order %d picked %s, want a", i, f.Id)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// saDir is where Kubernetes mounts the pod's service account.
+const saDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// kubeTime is the MicroTime layout used by Lease objects.
+const kubeTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// kubeLease holds a coordination.k8s.io/v1 Lease through the
+// in-cluster API, using resourceVersion for compare-and-set.
+type kubeLease struct {
+	url    string
+	token  string
+	holder string
+	client *http.Client
+}
+
+// lease is the subset of a Lease object this program uses.
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+	} `json:"spec"`
+}
+
+// newKubeLease reads the in-cluster service account
+// and API location for the named lease.
+func newKubeLease(name string) (*kubeLease, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a Kubernetes pod")
+	}
+	token, err := ioutil.ReadFile(saDir + "token")
+	if err != nil {
+		return nil, err
+	}
+	ns, err := ioutil.ReadFile(saDir + "namespace")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(saDir + "ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	return &kubeLease{
+		url: fmt.Sprintf("https://%s:%s/apis/coordination.k8s.io/v1/namespaces/%s/leases/",
+			host, port, strings.TrimSpace(string(ns))),
+		token:  strings.TrimSpace(string(token)),
+		holder: identity(),
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// acquire creates the lease, takes it over once expired,
+// or renews it while held; losing a write race is not an error.
+func (k *kubeLease) acquire(ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	l, found, err := k.get()
+	if err != nil {
+		return false, err
+	}
+
+	if found && l.Spec.HolderIdentity != k.holder && l.Spec.HolderIdentity != "" {
+		renewed, err := time.Parse(kubeTime, l.Spec.RenewTime)
+		expiry := renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second)
+		if err == nil && now.Before(expiry) {
+			return false, nil
+		}
+	}
+
+	if !found {
+		l.APIVersion = "coordination.k8s.io/v1"
+		l.Kind = "Lease"
+		l.Metadata.Name = cfg.LeaseName
+	}
+	if l.Spec.HolderIdentity != k.holder {
+		l.Spec.AcquireTime = now.Format(kubeTime)
+	}
+	l.Spec.HolderIdentity = k.holder
+	l.Spec.LeaseDurationSeconds = int(ttl / time.Second)
+	l.Spec.RenewTime = now.Format(kubeTime)
+
+	if found {
+		return k.write("PUT", k.url+cfg.LeaseName, l)
+	}
+	return k.write("POST", k.url, l)
+}
+
+// release clears the holder so another replica can take over
+// immediately rather than waiting out the lease.
+func (k *kubeLease) release() error {
+	l, found, err := k.get()
+	if err != nil || !found || l.Spec.HolderIdentity != k.holder {
+		return err
+	}
+	l.Spec.HolderIdentity = ""
+	_, err = k.write("PUT", k.url+cfg.LeaseName, l)
+	return err
+}
+
+// get fetches the lease, reporting whether it exists.
+func (k *kubeLease) get() (lease, bool, error) {
+	var l lease
+	res, err := k.do("GET", k.url+cfg.LeaseName, nil)
+	if err != nil {
+		return l, false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return l, true, json.NewDecoder(res.Body).Decode(&l)
+	case http.StatusNotFound:
+		return l, false, nil
+	}
+	return l, false, fmt.Errorf("lease lookup: %s", res.Status)
+}
+
+// write stores the lease; a conflict means another replica
+// changed it first, so this one does not hold it.
+func (k *kubeLease) write(method, url string, l lease) (bool, error) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+	res, err := k.do(method, url, b)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusConflict:
+		return false, nil
+	case res.StatusCode >= 300:
+		return false, fmt.Errorf("lease %s: %s", strings.ToLower(method), res.Status)
+	}
+	return true, nil
+}
+
+// do sends an authenticated request to the API server.
+func (k *kubeLease) do(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	req.Header.Set("Content-Type", "application/json")
+	return k.client.Do(req)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// shipper is a central log destination.
+type shipper interface {
+	// ship queues or sends one line at a severity, "INFO"
+	// for progress, "ERROR" for log output, and "DEBUG"
+	// for item samples.
+	ship(severity, msg string)
+
+	// flush delivers anything queued.
+	flush()
+}
+
+// shippers are the configured log destinations.
+var shippers []shipper
+
+// loggingOnce sets up log destinations once per process.
+var loggingOnce sync.Once
+
+// initLogging connects the configured destinations and, if
+// any exist, routes the standard logger through logWriter.
+func initLogging() {
+	loggingOnce.Do(func() {
+		if cfg.SentryDSN != "" {
+			initSentry(cfg.SentryDSN)
+		}
+		for _, name := range cfg.LogShipping {
+			switch name {
+			case "syslog":
+				s, err := newSyslogShipper(cfg.SyslogAddr)
+				if err != nil {
+					log.Fatalf("Unable to connect to syslog: %v", err)
+				}
+				shippers = append(shippers, s)
+			case "cloud":
+				s, err := newCloudShipper(cfg.CloudProject, cfg.CloudLog)
+				if err != nil {
+					log.Fatalf("Unable to set up Cloud Logging: %v", err)
+				}
+				shippers = append(shippers, s)
+			default:
+				log.Fatalf("Unknown log shipping backend %q", name)
+			}
+		}
+		if sentry != nil || len(shippers) > 0 {
+			log.SetOutput(logWriter{})
+		}
+	})
+}
+
+// shipLog sends a line to every configured destination.
+func shipLog(severity, msg string) {
+	for _, s := range shippers {
+		s.ship(severity, msg)
+	}
+}
+
+// logWriter passes log lines to stderr and on to the
+// configured destinations. It delivers synchronously so
+// log.Fatalf is recorded before the process exits.
+type logWriter struct{}
+
+// Write ships a log line as an error.
+func (logWriter) Write(p []byte) (int, error) {
+	n, err := os.Stderr.Write(p)
+
+	msg := strings.TrimSpace(string(p))
+	if log.Flags() == log.LstdFlags && len(msg) > len("2006/01/02 15:04:05 ") {
+		msg = msg[len("2006/01/02 15:04:05 "):]
+	}
+
+	shipLog("ERROR", msg)
+	for _, s := range shippers {
+		s.flush()
+	}
+
+	if sentry != nil {
+		// group by the message's fixed lead, not its details
+		group := msg
+		if i := strings.Index(msg, ":"); i > 0 {
+			group = msg[:i]
+		}
+		sentry.capture("error", msg, []string{group}, nil)
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+)
+
+// cloudShipper batches lines into Google Cloud Logging
+// through its entries:write REST call.
+type cloudShipper struct {
+	logName string
+	client  *http.Client
+
+	mu      sync.Mutex
+	entries []cloudEntry
+}
+
+// cloudEntry is one Cloud Logging LogEntry.
+type cloudEntry struct {
+	Severity    string            `json:"severity"`
+	TextPayload string            `json:"textPayload"`
+	Timestamp   string            `json:"timestamp"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// newCloudShipper authenticates with application default
+// credentials and flushes batches every few seconds.
+func newCloudShipper(project, name string) (*cloudShipper, error) {
+	if project == "" {
+		return nil, fmt.Errorf("CloudProject is not set")
+	}
+	client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/logging.write")
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = 10 * time.Second
+
+	s := &cloudShipper{
+		logName: fmt.Sprintf("projects/%s/logs/%s", project, name),
+		client:  client,
+	}
+	go func() {
+		for range time.Tick(5 * time.Second) {
+			s.flush()
+		}
+	}()
+	return s, nil
+}
+
+// ship queues one entry, labeled with the run and file.
+func (s *cloudShipper) ship(severity, msg string) {
+	runCtx.Lock()
+	labels := map[string]string{"run": runCtx.run, "file": runCtx.file}
+	runCtx.Unlock()
+
+	s.mu.Lock()
+	s.entries = append(s.entries, cloudEntry{
+		Severity:    severity,
+		TextPayload: msg,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Labels:      labels,
+	})
+	s.mu.Unlock()
+}
+
+// flush writes all queued entries; failures are dropped
+// since reporting them would only queue more lines.
+func (s *cloudShipper) flush() {
+	s.mu.Lock()
+	entries := s.entries
+	s.entries = nil
+	s.mu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"logName":  s.logName,
+		"resource": map[string]string{"type": "global"},
+		"entries":  entries,
+	})
+	if err != nil {
+		return
+	}
+	res, err := s.client.Post("https://logging.googleapis.com/v2/entries:write", "application/json", bytes.NewReader(b))
+	if err == nil {
+		res.Body.Close()
+	}
+}
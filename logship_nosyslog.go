@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "errors"
+
+// newSyslogShipper is unavailable where Go has no syslog.
+func newSyslogShipper(addr string) (shipper, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,43 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// syslogShipper writes to a local or remote syslog daemon.
+type syslogShipper struct {
+	w *syslog.Writer
+}
+
+// newSyslogShipper dials syslog; an empty address means the
+// local daemon, otherwise "udp://host:514" or "tcp://host:514".
+func newSyslogShipper(addr string) (*syslogShipper, error) {
+	network := ""
+	if i := strings.Index(addr, "://"); i >= 0 {
+		network, addr = addr[:i], addr[i+3:]
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, "drive2sku")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogShipper{w}, nil
+}
+
+// ship writes the line at the matching syslog priority.
+func (s *syslogShipper) ship(severity, msg string) {
+	switch severity {
+	case "ERROR":
+		s.w.Err(msg)
+	case "DEBUG":
+		s.w.Debug(msg)
+	default:
+		s.w.Info(msg)
+	}
+}
+
+// flush is a no-op; syslog writes are immediate.
+func (s *syslogShipper) flush() {}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"time"
 
-	"encoding/json"
-
 	"sync"
 
 	"golang.org/x/net/context"
@@ -22,6 +23,24 @@ type Item struct {
 	Quantity     int
 	Sku          string
 	WarehouseID  int
+
+	// LotNumber and ExpirationDate (yyyy-mm-dd) are set only
+	// for lot-tracked goods, which post to the lot endpoint.
+	LotNumber      string `json:",omitempty"`
+	ExpirationDate string `json:",omitempty"`
+
+	// origin is the file and row the item came from, and
+	// vendor whose it is, for attributing SKUVault's errors.
+	origin string
+	vendor string
+
+	// defaulted marks an item given one of its vendor's
+	// Defaults.
+	defaulted bool
+
+	// uom is the unit of measure the quantity is still in,
+	// blank once it is in eaches.
+	uom string
 }
 
 // Payload represents the final payload structure sent off
@@ -30,12 +49,108 @@ type Payload struct {
 	Items       []Item
 	TenantToken string
 	UserToken   string
+
+	// attempts counts the times it was resubmitted;
+	// vendor is whose items it holds, blank when mixed;
+	// batch finishes its files once answered; ctx ends
+	// at the files' timeout or on shutdown.
+	attempts int
+	vendor   string
+	batch    *batch
+	ctx      context.Context
+}
+
+// context is the payload's context, or the shutdown
+// context when it has none of its own.
+func (pl Payload) context() context.Context {
+	if pl.ctx == nil {
+		return shutdownCtx
+	}
+	return pl.ctx
 }
 
 // VendorSettings holds vendor-specific quantity settings.
 type VendorSettings struct {
 	WeekendBuffer int
 	WeekdayBuffer int
+
+	// Priority orders vendors within a file; higher
+	// priorities have their stock sent to SKUVault first.
+	// With FairShare it is also how many payloads the
+	// vendor sends in a row on its turn.
+	Priority int
+
+	// Mapping reads the vendor's own tabular format;
+	// nil means they send native vendor JSON files.
+	Mapping *Mapping `json:",omitempty"`
+
+	// PriceMapping reads the vendor's tabular price files
+	// from the price folder.
+	PriceMapping *PriceMapping `json:",omitempty"`
+
+	// Supplier is the vendor's supplier name in SKUVault when
+	// it differs; Folder is the vendor's own Drive folder,
+	// where its scorecards are uploaded.
+	Supplier string `json:",omitempty"`
+	Folder   string `json:",omitempty"`
+
+	// Contact is the vendor's email address for notices
+	// about rejected files.
+	Contact string `json:",omitempty"`
+
+	// MaxDownloads bounds concurrent downloads of files
+	// routed to this vendor by its mapping; 0 is unbounded
+	// beyond the global limit.
+	MaxDownloads int `json:",omitempty"`
+
+	// Endpoint is "single" to post the vendor's items one by
+	// one to setItemQuantity, or "bulk" for setItemQuantities;
+	// blank leaves it to the payload's size.
+	Endpoint string `json:",omitempty"`
+
+	// StaleAfter overrides the config's StaleAfter
+	// for this vendor; "0s" turns the check off.
+	StaleAfter *duration `json:",omitempty"`
+
+	// Disabled pauses the vendor without removing its profile:
+	// files its mapping claims stay pending, its items in other
+	// files are skipped, and it is left out of stale checks.
+	Disabled bool `json:",omitempty"`
+
+	// Contract holds back files that break what the vendor
+	// agreed to send; see Contract.
+	Contract *Contract `json:",omitempty"`
+
+	// LocationTemplate derives the LocationCode of items sent
+	// without one, as a Go template over the item's Vendor,
+	// Sku, Warehouse, Quantity, LotNumber, and ExpirationDate,
+	// e.g. "{{.Warehouse}}-OVERSTOCK".
+	LocationTemplate string `json:",omitempty"`
+
+	// Defaults fill in fields the vendor's feed omits, ahead
+	// of LocationTemplate; the run report counts the items
+	// that relied on them.
+	Defaults *ItemDefaults `json:",omitempty"`
+
+	// Rules transform or skip the vendor's items; see rules.go.
+	Rules []string `json:",omitempty"`
+
+	// Transform converts the vendor's files with an outside
+	// command or service instead of a Mapping.
+	Transform *Transform `json:",omitempty"`
+
+	// Units are how many eaches each unit of measure holds,
+	// by SKU, with "*" covering SKUs not listed, e.g.
+	// {"*": {"CS": 12}, "A1": {"CS": 6, "PLT": 240}}.
+	Units map[string]map[string]int `json:",omitempty"`
+
+	// Split fans each of the vendor's items out over several
+	// warehouses, e.g. 70% to one and 30% to another.
+	Split []Allocation `json:",omitempty"`
+
+	// Drop groups the vendor's files that must be posted
+	// together; see DropGroup.
+	Drop *DropGroup `json:",omitempty"`
 }
 
 // ErrorBody matches the structure of
@@ -51,8 +166,9 @@ type ErrorBody struct {
 // ResponseBody matches the structure of
 // the SKUVault general response body.
 type ResponseBody struct {
-	Status string
-	Errors []ErrorBody
+	Status   string
+	Errors   []ErrorBody
+	Warnings []string `json:",omitempty"`
 }
 
 const (
@@ -60,6 +176,9 @@ const (
 	// ten 100-object payloads every minute
 	// every 6300 milliseconds, a post is made
 	throttle = 6300
+
+	// pendingFolder is the Drive id of the Pending Vendors folder
+	pendingFolder = "0BzaYO4E7QW9VNG5GejI1LUExaGM"
 )
 
 var (
@@ -67,28 +186,25 @@ var (
 	// it references the account after connecting
 	drv *drive.Service
 
-	// toks is the SKUVault connection tokens and client
-	// it allows use of tenant and user tokens for POST calls
-	toks *SkuTokens
-
 	// endCh signifies the end of the program
 	// it is done processing everything once the last
 	// value is passed through it
 	endCh chan bool
 
-	// plBufCh holds a maximum of 10 payloads stored concurrently
+	// plBufCh holds a maximum of 10 full payloads
+	// stored concurrently
 	plBufCh chan Payload
 
-	// lastPlCh holds the file's last payload (for deletion)
+	// lastPlCh hands over each file's last, partial payload
+	// and retries unbuffered, read whenever plBufCh runs dry
 	lastPlCh chan Payload
 
 	// wg is a wait group that acts like an atomic reference
 	// counter but for goroutines and waits for them to all finish
 	wg sync.WaitGroup
 
-	// delFCh is a file channel that holds a potential
-	// file eventually to be deleted
-	delFCh chan drive.File
+	// postSem holds a slot for each SKUVault post in flight
+	postSem chan struct{}
 
 	// settings is a mapping of a vendor name to its respective
 	// quantity buffer settings for weekends and weekdays.
@@ -103,40 +219,171 @@ var (
 // of the server program so it runs on schedule
 // in a smart and practical manner.
 func main() {
+	flag.Parse()
+	if *probe {
+		runProbe()
+	}
+	if flag.NArg() > 0 {
+		runCommand(flag.Arg(0), flag.Args()[1:])
+		return
+	}
+	if api := os.Getenv("AWS_LAMBDA_RUNTIME_API"); api != "" {
+		runLambda(api)
+		return
+	}
+
 	defer timeTrack(time.Now())
+	handlePauseSignals()
+	handleShutdown()
+	readConfig()
 	initDriveAndVault()
-	initChannels()
 	readBufferSettings()
+	syncDrive()
+}
+
+// syncDrive performs one complete relay of the pending
+// vendors folder out to SKUVault, returning once every
+// payload has been written and every file handled,
+// then does the same for the price folder, if any.
+func syncDrive() {
+	relay(readDrive)
+	if cfg.PriceFolder != "" && !readOnlySkip("syncing prices") {
+		syncPrices()
+	}
+}
+
+// relay runs the payload machinery around a producer,
+// which must release the wait group once it has finished
+// queueing payloads and files for deletion.
+func relay(produce func()) {
+	initChannels()
+	summary = newSummary()
+
+	runCtx.Lock()
+	runCtx.run = summary.Start.Format("20060102-150405")
+	runCtx.Unlock()
+	if *readOnly {
+		say("Read-only run: nothing will be posted to SKUVault or changed in Drive")
+	}
+	defer startRunContext()()
+	resetChanges()
+	fair = nil
+	if cfg.FairShare {
+		fair = newFairQueue()
+		go fair.feed()
+		defer fair.close()
+	}
+	st := runStatus{Started: summary.Start}
+	markRun(st)
+	rotateTokens()
+	loadWarehouses()
+	if cfg.PreValidate || cfg.Kits != "" {
+		loadCatalog()
+	}
 
 	wg.Add(1)
-	go readDrive()
+	go produce()
 
 	// wait for everyone to finish their jobs
 	go proctor()
 
 	// 10 payloads every minute to SKUVault
-	throttleCh := time.Tick(throttle * time.Millisecond)
+	throttleT := time.NewTicker(throttleInterval())
+	defer throttleT.Stop()
+	progressT := time.NewTicker(progressEvery())
+	defer progressT.Stop()
 	for {
 		select {
-		case <-throttleCh:
-			if len(plBufCh) > 0 {
-				go writeVault(<-plBufCh)
-			} else {
-				go writeVault(<-lastPlCh)
+		case <-progressT.C:
+			reportProgress()
+		case <-throttleT.C:
+			heartbeat()
+			if stopping() {
+				dropQueued()
+				continue
 			}
+			if isPaused() {
+				continue
+			}
+			dispatch()
 		case <-endCh:
-			echo("Finished relaying vendor JSONs")
+			if useBar() {
+				reportProgress()
+				fmt.Println()
+			}
+			summary.finish()
+			st.Finished = summary.End
+			markRun(st)
+			rec := summary.record(runCtx.run)
+			saveRun(rec)
+			saveInventory()
+			saveTrends()
+			say("Finished relaying vendor JSONs")
+			summary.print()
+			reportQuarantine()
+			evaluateAlerts(runMetrics(rec), false)
 			return
 		}
 	}
 }
 
+// dispatch starts up to PostsPerTick payload posts within
+// the post limit, taking full payloads from the buffer first
+// and otherwise a last payload or retry already waiting.
+// It never waits itself, so the run can end between ticks.
+func dispatch() {
+	for k := 0; k < postsPerTick(); k++ {
+		// skip the rest of this tick if the post limit is reached
+		select {
+		case postSem <- struct{}{}:
+		default:
+			return
+		}
+		var pl Payload
+		select {
+		case pl = <-plBufCh:
+		default:
+			select {
+			case pl = <-plBufCh:
+			case pl = <-lastPlCh:
+			default:
+				<-postSem
+				return
+			}
+		}
+		go writeVault(pl)
+	}
+}
+
+// dropQueued gives up on every payload waiting to be
+// written, as happens on shutdown.
+func dropQueued() {
+	if fair != nil {
+		for _, pl := range fair.drain() {
+			pl.batch.done(false)
+			wg.Done()
+		}
+	}
+	for {
+		var pl Payload
+		select {
+		case pl = <-plBufCh:
+		case pl = <-lastPlCh:
+		default:
+			return
+		}
+		pl.batch.done(false)
+		wg.Done()
+	}
+}
+
 // initChannels initializes all channels for the package.
 func initChannels() {
 	endCh = make(chan bool)
 	plBufCh = make(chan Payload, 10)
 	lastPlCh = make(chan Payload)
-	delFCh = make(chan drive.File)
+
+	postSem = make(chan struct{}, limit(cfg.MaxPosts))
 }
 
 // readBufferSettings pulls in vendor-specific quantity buffer
@@ -147,6 +394,19 @@ func readBufferSettings() {
 	if err != nil {
 		log.Fatalf("Unable to read vendor buffer settings: %v", err)
 	}
+	for vendor, vs := range settings {
+		switch vs.Endpoint {
+		case "", "single", "bulk":
+		default:
+			log.Fatalf("Unknown %s Endpoint %q; use \"single\" or \"bulk\"", vendor, vs.Endpoint)
+		}
+	}
+	validateContracts()
+	parseLocationTemplates()
+	compileRules()
+	validateTransforms()
+	validateSplits()
+	validateDrops()
 }
 
 // proctor is a blocking check to see when
@@ -160,20 +420,33 @@ func proctor() {
 // init creates an instance of the engine's collective data
 // it sets up the dialog between this server and the drive folder.
 func initDriveAndVault() {
-	b, err := ioutil.ReadFile("client_secret.json")
+	b, err := readSecret("client_secret.json")
 	if err != nil {
 		log.Fatalf("Unable to read client secret file: %v", err)
 	}
 
 	// If modifying these scopes, delete your previously saved credentials
 	// at ~/.credentials/drive-go-quickstart.json
-	config, err := google.ConfigFromJSON(b, drive.DriveScope)
+	config, err := google.ConfigFromJSON(b, driveScope())
 	if err != nil {
 		log.Fatalf("Unable to parse client secret file to config: %v", err)
 	}
 
 	// obtain our Google Drive and SKUVault handles
+	var toks *SkuTokens
 	drv, toks = getClientAndSkuTokens(context.Background(), config)
+	setTokens(toks)
+	initAccounts()
+}
+
+// pendingQuery finds all Pending Vendor parent id files,
+// and approved ones, not in the trash.
+func pendingQuery() string {
+	in := fmt.Sprintf(`'%s' in parents`, pendingFolder)
+	if cfg.ApprovedFolder != "" {
+		in = fmt.Sprintf(`(%s or '%s' in parents)`, in, cfg.ApprovedFolder)
+	}
+	return fmt.Sprintf(`%s and trashed = false and name != '%s'`, in, lockName)
 }
 
 // readPendingVendors actually reads the drive account's
@@ -182,117 +455,290 @@ func initDriveAndVault() {
 func readDrive() {
 	defer wg.Done()
 
-	// all Pending Vendor parent id files not in the trash
-	fls, err := drv.Files.List().Q(`'0BzaYO4E7QW9VNG5GejI1LUExaGM' in parents and trashed = false`).Do()
-	if err == nil {
-		// store the count of files to be processed
-		n := len(fls.Files)
-		if n > 0 {
-			for _, f := range fls.Files {
-				echo(fmt.Sprintf("Processing %s (%s)", f.Name, f.Id))
-
-				// one file at a time
-				/*wg.Add(1) // this in unsafe at the moment; file deletion relies on sequence
-				go*/chunkToPayloads(*f)
-			}
-		} else {
-			fmt.Println("No files found.")
+	fls, err := listPending(drv, pendingQuery())
+	if accessLost(err) {
+		driveLost(err)
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to list pending files: %v", explainDrive(err))
+		return
+	}
+	driveRestored()
+	processFiles(skipDisabled(append(fls, accountFiles()...)))
+}
+
+// processFiles downloads and verifies the given pending
+// files, claims those that decoded, and chunks each of them
+// into payloads. Files that fail to decode are never claimed.
+// Later files download while earlier ones post, except when
+// merging, which needs every file first. Vendor drops go
+// first, each as a set, then files by vendor priority.
+func processFiles(fls []*drive.File) {
+	if len(fls) == 0 {
+		fmt.Println("No files found.")
+		return
+	}
+	if fls = feedFiles(fls); len(fls) == 0 {
+		return
+	}
+	if fileNames != nil {
+		fls = conventionalFiles(fls)
+		byModified(fls)
+	}
+	if fls = processDrops(fls); len(fls) == 0 {
+		return
+	}
+	if cfg.MergeFiles {
+		byModified(fls)
+		files, fetches := claimFiles(fls, fetchFeeds(fls))
+		if len(files) > 1 {
+			mergeFiles(files, fetches)
+		} else if len(files) == 1 {
+			summary.expect(1, feedItems(fetches[0].vsd))
+			processFile(files[0], fetches[0])
+		}
+		return
+	}
+
+	byPriority(fls)
+	fetches, ready := fetchAsync(fls, true)
+	c := newClaimer(fls, fetches, ready)
+	var laneWg sync.WaitGroup
+	for _, idx := range lanes(fls) {
+		laneWg.Add(1)
+		go func(idx []int) {
+			defer laneWg.Done()
+			processLane(c, fetches, idx)
+		}(idx)
+	}
+	laneWg.Wait()
+
+	// downloads past the deadline or shutdown are cut short
+	for i, r := range ready {
+		<-r
+		releaseItems(&fetches[i])
+	}
+}
+
+// processLane processes the files at the given indexes one
+// after another, as each is claimed.
+func processLane(c *claimer, fetches []fetched, idx []int) {
+	for n, i := range idx {
+		if stopping() {
+			spillOver(c.pending(idx[n:]), "Shutting down")
+			return
 		}
+		if pastRunDeadline() {
+			spillOver(c.pending(idx[n:]), "Run deadline reached")
+			return
+		}
+		if !c.mine(i) {
+			releaseItems(&fetches[i])
+			continue
+		}
+		f := c.fls[i]
+		if err := restoreItems(*f, &fetches[i]); err != nil {
+			fetches[i].err = fmt.Errorf("unable to read back from the spool: %v", err)
+		}
+		summary.expect(1, feedItems(fetches[i].vsd))
+
+		processFile(f, fetches[i])
+		releaseItems(&fetches[i])
 	}
 }
 
-// chunkToPayloads downloads a file
-// fitting it into 100-chuck payloads.
-func chunkToPayloads(f drive.File) {
-	// defer wg.Done()
+// processFile checks a fetched file, failing or setting
+// it aside as needed, and otherwise queues its payloads.
+func processFile(f *drive.File, fe fetched) {
+	echo(fmt.Sprintf("Processing %s (%s)", f.Name, f.Id))
+	setRunFile(f.Name)
+	if fe.interrupted {
+		summary.fileDone()
+		return
+	}
+	if fe.err != nil {
+		failFile(*f, fe.err)
+		if vendor, ok := fileVendor(f.Name); ok {
+			notifyVendor(vendor, *f, fe.err.Error(), nil)
+		}
+		summary.fileDone()
+		return
+	}
+	if !admitFile(*f, fe.vsd) {
+		summary.fileDone()
+		return
+	}
+	sendPayloads(fe.vsd, fe.deadline, *f)
+}
 
-	t := time.Now()
+// admitFile puts a decoded file through the checks every
+// file passes before it is posted: rejection, screening,
+// confirmation, and deduplication. A file held back is set
+// aside, left pending, or deleted as each check decides.
+func admitFile(f drive.File, vsd map[string]map[string]Item) bool {
+	if rejectFile(f, vsd) || !screenFile(f, vsd) {
+		return false
+	}
+	if !confirmPost(f.Name, feedItems(vsd)) {
+		unstage(f)
+		say(fmt.Sprintf("Leaving %s pending", f.Name))
+		return false
+	}
+	if duplicateFile(f) {
+		deleteFile(f)
+		return false
+	}
+	return true
+}
 
+// downloadFile downloads the whole of a Drive file.
+func downloadFile(ctx context.Context, f drive.File) ([]byte, error) {
 	// grabs http request for one of the json files
-	res, err := drv.Files.Get(f.Id).Download()
+	res, err := driveFor(f.Id).Files.Get(f.Id).Context(ctx).Download()
 	if err != nil {
-		log.Fatalf("Unable to download file: %v", err)
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	plCap := 100
+	return ioutil.ReadAll(limitDownload(ctx, res.Body))
+}
 
-	// 100-item capacity payload
-	pl := Payload{make([]Item, 0, plCap), toks.TenantToken, toks.UserToken}
+// sendPayloads fits decoded vendor items into payloads of
+// up to 100 items and MaxPayloadBytes, then forwards the
+// source files for deletion. The payloads' posts are cut
+// short at the deadline, if any, or on shutdown.
+func sendPayloads(vsd map[string]map[string]Item, deadline time.Time, fs ...drive.File) {
+	toks := currentTokens()
+	t := time.Now()
 
-	i := 0
-	// the entire JSON file structure
-	vsd := map[string]map[string]Item{}
-	json.NewDecoder(res.Body).Decode(&vsd)
-	for vendor, v := range vsd {
+	ctx, cancel := context.WithCancel(shutdownCtx)
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(shutdownCtx, deadline)
+	}
+
+	// full payloads go through the buffer; the file's last,
+	// partial one is handed over once everything else is
+	b := newBatch(fs, cancel)
+	if anomalyChecked() {
+		b.vsd = vsd
+	}
+	c := newChunker(Payload{TenantToken: toks.TenantToken, UserToken: toks.UserToken, batch: b, ctx: ctx})
+	queued := true
+vendors:
+	for _, vendor := range vendorOrder(vsd) {
+		v := vsd[vendor]
+		if settings[vendor].Disabled {
+			echoAt(levelVerbose, fmt.Sprintf("Skipping %d %s items; vendor is disabled", len(v), vendor))
+			continue
+		}
+		defaulted := 0
 		for _, iv := range v {
-			i++
-			// this is one payload item
-			// i is the cursor
-
-			switch t.Weekday() {
-			case time.Friday:
-				fallthrough
-			case time.Saturday:
-				fallthrough
-			case time.Sunday:
-				if iv.Quantity <= settings[vendor].WeekendBuffer {
-					iv.Quantity = 0
-				}
-			default:
-				if iv.Quantity <= settings[vendor].WeekdayBuffer {
-					iv.Quantity = 0
-				}
+			if iv.defaulted {
+				defaulted++
 			}
-
-			// payload is full
-			if len(pl.Items) == cap(pl.Items) {
-				// forward payload into buffered channel
-				wg.Add(1)
-				// this is the last one
-				if i == len(v) {
-					plBufCh <- pl
-				} else {
-					lastPlCh <- pl
+			iv = applyBuffer(vendor, iv, t)
+			for _, iv := range screenItem(vendor, fs, iv) {
+				if full, ok := c.add(vendor, iv); ok {
+					if queued = queuePayload(plBufCh, full); !queued {
+						break vendors
+					}
 				}
-				// reset payload
-				pl = Payload{make([]Item, 0, plCap), pl.TenantToken, pl.UserToken}
+				echoItem(vendor, iv)
 			}
-
-			// add item to payload
-			pl.Items = append(pl.Items, iv)
-
-			// fmt.Printf("\t\t\"LocationCode\":\"%s\"\n", iv.LocationCode)
-			// fmt.Printf("\t\t\"Quantity\":%d\n", iv.Quantity)
-			// fmt.Printf("\t\t\"Sku\":\"%s\"\n", iv.Sku)
-			// fmt.Printf("\t\t\"WarehouseId\":\"%d\"\n", iv.WarehouseID)
 		}
+		echoAt(levelVerbose, fmt.Sprintf("Queued %d %s items", len(v), vendor))
+		summary.vendorQueued(vendor, len(v), fs)
+		summary.vendorDefaulted(vendor, defaulted)
+	}
+	if last, ok := c.rest(); ok && queued {
+		queuePayload(lastPlCh, last)
+	}
 
-		// payload is partially full
-		if len(pl.Items) != 0 {
-			// forward payload into buffered channel
-			wg.Add(1)
-			lastPlCh <- pl
-		}
+	for range fs {
+		summary.fileDone()
+	}
+	if stopping() {
+		b.fail(errors.New("interrupted by shutdown"))
+	} else if ctx.Err() != nil {
+		b.fail(fmt.Errorf("timed out after %v", cfg.FileTimeout.Duration))
 	}
 
-	// the file is finished chunking into payloads;
-	// send it forward for deletion
-	delFCh <- f
+	// the files are finished chunking into payloads; they are
+	// deleted once SKUVault has answered for all of them
+	b.seal()
+}
 
-	// fmt.Printf("Tenant:%s User:%s\n", toks.TenantToken, toks.UserToken)
-	// fmt.Println(`[[[ Chunk to payloads: END ]]]`)
+// queuePayload forwards a payload for writing unless its
+// context ends first, reporting whether it was queued.
+func queuePayload(ch chan Payload, pl Payload) bool {
+	pl.batch.add()
+	wg.Add(1)
+	if fair != nil {
+		if fair.push(pl) {
+			return true
+		}
+		pl.batch.done(false)
+		wg.Done()
+		return false
+	}
+	select {
+	case ch <- pl:
+		return true
+	case <-pl.context().Done():
+		pl.batch.done(false)
+		wg.Done()
+		return false
+	}
 }
 
 // deleteFile takes in a drive file
 // and actually deletes it from the
 // Drive account.
 func deleteFile(f drive.File) {
+	unstage(f)
+	if replaying {
+		return
+	}
+	if readOnlySkip(fmt.Sprintf("removing %s from Drive", f.Name)) {
+		return
+	}
+	if cfg.ProcessedFolder != "" {
+		archiveFile(f)
+		return
+	}
+
+	if !confirmOp(fmt.Sprintf(`Delete file "%s" (%s) from Drive?`, f.Name, f.Id)) {
+		say(fmt.Sprintf("Leaving %s pending", f.Name))
+		return
+	}
 	echo(fmt.Sprintf(`Deleting file "%s" (%s)`, f.Name, f.Id))
 
-	err := drv.Files.Delete(f.Id).Do()
+	err := driveFor(f.Id).Files.Delete(f.Id).Do()
+	if accessLost(err) {
+		fileLost(f, "delete", err)
+		return
+	}
+	if err != nil {
+		log.Fatalf("Unable to delete file: %v", explainDrive(err))
+	}
+}
+
+// archiveFile moves a finished file out of the pending
+// folder and into the processed folder.
+func archiveFile(f drive.File) {
+	if readOnlySkip(fmt.Sprintf("archiving %s", f.Name)) {
+		return
+	}
+	echo(fmt.Sprintf(`Archiving file "%s" (%s)`, f.Name, f.Id))
+
+	_, err := driveFor(f.Id).Files.Update(f.Id, &drive.File{}).AddParents(cfg.ProcessedFolder).RemoveParents(parentsOf(f)).Do()
+	if accessLost(err) {
+		fileLost(f, "archive", err)
+		return
+	}
 	if err != nil {
-		log.Fatalf("Unable to delete file: %v", err)
+		log.Fatalf("Unable to archive file: %v", explainDrive(err))
 	}
 }
 
@@ -300,37 +746,56 @@ func deleteFile(f drive.File) {
 // to SKUVault via its REST api.
 func writeVault(pl Payload) {
 	defer wg.Done()
+	defer func() { <-postSem }()
 
-	res, err := vaultRequest(`inventory/setItemQuantities`, struct2JSON(pl))
-	if err != nil {
-		log.Fatalf(`Unable to set item quantities in SKUVault: %v`, err)
-
-		// plug back
-		plBufCh <- pl
+	if readOnlySkip(fmt.Sprintf("uploading payload (%d/%d)", len(pl.Items), cap(pl.Items))) {
+		pl.batch.done(true)
+		return
 	}
-	defer res.Body.Close()
 
-	var errExt string
-	if res.StatusCode < 400 {
-		errExt = ""
-	} else {
-		errExt = fmt.Sprintf("; %s", responseStatus(res))
+	start := time.Now()
+	res, body, sent, err := postPayload(pl)
+	if transient(res, body, err) && pl.context().Err() == nil {
+		// only the items SKUVault has not answered for go again
+		if sent > 0 {
+			pl = settlePart(pl, sent, time.Since(start), body.Errors)
+			body.Errors = nil
+		}
+		if retryPayload(pl, res, err) {
+			return
+		}
 	}
+	summary.recordPost(time.Since(start), len(pl.Items), err == nil && res.StatusCode < 400)
 
-	echo(fmt.Sprintf(`Uploaded payload (%d/%d)%s`, len(pl.Items), cap(pl.Items), errExt))
+	if err != nil {
+		log.Printf(`Unable to set item quantities in SKUVault: %v`, err)
+		summary.recordError(fmt.Sprintf("gave up on %d items: %v", len(pl.Items), err))
+		pl.batch.done(false)
+		return
+	}
 
-	// attempt to delete a file if finished
-	// chunking into payloads;
-	// since we are dealing with one file at a time
-	// it is implied that after a payload write it
-	// is safe to delete said file since it is clearly
-	// sent out. The payloads back to back are not
-	// different files
-	select {
-	case f := <-delFCh: // delete if ready
-		deleteFile(f)
-	default: // ignore if not ready
+	a := readAnswer(pl, res, body)
+	summary.recordAnswer(a)
+	for _, w := range a.Warnings {
+		say(fmt.Sprintf("SKUVault warning [request %s]: %s", a.RequestID, w))
+	}
+	if a.Code < 400 {
+		echo(fmt.Sprintf(`Uploaded payload (%d/%d): %s`, len(pl.Items), cap(pl.Items), a.Status))
+		summary.recordSent(pl, a.Errors)
+	} else {
+		reportItemErrors(a.Code, responseStatus(body), map[string]interface{}{
+			"items":      a.Items,
+			"status":     a.Status,
+			"request_id": a.RequestID,
+		})
+		if len(a.Errors) == 0 {
+			summary.recordError(fmt.Sprintf("%d: %s", a.Code, a.Status))
+		}
+		say(fmt.Sprintf(`Uploaded payload (%d/%d); %s with %d item errors [request %s]`, len(pl.Items), cap(pl.Items),
+			a.key(), len(a.Errors), a.RequestID))
 	}
+	reportRejects(pl, a.Code, a.Errors)
+	pl.batch.done(a.Code < 400)
 }
 func test() {
 
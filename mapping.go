@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mapping describes how a vendor's tabular feed (CSV, XLSX,
+// or a JSON array of flat objects) lines up with Item fields.
+// Each field names the source column to read it from.
+type Mapping struct {
+	// Match is a filename glob, e.g. "acme_*.csv",
+	// that routes a file to this vendor's mapping.
+	Match string
+
+	Sku          string
+	Quantity     string
+	LocationCode string `json:",omitempty"`
+	WarehouseID  string `json:",omitempty"`
+
+	// LotNumber and ExpirationDate are read only for
+	// vendors shipping lot-tracked goods.
+	LotNumber      string `json:",omitempty"`
+	ExpirationDate string `json:",omitempty"`
+
+	// UOM is the column giving each row's unit of measure,
+	// e.g. EA, CS, or PLT; quantities are converted to eaches
+	// with the vendor's Units.
+	UOM string `json:",omitempty"`
+
+	// Columns records every column seen in the sample
+	// and its inferred type; it is informational only.
+	Columns map[string]string `json:",omitempty"`
+}
+
+// vendorMapping finds the vendor whose mapping claims
+// the given file name, or the one named with run -vendor or
+// in the name under the naming convention.
+func vendorMapping(name string) (string, *Mapping, bool) {
+	if localVendor != "" {
+		if m := settings[localVendor].Mapping; m != nil {
+			return localVendor, m, true
+		}
+		return "", nil, false
+	}
+	base := filepath.Base(name)
+	for vendor, vs := range settings {
+		if vs.Mapping == nil || vs.Mapping.Match == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(vs.Mapping.Match, base); ok {
+			return vendor, vs.Mapping, true
+		}
+	}
+	if vendor, ok := nameVendor(name); ok && settings[vendor].Mapping != nil {
+		return vendor, settings[vendor].Mapping, true
+	}
+	return "", nil, false
+}
+
+// applyMapping converts header-led rows into items keyed
+// the same way a native vendor JSON file keys them.
+func applyMapping(m *Mapping, rows [][]string) (map[string]Item, error) {
+	if len(rows) == 0 {
+		return map[string]Item{}, nil
+	}
+
+	col := headerIndex(rows[0])
+	skuI, err := col(m.Sku)
+	if err != nil {
+		return nil, err
+	}
+	if skuI < 0 {
+		return nil, fmt.Errorf("mapping has no Sku column")
+	}
+	qtyI, err := col(m.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	if qtyI < 0 {
+		return nil, fmt.Errorf("mapping has no Quantity column")
+	}
+	locI, err := col(m.LocationCode)
+	if err != nil {
+		return nil, err
+	}
+	whI, err := col(m.WarehouseID)
+	if err != nil {
+		return nil, err
+	}
+	lotI, err := col(m.LotNumber)
+	if err != nil {
+		return nil, err
+	}
+	expI, err := col(m.ExpirationDate)
+	if err != nil {
+		return nil, err
+	}
+	uomI, err := col(m.UOM)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]Item, len(rows)-1)
+	for n, row := range rows[1:] {
+		iv := Item{Sku: cell(row, skuI), LocationCode: cell(row, locI), LotNumber: cell(row, lotI)}
+		if iv.Quantity, err = atoiLoose(cell(row, qtyI)); err != nil {
+			return nil, fmt.Errorf("row %d: Quantity: %v", n+2, err)
+		}
+		if iv.WarehouseID, err = atoiLoose(cell(row, whI)); err != nil {
+			return nil, fmt.Errorf("row %d: WarehouseID: %v", n+2, err)
+		}
+		if iv.ExpirationDate, err = parseDate(cell(row, expI)); err != nil {
+			return nil, fmt.Errorf("row %d: ExpirationDate: %v", n+2, err)
+		}
+		if uomI >= 0 {
+			iv.uom = normalUnit(cell(row, uomI))
+		}
+		items[fmt.Sprintf("%d", n+2)] = iv
+	}
+	return items, nil
+}
+
+// headerIndex gives a lookup of column positions by name
+// from a header row; an unset name is -1, a missing one an error.
+func headerIndex(header []string) func(name string) (int, error) {
+	idx := map[string]int{}
+	for i, col := range header {
+		idx[strings.TrimSpace(col)] = i
+	}
+	return func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := idx[name]
+		if !ok {
+			return -1, fmt.Errorf("column %q not found", name)
+		}
+		return i, nil
+	}
+}
+
+// cell gives a row's trimmed value at a column position,
+// blank when the column is unset or the row is short.
+func cell(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// dateLayouts are the date formats vendors export.
+var dateLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06", time.RFC3339}
+
+// parseDate normalizes a vendor date, including an Excel
+// serial day number, to yyyy-mm-dd; blank stays blank.
+func parseDate(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		excelEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		return excelEpoch.AddDate(0, 0, int(f)).Format("2006-01-02"), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized date %q", s)
+}
+
+// atoiLoose parses whole numbers as vendors tend to export
+// them, tolerating blanks and trailing ".0" decimals.
+func atoiLoose(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int(f), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// byModified orders files oldest to newest, by the date
+// in their names under the naming convention first.
+func byModified(fls []*drive.File) {
+	sort.SliceStable(fls, func(i, j int) bool {
+		if ti, tj := fileTime(*fls[i]), fileTime(*fls[j]); !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		// RFC 3339 timestamps in UTC sort lexically
+		return fls[i].ModifiedTime < fls[j].ModifiedTime
+	})
+}
+
+// mergeFiles sends every fetched file as one deduplicated run.
+// Files, given oldest to newest, are overlaid in that order,
+// so the latest modified file wins for each SKU and location.
+func mergeFiles(fls []*drive.File, fetches []fetched) {
+	merged, fs, deadline, dupes := overlayFiles(fls, fetches)
+	if len(fs) == 0 {
+		return
+	}
+	echo(fmt.Sprintf("Merged %d files, %d stale items dropped", len(fs), dupes))
+	summary.expect(len(fs), feedItems(merged))
+	sendPayloads(merged, deadline, fs...)
+}
+
+// overlayFiles overlays the fetched files that pass the
+// checks every file does alone, giving the merged items,
+// the files they came from, the earliest deadline, and how
+// many items a later file replaced. A file held back or
+// rejected is left out of the merge.
+func overlayFiles(fls []*drive.File, fetches []fetched) (map[string]map[string]Item, []drive.File, time.Time, int) {
+	merged := map[string]map[string]Item{}
+	fs := make([]drive.File, 0, len(fls))
+	dupes := 0
+	var deadline time.Time
+	for i, f := range fls {
+		echo(fmt.Sprintf("Merging %s (%s)", f.Name, f.Id))
+		setRunFile(f.Name)
+		if fetches[i].interrupted {
+			continue
+		}
+		if fetches[i].err != nil {
+			failFile(*f, fetches[i].err)
+			continue
+		}
+		if !admitFile(*f, fetches[i].vsd) {
+			continue
+		}
+		if deadline.IsZero() || fetches[i].deadline.Before(deadline) {
+			deadline = fetches[i].deadline
+		}
+		for vendor, v := range fetches[i].vsd {
+			if merged[vendor] == nil {
+				merged[vendor] = map[string]Item{}
+			}
+			for _, iv := range v {
+				k := keyOf(vendor, iv).String()
+				if _, ok := merged[vendor][k]; ok {
+					dupes++
+				}
+				merged[vendor][k] = iv
+			}
+		}
+		fs = append(fs, *f)
+	}
+	return merged, fs, deadline, dupes
+}
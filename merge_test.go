@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// mergeSetup gives the merge tests a state directory,
+// summary, and vendor settings of their own, with no Drive folders to
+// move held or failed files to.
+func mergeSetup(t *testing.T, vs map[string]VendorSettings) {
+	oldCfg, oldSettings, oldChanges, oldSummary := cfg, settings, changes, summary
+	t.Cleanup(func() { cfg, settings, changes, summary = oldCfg, oldSettings, oldChanges, oldSummary })
+	cfg = Config{StateDir: t.TempDir()}
+	settings = vs
+	changes = nil
+	summary = newSummary()
+}
+
+// mergeFile makes a fetched file holding one vendor's items.
+func mergeFile(name, vendor string, items ...Item) (*drive.File, fetched) {
+	v := map[string]Item{}
+	for _, iv := range items {
+		v[iv.Sku] = iv
+	}
+	return &drive.File{Id: name, Name: name}, fetched{vsd: map[string]map[string]Item{vendor: v}}
+}
+
+// overlay overlays the files given as name and fetch pairs,
+// giving the names of those merged.
+func overlay(files ...interface{}) (map[string]map[string]Item, []string) {
+	var fls []*drive.File
+	var fetches []fetched
+	for i := 0; i < len(files); i += 2 {
+		fls = append(fls, files[i].(*drive.File))
+		fetches = append(fetches, files[i+1].(fetched))
+	}
+	merged, fs, _, _ := overlayFiles(fls, fetches)
+	names := make([]string, len(fs))
+	for i, f := range fs {
+		names[i] = f.Name
+	}
+	return merged, names
+}
+
+func TestOverlayFilesChangeCap(t *testing.T) {
+	mergeSetup(t, map[string]VendorSettings{"acme": {}})
+	cfg.MaxChangedSkus = 2
+	changes = &runChanges{base: map[string]int{}, skus: map[string]bool{}, total: 100}
+
+	a, fa := mergeFile("a.json", "acme", Item{Sku: "A", Quantity: 5, WarehouseID: 1}, Item{Sku: "B", Quantity: 5, WarehouseID: 1})
+	b, fb := mergeFile("b.json", "acme", Item{Sku: "C", Quantity: 5, WarehouseID: 1})
+	c, fc := mergeFile("c.json", "acme", Item{Sku: "B", Quantity: 7, WarehouseID: 1})
+	merged, names := overlay(a, fa, b, fb, c, fc)
+
+	if len(names) != 2 || names[0] != "a.json" || names[1] != "c.json" {
+		t.Fatalf("merged %v, want a.json and c.json with b.json capped", names)
+	}
+	if _, ok := merged["acme"][keyOf("acme", Item{Sku: "C", WarehouseID: 1}).String()]; ok {
+		t.Error("the capped file's item was merged")
+	}
+	if iv := merged["acme"][keyOf("acme", Item{Sku: "B", WarehouseID: 1}).String()]; iv.Quantity != 7 {
+		t.Errorf("B merged as %+v, want the later file's 7", iv)
+	}
+}
+
+func TestOverlayFilesContract(t *testing.T) {
+	mergeSetup(t, map[string]VendorSettings{
+		"acme": {Contract: &Contract{Required: []string{"LocationCode"}}},
+	})
+
+	a, fa := mergeFile("a.json", "acme", Item{Sku: "A", Quantity: 5, WarehouseID: 1, LocationCode: "A1"})
+	b, fb := mergeFile("b.json", "acme", Item{Sku: "B", Quantity: 5, WarehouseID: 1})
+	c, fc := mergeFile("c.json", "acme", Item{Sku: "A", Quantity: 9, WarehouseID: 1, LocationCode: "A1"})
+	merged, names := overlay(a, fa, b, fb, c, fc)
+
+	if len(names) != 2 || names[0] != "a.json" || names[1] != "c.json" {
+		t.Fatalf("merged %v, want a.json and c.json with b.json held back", names)
+	}
+	if len(merged["acme"]) != 1 {
+		t.Errorf("merged %v, want only A", merged["acme"])
+	}
+	found := false
+	for _, e := range summary.Errors {
+		found = found || strings.HasPrefix(e, "b.json: acme: 1 items missing LocationCode")
+	}
+	if !found {
+		t.Errorf("no contract violation reported for b.json: %v", summary.Errors)
+	}
+}
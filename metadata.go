@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// pendingFields are the file fields asked of Drive when
+// listing pending files, enough to claim, order, and verify
+// them without fetching each file's metadata again.
+const pendingFields = "id,name,parents,modifiedTime,appProperties,description,md5Checksum,size,mimeType"
+
+// listPending lists every file matching q with pendingFields,
+// a thousand files to a call.
+func listPending(srv *drive.Service, q string) ([]*drive.File, error) {
+	var fls []*drive.File
+	err := srv.Files.List().Q(q).PageSize(1000).Fields("nextPageToken, files("+pendingFields+")").
+		Pages(runContext, func(fl *drive.FileList) error {
+			fls = append(fls, fl.Files...)
+			return nil
+		})
+	return fls, err
+}
+
+// nativeDoc reports whether a file is a Google Docs editor
+// file, which has no bytes to download.
+func nativeDoc(f drive.File) bool {
+	return strings.HasPrefix(f.MimeType, "application/vnd.google-apps.")
+}
+
+// verifyDownload checks a download against the size and
+// checksum Drive listed for the file, when it listed them.
+func verifyDownload(f drive.File, b []byte) error {
+	if f.Size > 0 && int64(len(b)) != f.Size {
+		return fmt.Errorf("downloaded %d of %d bytes", len(b), f.Size)
+	}
+	if f.Md5Checksum != "" {
+		sum := md5.Sum(b)
+		if hex.EncodeToString(sum[:]) != f.Md5Checksum {
+			return errors.New("checksum does not match Drive's")
+		}
+	}
+	return nil
+}
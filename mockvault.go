@@ -0,0 +1,355 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mockVault routes every SKUVault call to an embedded fake,
+// so configs can be exercised end-to-end, Drive included,
+// without touching production inventory.
+var mockVault = flag.Bool("mock-vault", false, "send SKUVault calls to an embedded fake server")
+
+// mockTokens stand in for real SKUVault tokens under the mock.
+var mockTokens = &SkuTokens{TenantToken: "mock-tenant", UserToken: "mock-user"}
+
+// mockOnce starts the fake server at most once per process.
+var mockOnce sync.Once
+
+// mockURL is where the fake server listens.
+var mockURL string
+
+// startMockVault serves the fake on a loopback port, once,
+// and points the configured SKUVault endpoint at it.
+func startMockVault() {
+	mockOnce.Do(func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatalf("Unable to start mock vault: %v", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/getTokens", mockGetTokens)
+		mux.HandleFunc("/api/inventory/getWarehouses", mockGetWarehouses)
+		mux.HandleFunc("/api/products/getProducts", mockGetProducts)
+		mux.HandleFunc("/api/products/getKits", mockGetKits)
+		mux.HandleFunc("/api/inventory/getAvailableQuantities", mockGetAvailableQuantities)
+		mux.HandleFunc("/api/purchaseorders/createPO", mockCreatePO)
+		mux.HandleFunc("/api/sales/getSalesByDate", mockGetSalesByDate)
+		mux.HandleFunc("/api/products/updateProducts", (&mockLimiter{}).wrap(mockUpdateProducts))
+		mux.HandleFunc("/api/inventory/setItemQuantities", (&mockLimiter{}).wrap(mockSetItemQuantities))
+		mux.HandleFunc("/api/inventory/setLotItemQuantities", (&mockLimiter{}).wrap(mockSetItemQuantities))
+		mux.HandleFunc("/api/inventory/setItemQuantity", (&mockLimiter{}).wrap(mockSetItemQuantity))
+		go http.Serve(ln, mux)
+
+		mockURL = "http://" + ln.Addr().String()
+		echo(fmt.Sprintf("Using mock vault at %s", mockURL))
+	})
+
+	// reapplied on every config read
+	cfg.VaultURL = mockURL
+	cfg.VaultPath = "api"
+	cfg.VaultVersion = ""
+}
+
+// mockGetTokens always hands out the mock tokens.
+func mockGetTokens(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(mockTokens)
+}
+
+// mockWarehouses are the warehouses the mock knows.
+var mockWarehouses = map[int]bool{1: true, 2: true, 3: true}
+
+// mockGetWarehouses lists the mock's warehouses on the
+// first page and nothing after.
+func mockGetWarehouses(w http.ResponseWriter, r *http.Request) {
+	var req struct{ PageNumber int }
+	json.NewDecoder(r.Body).Decode(&req)
+	type warehouse struct {
+		Id   int
+		Code string
+	}
+	ws := []warehouse{}
+	if req.PageNumber == 0 {
+		for id := range mockWarehouses {
+			ws = append(ws, warehouse{id, fmt.Sprintf("WH%d", id)})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Warehouses": ws})
+}
+
+// mockSkus are the products the mock knows: S0 to S1999
+// and a handful of letters.
+var mockSkus = func() map[string]bool {
+	skus := map[string]bool{"A1": true, "A2": true, "B": true, "C": true, "KIT1": true}
+	for i := 0; i < 2000; i++ {
+		skus[fmt.Sprintf("S%d", i)] = true
+	}
+	return skus
+}()
+
+// mockGetProducts pages through the mock's products.
+func mockGetProducts(w http.ResponseWriter, r *http.Request) {
+	var req struct{ PageNumber, PageSize int }
+	json.NewDecoder(r.Body).Decode(&req)
+	var skus []string
+	for sku := range mockSkus {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+
+	type product struct {
+		Sku          string
+		ReorderPoint int
+		Supplier     string
+	}
+	ps := []product{}
+	for i := req.PageNumber * req.PageSize; i < len(skus) && i < (req.PageNumber+1)*req.PageSize; i++ {
+		ps = append(ps, product{skus[i], mockReorder[skus[i]], "FMF"})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Products": ps})
+}
+
+// mockReorder and mockAvailable are the mock's reorder
+// points and available stock; other SKUs have none.
+var (
+	mockReorder   = map[string]int{"A1": 10, "C": 5}
+	mockAvailable = map[string]int{"A1": 2, "C": 8}
+)
+
+// mockGetAvailableQuantities lists available stock on the
+// first page and nothing after.
+func mockGetAvailableQuantities(w http.ResponseWriter, r *http.Request) {
+	var req struct{ PageNumber int }
+	json.NewDecoder(r.Body).Decode(&req)
+	type item struct {
+		Sku               string
+		AvailableQuantity int
+	}
+	items := []item{}
+	if req.PageNumber == 0 {
+		for sku, n := range mockAvailable {
+			items = append(items, item{sku, n})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Items": items})
+}
+
+// mockGetSalesByDate reports one sale of two A1 and a C
+// on the first page and nothing after.
+func mockGetSalesByDate(w http.ResponseWriter, r *http.Request) {
+	var req struct{ PageNumber int }
+	json.NewDecoder(r.Body).Decode(&req)
+	w.Header().Set("Content-Type", "application/json")
+	if req.PageNumber > 0 {
+		io.WriteString(w, `{"Sales":[]}`)
+		return
+	}
+	io.WriteString(w, `{"Sales":[{"SaleItems":[{"Sku":"A1","Quantity":2},{"Sku":"C","Quantity":1}]}]}`)
+}
+
+// mockCreatePO accepts any purchase order with lines.
+func mockCreatePO(w http.ResponseWriter, r *http.Request) {
+	var d poDraft
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil || len(d.LineItems) == 0 {
+		mockReply(w, http.StatusBadRequest, ResponseBody{Status: "BadRequest", Errors: []ErrorBody{{
+			ErrorMessages: []string{"A purchase order needs line items"},
+		}}})
+		return
+	}
+	mockReply(w, http.StatusOK, ResponseBody{Status: "OK"})
+}
+
+// mockGetKits lists the mock's one kit, KIT1: two A1 and
+// a B or C.
+func mockGetKits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `{"Kits":[{"Sku":"KIT1","KitLines":[`+
+		`{"LineName":"A","Quantity":2,"Items":[{"Sku":"A1"}]},`+
+		`{"LineName":"B or C","Quantity":1,"Items":[{"Sku":"B"},{"Sku":"C"}]}]}]}`)
+}
+
+// mockUpdateProducts accepts prices for known SKUs.
+func mockUpdateProducts(w http.ResponseWriter, r *http.Request) {
+	var pl pricePayload
+	if err := json.NewDecoder(r.Body).Decode(&pl); err != nil {
+		mockReply(w, http.StatusBadRequest, ResponseBody{Status: "BadRequest", Errors: []ErrorBody{{
+			ErrorMessages: []string{"Unable to parse request: " + err.Error()},
+		}}})
+		return
+	}
+	body := ResponseBody{Status: "OK"}
+	for _, pi := range pl.Items {
+		if !mockSkus[pi.Sku] {
+			body.Errors = append(body.Errors, ErrorBody{Sku: pi.Sku, ErrorMessages: []string{"Sku not found"}})
+		}
+	}
+	code := http.StatusOK
+	if len(body.Errors) > 0 {
+		body.Status = "ItemErrors"
+		code = http.StatusAccepted
+	}
+	mockReply(w, code, body)
+}
+
+// mockSetItemQuantities checks items the way SKUVault does,
+// answering 200 when all pass, 202 with per-item errors when
+// some fail, and 400 when the payload itself is unacceptable.
+// It also serves the lot endpoint, where every item needs a lot.
+func mockSetItemQuantities(w http.ResponseWriter, r *http.Request) {
+	in := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			mockReply(w, http.StatusBadRequest, ResponseBody{Status: "BadRequest", Errors: []ErrorBody{{
+				ErrorMessages: []string{"Unable to decompress request: " + err.Error()},
+			}}})
+			return
+		}
+		defer zr.Close()
+		in = zr
+	}
+	lots := strings.HasSuffix(r.URL.Path, "/setLotItemQuantities")
+	var pl Payload
+	if err := json.NewDecoder(in).Decode(&pl); err != nil {
+		mockReply(w, http.StatusBadRequest, ResponseBody{Status: "BadRequest", Errors: []ErrorBody{{
+			ErrorMessages: []string{"Unable to parse request: " + err.Error()},
+		}}})
+		return
+	}
+	if pl.TenantToken != mockTokens.TenantToken || pl.UserToken != mockTokens.UserToken {
+		mockReply(w, http.StatusUnauthorized, ResponseBody{Status: "Unauthorized", Errors: []ErrorBody{{
+			ErrorMessages: []string{"Invalid tenant or user token"},
+		}}})
+		return
+	}
+	if len(pl.Items) > plCap {
+		mockReply(w, http.StatusBadRequest, ResponseBody{Status: "BadRequest", Errors: []ErrorBody{{
+			ErrorMessages: []string{fmt.Sprintf("Too many items (%d), maximum is %d", len(pl.Items), plCap)},
+		}}})
+		return
+	}
+
+	body := ResponseBody{Status: "OK"}
+	for _, iv := range pl.Items {
+		if msgs := mockItemErrors(iv, lots); len(msgs) > 0 {
+			body.Errors = append(body.Errors, ErrorBody{
+				Sku:           iv.Sku,
+				LocationCode:  iv.LocationCode,
+				WarehouseID:   iv.WarehouseID,
+				ErrorMessages: msgs,
+			})
+		}
+	}
+
+	switch {
+	case len(body.Errors) == 0:
+		mockReply(w, http.StatusOK, body)
+	case len(body.Errors) == len(pl.Items):
+		body.Status = "BadRequest"
+		mockReply(w, http.StatusBadRequest, body)
+	default:
+		body.Status = "ItemErrors"
+		mockReply(w, http.StatusAccepted, body)
+	}
+}
+
+// mockItemErrors checks one item as SKUVault would.
+func mockItemErrors(iv Item, lots bool) []string {
+	var msgs []string
+	if iv.Sku == "" {
+		msgs = append(msgs, "Sku is required")
+	} else if !mockSkus[iv.Sku] {
+		msgs = append(msgs, "Sku not found")
+	}
+	if !mockWarehouses[iv.WarehouseID] {
+		msgs = append(msgs, fmt.Sprintf("Warehouse %d not found", iv.WarehouseID))
+	}
+	if iv.LocationCode == "" {
+		msgs = append(msgs, "LocationCode is required")
+	}
+	if iv.Quantity < 0 {
+		msgs = append(msgs, "Quantity must not be negative")
+	}
+	switch {
+	case lots && iv.LotNumber == "":
+		msgs = append(msgs, "LotNumber is required")
+	case !lots && iv.LotNumber != "":
+		msgs = append(msgs, "LotNumber is not accepted; use setLotItemQuantities")
+	}
+	return msgs
+}
+
+// mockSetItemQuantity checks and accepts a single item.
+func mockSetItemQuantity(w http.ResponseWriter, r *http.Request) {
+	var in singleItem
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		mockReply(w, http.StatusBadRequest, ResponseBody{Status: "BadRequest", Errors: []ErrorBody{{
+			ErrorMessages: []string{"Unable to parse request: " + err.Error()},
+		}}})
+		return
+	}
+	if in.TenantToken != mockTokens.TenantToken || in.UserToken != mockTokens.UserToken {
+		mockReply(w, http.StatusUnauthorized, ResponseBody{Status: "Unauthorized", Errors: []ErrorBody{{
+			ErrorMessages: []string{"Invalid tenant or user token"},
+		}}})
+		return
+	}
+	if msgs := mockItemErrors(in.Item, false); len(msgs) > 0 {
+		mockReply(w, http.StatusBadRequest, ResponseBody{Status: "BadRequest", Errors: []ErrorBody{{
+			ErrorMessages: msgs,
+		}}})
+		return
+	}
+	mockReply(w, http.StatusOK, ResponseBody{Status: "OK"})
+}
+
+// mockReply writes a JSON response body with a status code.
+func mockReply(w http.ResponseWriter, code int, body ResponseBody) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// mockLimiter enforces SKUVault's ten calls a minute,
+// answering 429 to anything beyond it.
+type mockLimiter struct {
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+// wrap applies the limit in front of a handler.
+func (l *mockLimiter) wrap(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		now := time.Now()
+		for len(l.calls) > 0 && now.Sub(l.calls[0]) > time.Minute {
+			l.calls = l.calls[1:]
+		}
+		limited := len(l.calls) >= 10
+		if !limited {
+			l.calls = append(l.calls, now)
+		}
+		l.mu.Unlock()
+
+		if limited {
+			mockReply(w, http.StatusTooManyRequests, ResponseBody{Status: "Throttled", Errors: []ErrorBody{{
+				ErrorMessages: []string{"Too many requests; limit is 10 per minute"},
+			}}})
+			return
+		}
+		h(w, r)
+	}
+}
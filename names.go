@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// fileNames is the compiled FileNames convention.
+var fileNames *regexp.Regexp
+
+// compileFileNames compiles the naming convention, if any.
+func compileFileNames() {
+	fileNames = nil
+	if cfg.FileNames == "" {
+		return
+	}
+	re, err := regexp.Compile(cfg.FileNames)
+	if err != nil {
+		log.Fatalf("Unable to compile FileNames: %v", err)
+	}
+	fileNames = re
+}
+
+// fileMeta is what a conventional file name says about
+// the file; parts the convention leaves out are empty.
+type fileMeta struct {
+	Vendor string
+	Type   string
+	Date   time.Time
+}
+
+// fileDateLayout parses the date in file names.
+func fileDateLayout() string {
+	if cfg.FileDateLayout != "" {
+		return cfg.FileDateLayout
+	}
+	return "20060102"
+}
+
+// parseFileName reads a file name by the naming convention.
+func parseFileName(name string) (fileMeta, error) {
+	var meta fileMeta
+	m := fileNames.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return meta, fmt.Errorf("name does not follow the naming convention %s", cfg.FileNames)
+	}
+	for i, group := range fileNames.SubexpNames() {
+		switch group {
+		case "vendor":
+			meta.Vendor = m[i]
+		case "type":
+			meta.Type = m[i]
+		case "date":
+			t, err := time.ParseInLocation(fileDateLayout(), m[i], time.Local)
+			if err != nil {
+				return meta, fmt.Errorf("name's date %q: %v", m[i], err)
+			}
+			meta.Date = t
+		}
+	}
+	return meta, nil
+}
+
+// conventionalFiles fails the files whose names break the
+// naming convention, giving the rest.
+func conventionalFiles(fls []*drive.File) []*drive.File {
+	if fileNames == nil {
+		return fls
+	}
+	var ok []*drive.File
+	for _, f := range fls {
+		meta, err := parseFileName(f.Name)
+		if err != nil {
+			failFile(*f, err)
+			continue
+		}
+		echoAt(levelVerbose, fmt.Sprintf("%s: vendor %q, type %q, dated %s",
+			f.Name, meta.Vendor, meta.Type, meta.Date.Format("2006-01-02")))
+		ok = append(ok, f)
+	}
+	return ok
+}
+
+// nameVendor gives the configured vendor a file name names
+// under the convention, matched regardless of case.
+func nameVendor(name string) (string, bool) {
+	if fileNames == nil {
+		return "", false
+	}
+	meta, err := parseFileName(name)
+	if err != nil || meta.Vendor == "" {
+		return "", false
+	}
+	for vendor := range settings {
+		if strings.EqualFold(vendor, meta.Vendor) {
+			return vendor, true
+		}
+	}
+	return "", false
+}
+
+// fileTime is when a file's data is from: the date in its
+// name under the convention, else when it changed in Drive.
+func fileTime(f drive.File) time.Time {
+	if fileNames != nil {
+		if meta, err := parseFileName(f.Name); err == nil && !meta.Date.IsZero() {
+			return meta.Date
+		}
+	}
+	return modifiedTime(f)
+}
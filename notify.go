@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// SMTPConfig is the mail relay notifications go through.
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// problemRow is one item that failed validation.
+type problemRow struct {
+	Vendor  string
+	Key     string
+	Item    Item
+	Problem string
+}
+
+// problemRows validates every item of a decoded feed.
+func problemRows(vsd map[string]map[string]Item) []problemRow {
+	var rows []problemRow
+	for _, vendor := range vendorOrder(vsd) {
+		for key, iv := range vsd[vendor] {
+			if err := validateItem(iv); err != nil {
+				rows = append(rows, problemRow{vendor, key, iv, err.Error()})
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Vendor != rows[j].Vendor {
+			return rows[i].Vendor < rows[j].Vendor
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
+
+// rejectFile sets aside a file whose problem rows pass
+// RejectPercent of its items, telling its vendors why;
+// it reports whether the file was rejected.
+func rejectFile(f drive.File, vsd map[string]map[string]Item) bool {
+	if cfg.RejectPercent <= 0 {
+		return false
+	}
+	rows := problemRows(vsd)
+	n := feedItems(vsd)
+	if n == 0 || 100*float64(len(rows))/float64(n) <= cfg.RejectPercent {
+		return false
+	}
+
+	reason := fmt.Errorf("%d of %d items have problems", len(rows), n)
+	failFile(f, reason)
+	for _, vendor := range vendorOrder(vsd) {
+		var mine []problemRow
+		for _, r := range rows {
+			if r.Vendor == vendor {
+				mine = append(mine, r)
+			}
+		}
+		notifyVendor(vendor, f, reason.Error(), mine)
+	}
+	return true
+}
+
+// notifyVendor emails a vendor's contact that their file
+// was rejected, attaching its problem rows as CSV.
+func notifyVendor(vendor string, f drive.File, reason string, rows []problemRow) {
+	to := settings[vendor].Contact
+	if to == "" || cfg.SMTP.Addr == "" || alreadyNotified(vendor, f) {
+		return
+	}
+	if readOnlySkip(fmt.Sprintf("emailing %s about %s", vendor, f.Name)) {
+		return
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello,\r\n\r\nYour inventory file \"%s\" could not be loaded: %s.\r\n", f.Name, reason)
+	if len(rows) > 0 {
+		fmt.Fprintf(&body, "\r\nThe attached CSV lists the %d rows with problems. ", len(rows))
+		body.WriteString("Please correct them and send the file again.\r\n")
+	} else {
+		body.WriteString("\r\nPlease check the file's format and send it again.\r\n")
+	}
+	body.WriteString("\r\nThis message was sent automatically.\r\n")
+
+	var attach []byte
+	if len(rows) > 0 {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"Row", "Sku", "Quantity", "WarehouseID", "LocationCode", "Problem"})
+		for _, r := range rows {
+			w.Write([]string{r.Key, r.Item.Sku, strconv.Itoa(r.Item.Quantity),
+				strconv.Itoa(r.Item.WarehouseID), r.Item.LocationCode, r.Problem})
+		}
+		w.Flush()
+		attach = buf.Bytes()
+	}
+
+	subject := fmt.Sprintf("Inventory file %s was rejected", f.Name)
+	if err := sendMail([]string{to}, subject, body.String(), "problems.csv", attach); err != nil {
+		log.Printf("Unable to notify %s about %s: %v", vendor, f.Name, err)
+		return
+	}
+	echo(fmt.Sprintf("Notified %s (%s) about %s", vendor, to, f.Name))
+	if err := appendRecord(noticesTable, notice{time.Now(), vendor, f.Id, f.ModifiedTime}); err != nil {
+		log.Printf("Unable to record notice: %v", err)
+	}
+}
+
+// noticesTable remembers which file versions vendors were
+// told about, so a file left pending is reported once.
+const noticesTable = "notices"
+
+// notice is one rejection email sent to a vendor.
+type notice struct {
+	Time     time.Time
+	Vendor   string
+	File     string
+	Modified string
+}
+
+// alreadyNotified reports whether the vendor was told
+// about this version of the file.
+func alreadyNotified(vendor string, f drive.File) bool {
+	found := false
+	scanRecords(noticesTable, func(raw json.RawMessage) error {
+		var n notice
+		if json.Unmarshal(raw, &n) == nil && n.Vendor == vendor && n.File == f.Id && n.Modified == f.ModifiedTime {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// sendMail sends a plain text message through the configured
+// relay, with an optional CSV attachment.
+func sendMail(to []string, subject, text, attachName string, attach []byte) error {
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		cfg.SMTP.From, strings.Join(to, ", "), subject, time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	pw, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	pw.Write([]byte(text))
+	if len(attach) > 0 {
+		pw, err = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/csv; charset=utf-8"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachName)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return err
+		}
+		enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: pw})
+		enc.Write(attach)
+		enc.Close()
+	}
+	mw.Close()
+
+	var auth smtp.Auth
+	if cfg.SMTP.Username != "" {
+		host := cfg.SMTP.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, host)
+	}
+	return smtp.SendMail(cfg.SMTP.Addr, auth, cfg.SMTP.From, to, msg.Bytes())
+}
+
+// lineWrapper breaks base64 output into 76-column lines.
+type lineWrapper struct {
+	w   io.Writer
+	col int
+}
+
+// Write copies p, inserting CRLF every 76 bytes.
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if l.col == 76 {
+			if _, err := l.w.Write([]byte("\r\n")); err != nil {
+				return 0, err
+			}
+			l.col = 0
+		}
+		if _, err := l.w.Write([]byte{b}); err != nil {
+			return 0, err
+		}
+		l.col++
+	}
+	return len(p), nil
+}
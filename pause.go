@@ -0,0 +1,28 @@
+package main
+
+import "sync/atomic"
+
+// paused holds payload dispatch while non-zero;
+// a payload already in flight is left to finish.
+var paused int32
+
+// setPaused holds or releases payload dispatch.
+func setPaused(p bool) {
+	var v int32
+	if p {
+		v = 1
+	}
+	if atomic.SwapInt32(&paused, v) == v {
+		return
+	}
+	if p {
+		echo("Paused payload dispatch")
+	} else {
+		echo("Resumed payload dispatch")
+	}
+}
+
+// isPaused reports whether payload dispatch is held.
+func isPaused() bool {
+	return atomic.LoadInt32(&paused) != 0
+}
@@ -0,0 +1,7 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+// handlePauseSignals is a no-op where SIGUSR1/2 don't exist.
+func handlePauseSignals() {}
@@ -0,0 +1,22 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handlePauseSignals pauses payload dispatch on SIGUSR1,
+// letting the in-flight payload finish, and resumes on SIGUSR2.
+func handlePauseSignals() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigCh {
+			setPaused(sig == syscall.SIGUSR1)
+		}
+	}()
+}
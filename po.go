@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// poLine is one line of a drafted purchase order.
+type poLine struct {
+	SKU      string
+	Quantity int
+}
+
+// poDraft is a createPO payload for one vendor.
+type poDraft struct {
+	PoNumber     string
+	SupplierName string
+	LineItems    []poLine
+	TenantToken  string `json:",omitempty"`
+	UserToken    string `json:",omitempty"`
+}
+
+// poCmd drafts purchase orders for SKUs below their SKUVault
+// reorder point that a vendor's feed says it can supply.
+// Drafts are written to the state directory for review;
+// -send creates them in SKUVault instead.
+//
+//	drive2sku po [-send] <file-or-folder>
+func poCmd(args []string) {
+	fs := flag.NewFlagSet("po", flag.ExitOnError)
+	send := fs.Bool("send", false, "create the purchase orders in SKUVault")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku po [-send] <file-or-folder>")
+		os.Exit(2)
+	}
+
+	readConfig()
+	readBufferSettings()
+	initDriveAndVault()
+
+	paths, err := localFeeds(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Unable to read %s: %v", fs.Arg(0), err)
+	}
+	offered := map[string]map[string]int{}
+	for _, p := range paths {
+		for k, qty := range loadPositions(p) {
+			if offered[k.Vendor] == nil {
+				offered[k.Vendor] = map[string]int{}
+			}
+			offered[k.Vendor][k.Sku] += qty
+		}
+	}
+
+	c, err := fetchCatalog()
+	if err != nil {
+		log.Fatalf("Unable to fetch reorder points: %v", err)
+	}
+	avail, err := fetchAvailable()
+	if err != nil {
+		log.Fatalf("Unable to fetch available quantities: %v", err)
+	}
+
+	for _, d := range draftPOs(offered, c.ReorderPoints, avail) {
+		if *send {
+			createPO(d)
+			continue
+		}
+		name := statePath(d.PoNumber + ".json")
+		if err := writeJSON(name, d); err != nil {
+			log.Fatalf("Unable to save draft %s: %v", name, err)
+		}
+		echo(fmt.Sprintf("Drafted %s: %d lines for %s", name, len(d.LineItems), d.SupplierName))
+	}
+}
+
+// draftPOs orders, from each vendor, what it can supply
+// of the shortfall below every SKU's reorder point.
+func draftPOs(offered map[string]map[string]int, reorder, avail map[string]int) []poDraft {
+	vendors := make([]string, 0, len(offered))
+	for v := range offered {
+		vendors = append(vendors, v)
+	}
+	sort.Strings(vendors)
+
+	date := time.Now().Format("20060102")
+	var ds []poDraft
+	for _, v := range vendors {
+		d := poDraft{PoNumber: fmt.Sprintf("D2S-%s-%s", v, date), SupplierName: v}
+		for sku, qty := range offered[v] {
+			short := reorder[sku] - avail[sku]
+			if short <= 0 || qty <= 0 {
+				continue
+			}
+			if short > qty {
+				short = qty
+			}
+			d.LineItems = append(d.LineItems, poLine{sku, short})
+		}
+		if len(d.LineItems) == 0 {
+			continue
+		}
+		sort.Slice(d.LineItems, func(i, j int) bool { return d.LineItems[i].SKU < d.LineItems[j].SKU })
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+// fetchAvailable pages through SKUVault's available
+// quantities across all warehouses.
+func fetchAvailable() (map[string]int, error) {
+	avail := map[string]int{}
+	as, err := vault.GetAvailableQuantities(runContext)
+	for _, a := range as {
+		avail[a.Sku] += a.AvailableQuantity
+	}
+	return avail, err
+}
+
+// createPO sends a drafted purchase order to SKUVault.
+func createPO(d poDraft) {
+	res, body, err := vault.CreatePO(runContext, d)
+	if err != nil {
+		log.Fatalf("Unable to create purchase order %s: %v", d.PoNumber, err)
+	}
+	if res.StatusCode >= 400 || len(body.Errors) > 0 {
+		say(fmt.Sprintf("Purchase order %s: %d %s", d.PoNumber, res.StatusCode, responseStatus(body)))
+		return
+	}
+	echo(fmt.Sprintf("Created purchase order %s: %d lines for %s", d.PoNumber, len(d.LineItems), d.SupplierName))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// PriceItem is one product's cost and prices for SKUVault's
+// updateProducts; unset fields are left as they are.
+type PriceItem struct {
+	Sku         string
+	Cost        *float64 `json:",omitempty"`
+	SalePrice   *float64 `json:",omitempty"`
+	RetailPrice *float64 `json:",omitempty"`
+}
+
+// pricePayload is one updateProducts call of up to 100 items.
+type pricePayload struct {
+	Items       []PriceItem
+	TenantToken string
+	UserToken   string
+}
+
+// PriceMapping describes how a vendor's tabular price file
+// lines up with PriceItem fields, like Mapping does for stock.
+type PriceMapping struct {
+	Match string
+
+	Sku         string
+	Cost        string `json:",omitempty"`
+	SalePrice   string `json:",omitempty"`
+	RetailPrice string `json:",omitempty"`
+}
+
+// priceThrottle spaces updateProducts calls.
+func priceThrottle() time.Duration {
+	if cfg.PriceThrottle.Duration > 0 {
+		return cfg.PriceThrottle.Duration
+	}
+	return throttle * time.Millisecond
+}
+
+// syncPrices posts every price file in the price folder,
+// finishing each file once all of its payloads succeed.
+func syncPrices() {
+	q := fmt.Sprintf(`'%s' in parents and trashed = false`, cfg.PriceFolder)
+	fls, err := drv.Files.List().Q(q).Fields("files(id,name,modifiedTime)").Do()
+	if err != nil {
+		log.Printf("Unable to list price files: %v", err)
+		return
+	}
+
+	tick := time.NewTicker(priceThrottle())
+	defer tick.Stop()
+	for _, f := range fls.Files {
+		echo(fmt.Sprintf("Pricing %s (%s)", f.Name, f.Id))
+		b, err := downloadFile(runContext, *f)
+		if err != nil {
+			log.Printf("Unable to download price file %s: %v", f.Name, explainDrive(err))
+			continue
+		}
+		items, err := decodePrices(f.Name, b)
+		if err != nil {
+			log.Printf("Unable to read price file %s: %v", f.Name, err)
+			continue
+		}
+		if postPrices(items, tick.C) {
+			finishFile(*f, cfg.PriceFolder)
+		}
+	}
+}
+
+// postPrices sends price items 100 at a time, one call per
+// tick, reporting whether every call succeeded.
+func postPrices(items []PriceItem, tick <-chan time.Time) bool {
+	ok := true
+	for len(items) > 0 {
+		n := plCap
+		if len(items) < n {
+			n = len(items)
+		}
+		batch := items[:n]
+		items = items[n:]
+
+		<-tick
+		for isPaused() {
+			<-tick
+		}
+		res, body, err := vault.UpdateProducts(runContext, batch)
+		if err != nil {
+			log.Printf("Unable to update products in SKUVault: %v", err)
+			ok = false
+			continue
+		}
+		if res.StatusCode >= 400 || len(body.Errors) > 0 {
+			say(fmt.Sprintf("Updated prices (%d/%d); %d %s", n, plCap, res.StatusCode, responseStatus(body)))
+			ok = false
+			continue
+		}
+		echo(fmt.Sprintf("Updated prices (%d/%d)", n, plCap))
+	}
+	return ok
+}
+
+// decodePrices reads a price file: rows through the price
+// mapping whose Match claims it, or else native JSON keyed
+// by vendor and item like a stock file.
+func decodePrices(name string, b []byte) ([]PriceItem, error) {
+	base := filepath.Base(name)
+	for _, vs := range settings {
+		m := vs.PriceMapping
+		if m == nil || m.Match == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(m.Match, base); ok {
+			rows, err := readRows(name, bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			return applyPriceMapping(m, rows)
+		}
+	}
+
+	vsd := map[string]map[string]PriceItem{}
+	if err := json.Unmarshal(b, &vsd); err != nil {
+		return nil, err
+	}
+	vendors := make([]string, 0, len(vsd))
+	for vendor := range vsd {
+		vendors = append(vendors, vendor)
+	}
+	sort.Strings(vendors)
+	var items []PriceItem
+	for _, vendor := range vendors {
+		for _, pi := range vsd[vendor] {
+			items = append(items, pi)
+		}
+	}
+	return items, nil
+}
+
+// applyPriceMapping converts header-led rows into price items.
+func applyPriceMapping(m *PriceMapping, rows [][]string) ([]PriceItem, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	col := headerIndex(rows[0])
+	skuI, err := col(m.Sku)
+	if err != nil {
+		return nil, err
+	}
+	if skuI < 0 {
+		return nil, fmt.Errorf("price mapping has no Sku column")
+	}
+	var cols [3]int
+	for i, name := range []string{m.Cost, m.SalePrice, m.RetailPrice} {
+		if cols[i], err = col(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var items []PriceItem
+	for n, row := range rows[1:] {
+		pi := PriceItem{Sku: cell(row, skuI)}
+		for i, dst := range []**float64{&pi.Cost, &pi.SalePrice, &pi.RetailPrice} {
+			v := cell(row, cols[i])
+			if v == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(trimMoney(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %v", n+2, err)
+			}
+			*dst = &f
+		}
+		items = append(items, pi)
+	}
+	return items, nil
+}
+
+// trimMoney drops currency signs and thousands separators.
+func trimMoney(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c != '$' && c != ',' && c != ' ' {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// finishFile archives or deletes a finished file that came
+// from the given folder.
+func finishFile(f drive.File, folder string) {
+	if cfg.ProcessedFolder == "" {
+		deleteFile(f)
+		return
+	}
+	echo(fmt.Sprintf(`Archiving file "%s" (%s)`, f.Name, f.Id))
+	_, err := drv.Files.Update(f.Id, &drive.File{}).AddParents(cfg.ProcessedFolder).RemoveParents(folder).Do()
+	if err != nil {
+		log.Printf("Unable to archive file: %v", err)
+	}
+}
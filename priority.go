@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sort"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// vendorOrder lists the vendors of a decoded file
+// by their configured priority, highest first;
+// ties fall back to alphabetical for a stable run.
+func vendorOrder(vsd map[string]map[string]Item) []string {
+	vendors := make([]string, 0, len(vsd))
+	for vendor := range vsd {
+		vendors = append(vendors, vendor)
+	}
+	sort.Slice(vendors, func(i, j int) bool {
+		pi, pj := settings[vendors[i]].Priority, settings[vendors[j]].Priority
+		if pi != pj {
+			return pi > pj
+		}
+		return vendors[i] < vendors[j]
+	})
+	return vendors
+}
+
+// byPriority orders pending files so vendors with a higher
+// Priority go first, however their files were listed; each
+// vendor's files, and those with no known vendor, keep to
+// oldest first.
+func byPriority(fls []*drive.File) {
+	byModified(fls)
+	sort.SliceStable(fls, func(i, j int) bool {
+		return filePriority(fls[i]) > filePriority(fls[j])
+	})
+}
+
+// filePriority is the Priority of a file's vendor.
+func filePriority(f *drive.File) int {
+	vendor, _ := fileVendor(f.Name)
+	return settings[vendor].Priority
+}
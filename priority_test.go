@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestByPriority(t *testing.T) {
+	defer func(s map[string]VendorSettings) { settings = s }(settings)
+	settings = map[string]VendorSettings{
+		"key":  {Priority: 10, Mapping: &Mapping{Match: "key-*.csv"}},
+		"slow": {Priority: -5, Mapping: &Mapping{Match: "slow-*.csv"}},
+		"mid":  {Mapping: &Mapping{Match: "mid-*.csv"}},
+	}
+
+	fls := []*drive.File{
+		{Name: "slow-1.csv", ModifiedTime: "2026-01-01T08:00:00Z"},
+		{Name: "mid-2.csv", ModifiedTime: "2026-01-01T12:00:00Z"},
+		{Name: "other.json", ModifiedTime: "2026-01-01T07:00:00Z"},
+		{Name: "key-2.csv", ModifiedTime: "2026-01-01T11:00:00Z"},
+		{Name: "slow-2.csv", ModifiedTime: "2026-01-01T09:00:00Z"},
+		{Name: "mid-1.csv", ModifiedTime: "2026-01-01T10:00:00Z"},
+		{Name: "key-1.csv", ModifiedTime: "2026-01-01T10:30:00Z"},
+	}
+	byPriority(fls)
+
+	want := []string{"key-1.csv", "key-2.csv", "other.json", "mid-1.csv", "mid-2.csv", "slow-1.csv", "slow-2.csv"}
+	for i, f := range fls {
+		if f.Name != want[i] {
+			var got []string
+			for _, f := range fls {
+				got = append(got, f.Name)
+			}
+			t.Fatalf("ordered %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressBar draws a live bar instead of periodic lines
+// when standard output is a terminal.
+var progressBar = flag.Bool("progress", false, "draw a terminal progress bar")
+
+// expect adds files and items to the run's expected totals.
+func (s *runSummary) expect(files, items int) {
+	s.mu.Lock()
+	s.FilesTotal += files
+	s.ItemsTotal += items
+	s.mu.Unlock()
+}
+
+// fileDone counts a file as finished queueing or set aside.
+func (s *runSummary) fileDone() {
+	s.mu.Lock()
+	s.FilesDone++
+	s.mu.Unlock()
+}
+
+// feedItems counts the items in a decoded feed.
+func feedItems(vsd map[string]map[string]Item) int {
+	n := 0
+	for _, v := range vsd {
+		n += len(v)
+	}
+	return n
+}
+
+// progressEvery is how often progress is reported.
+func progressEvery() time.Duration {
+	if useBar() {
+		return time.Second
+	}
+	if cfg.ProgressEvery.Duration > 0 {
+		return cfg.ProgressEvery.Duration
+	}
+	return 30 * time.Second
+}
+
+// useBar reports whether to draw the terminal bar.
+func useBar() bool {
+	if !*progressBar {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// reportProgress prints files and items done with an ETA
+// from the items left and the throttle.
+func reportProgress() {
+	s := summary
+	s.mu.Lock()
+	filesDone, filesTotal := s.FilesDone, s.FilesTotal
+	items, total, sent := s.Items, s.ItemsTotal, s.ItemsSent
+	s.mu.Unlock()
+
+	left := total - items
+	if left < 0 {
+		left = 0
+	}
+	ticks := ((left+plCap-1)/plCap + postsPerTick() - 1) / postsPerTick()
+	eta := time.Duration(ticks) * throttleInterval()
+	msg := fmt.Sprintf("Files %d/%d, items %d/%d sent, ETA %v", filesDone, filesTotal, sent, total, eta)
+
+	if !useBar() {
+		echo(msg)
+		return
+	}
+	const width = 40
+	filled := 0
+	if total > 0 {
+		filled = width * items / total
+	}
+	if filled > width {
+		filled = width
+	}
+	fmt.Printf("\r[%s%s] %s ", strings.Repeat("#", filled), strings.Repeat(".", width-filled), msg)
+}
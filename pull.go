@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// pullCmd builds a vendor scorecard from SKUVault: units sold
+// over recent days, what is available now, and the reorder
+// point, for every SKU SKUVault lists under the vendor as
+// supplier. It is uploaded to the vendor's Drive folder, or
+// saved to the state directory when the vendor has none.
+//
+//	drive2sku pull [-days 30] <vendor>
+func pullCmd(args []string) {
+	fs := flag.NewFlagSet("pull", flag.ExitOnError)
+	days := fs.Int("days", 30, "how many days of sales to include")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku pull [-days 30] <vendor>")
+		os.Exit(2)
+	}
+	vendor := fs.Arg(0)
+
+	readConfig()
+	readBufferSettings()
+	initDriveAndVault()
+
+	c, err := fetchCatalog()
+	if err != nil {
+		log.Fatalf("Unable to fetch SKUVault products: %v", err)
+	}
+	supplier := vendor
+	if s := settings[vendor].Supplier; s != "" {
+		supplier = s
+	}
+	skus := c.Suppliers[supplier]
+	if len(skus) == 0 {
+		log.Fatalf("SKUVault lists no products supplied by %q", supplier)
+	}
+	to := time.Now()
+	sold, err := fetchSales(to.AddDate(0, 0, -*days), to)
+	if err != nil {
+		log.Fatalf("Unable to fetch sales: %v", err)
+	}
+	avail, err := fetchAvailable()
+	if err != nil {
+		log.Fatalf("Unable to fetch available quantities: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"Sku", fmt.Sprintf("Sold (%dd)", *days), "Available", "ReorderPoint"})
+	sort.Strings(skus)
+	for _, sku := range skus {
+		w.Write([]string{sku, strconv.Itoa(sold[sku]), strconv.Itoa(avail[sku]), strconv.Itoa(c.ReorderPoints[sku])})
+	}
+	w.Flush()
+
+	name := fmt.Sprintf("scorecard-%s-%s.csv", vendor, to.Format("20060102"))
+	folder := settings[vendor].Folder
+	if folder == "" {
+		if err := ioutil.WriteFile(statePath(name), buf.Bytes(), 0600); err != nil {
+			log.Fatalf("Unable to save scorecard: %v", err)
+		}
+		echo(fmt.Sprintf("Saved %s: %d SKUs", statePath(name), len(skus)))
+		return
+	}
+	_, err = drv.Files.Create(&drive.File{Name: name, Parents: []string{folder}, MimeType: "text/csv"}).
+		Media(&buf).Do()
+	if err != nil {
+		log.Fatalf("Unable to upload scorecard: %v", err)
+	}
+	echo(fmt.Sprintf("Uploaded %s to %s's folder: %d SKUs", name, vendor, len(skus)))
+}
+
+// fetchSales totals units sold per SKU between two times.
+func fetchSales(from, to time.Time) (map[string]int, error) {
+	sold := map[string]int{}
+	ss, err := vault.GetSalesByDate(runContext, from, to)
+	for _, s := range ss {
+		for _, it := range s.SaleItems {
+			sold[it.Sku] += it.Quantity
+		}
+	}
+	return sold, err
+}
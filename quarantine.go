@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// quarantineTable keeps every item set aside for an unknown
+// warehouse, across runs.
+const quarantineTable = "quarantine"
+
+// warehouses holds the warehouse IDs SKUVault knows; nil
+// when they could not be loaded, which quarantines nothing.
+var warehouses map[int]bool
+
+// quarantined is one item held back from SKUVault, for an
+// unknown warehouse unless Reason says otherwise.
+type quarantined struct {
+	Run    string
+	File   string
+	Vendor string
+	Item   Item
+	Reason string `json:",omitempty"`
+}
+
+// loadWarehouses asks SKUVault for its warehouses, a page
+// at a time, so unknown ones can be caught before posting.
+func loadWarehouses() {
+	warehouses = nil
+	known := map[int]bool{}
+	for page := 0; ; page++ {
+		ws, err := vault.GetWarehouses(runContext, page)
+		if err != nil {
+			log.Printf("Unable to load SKUVault warehouses; not quarantining: %v", err)
+			return
+		}
+		if len(ws) == 0 {
+			break
+		}
+		for _, w := range ws {
+			known[w.Id] = true
+		}
+	}
+	warehouses = known
+}
+
+// knownWarehouse reports whether SKUVault has a warehouse.
+func knownWarehouse(id int) bool {
+	return warehouses == nil || warehouses[id]
+}
+
+// quarantine holds an item back from SKUVault, noting it
+// in the run's summary and the quarantine table; reason is
+// blank for an unknown warehouse.
+func quarantine(vendor string, fs []drive.File, iv Item, reason string) {
+	names := make([]string, len(fs))
+	for i, f := range fs {
+		names[i] = f.Name
+	}
+	q := quarantined{runCtx.run, strings.Join(names, ", "), vendor, iv, reason}
+
+	summary.mu.Lock()
+	summary.Quarantined = append(summary.Quarantined, q)
+	summary.mu.Unlock()
+	if err := appendRecord(quarantineTable, q); err != nil {
+		log.Printf("Unable to record quarantined item: %v", err)
+	}
+}
+
+// reportQuarantine sums up the run's quarantined items and,
+// when a QuarantineFolder is set, uploads them there as CSV.
+func reportQuarantine() {
+	summary.mu.Lock()
+	qs := summary.Quarantined
+	summary.mu.Unlock()
+	if len(qs) == 0 {
+		return
+	}
+
+	ids := map[int]int{}
+	unknown, held := 0, 0
+	for _, q := range qs {
+		if q.Reason != "" {
+			held++
+			continue
+		}
+		ids[q.Item.WarehouseID]++
+		unknown++
+	}
+	var parts []string
+	for id, n := range ids {
+		parts = append(parts, fmt.Sprintf("%d (%d items)", id, n))
+	}
+	sort.Strings(parts)
+	if unknown > 0 {
+		say(fmt.Sprintf("Quarantined %d items for unknown warehouses: %s", unknown, strings.Join(parts, ", ")))
+	}
+	if held > 0 {
+		say(fmt.Sprintf("Held %d items for review", held))
+	}
+
+	if cfg.QuarantineFolder == "" {
+		return
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"File", "Vendor", "Sku", "Quantity", "WarehouseID", "LocationCode", "Reason"})
+	for _, q := range qs {
+		reason := q.Reason
+		if reason == "" {
+			reason = "unknown warehouse"
+		}
+		w.Write([]string{q.File, q.Vendor, q.Item.Sku, strconv.Itoa(q.Item.Quantity),
+			strconv.Itoa(q.Item.WarehouseID), q.Item.LocationCode, reason})
+	}
+	w.Flush()
+
+	if readOnlySkip("uploading the quarantine report") {
+		return
+	}
+	_, err := drv.Files.Create(&drive.File{
+		Name:     "quarantine-" + runCtx.run + ".csv",
+		Parents:  []string{cfg.QuarantineFolder},
+		MimeType: "text/csv",
+	}).Media(&buf).Do()
+	if err != nil {
+		log.Printf("Unable to upload quarantine report: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// readOnly keeps runs listing, downloading, validating, and
+// reporting, while nothing is posted to SKUVault, no vendor
+// is emailed, and nothing in Drive is claimed, moved,
+// created, or deleted.
+var readOnly = flag.Bool("read-only", false, "never post to SKUVault or change Drive; only list, download, validate, and report")
+
+// readOnlySkip reports whether an action must be skipped for
+// read-only mode, saying what was left undone.
+func readOnlySkip(what string) bool {
+	if !*readOnly {
+		return false
+	}
+	echo(fmt.Sprintf("Read-only: not %s", what))
+	return true
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reportRejects records each item SKUVault rejected in the
+// run report, against the file and row it came from.
+func reportRejects(pl Payload, status int, errs []ErrorBody) {
+	for _, e := range errs {
+		iv := rejectedItem(pl, e)
+		summary.vendorRejected(iv.vendor)
+		origin := iv.origin
+		if skuNotFound(e) {
+			why := "not found"
+			if origin != "" {
+				why += " (" + origin + ")"
+			}
+			reportUnknownSku(status, e.Sku, why)
+			continue
+		}
+
+		msg := fmt.Sprintf("Sku %q rejected: %s", e.Sku, strings.Join(e.ErrorMessages, ", "))
+		if origin != "" {
+			msg = origin + ": " + msg
+		}
+		echoAt(levelVerbose, msg)
+		summary.recordError(msg)
+	}
+}
+
+// rejectedItem finds the payload item an error names,
+// a blank item when none matches.
+func rejectedItem(pl Payload, e ErrorBody) Item {
+	for _, iv := range pl.Items {
+		if iv.Sku != e.Sku {
+			continue
+		}
+		if e.WarehouseID != 0 && iv.WarehouseID != e.WarehouseID {
+			continue
+		}
+		if e.LocationCode != "" && iv.LocationCode != e.LocationCode {
+			continue
+		}
+		return iv
+	}
+	return Item{}
+}
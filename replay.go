@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// replaying marks a replay run, which leaves the archived
+// files where they are and out of the arrival records.
+var replaying bool
+
+// replayCmd reposts archived files last modified within a
+// date range, oldest first, so the newest quantities win.
+// It posts to the mock vault unless -real is given, which
+// asks for confirmation first unless -yes is given.
+//
+//	drive2sku replay -from 2006-01-02 [-to 2006-01-02] [-real]
+func replayCmd(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	from := fs.String("from", "", "first day to replay, yyyy-mm-dd")
+	to := fs.String("to", time.Now().Format("2006-01-02"), "last day to replay, yyyy-mm-dd")
+	forReal := fs.Bool("real", false, "post to SKUVault itself rather than the mock vault")
+	fs.Parse(args)
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku replay -from yyyy-mm-dd [-to yyyy-mm-dd] [-real]")
+		os.Exit(2)
+	}
+	start, err := time.ParseInLocation("2006-01-02", *from, time.Local)
+	if err != nil {
+		log.Fatalf("Unable to parse -from %q: %v", *from, err)
+	}
+	end, err := time.ParseInLocation("2006-01-02", *to, time.Local)
+	if err != nil {
+		log.Fatalf("Unable to parse -to %q: %v", *to, err)
+	}
+	end = end.AddDate(0, 0, 1)
+
+	if !*forReal {
+		*mockVault = true
+	}
+	readConfig()
+	if cfg.ProcessedFolder == "" {
+		log.Fatalf("Nothing to replay; set ProcessedFolder to archive files")
+	}
+	readBufferSettings()
+	initDriveAndVault()
+
+	fls, err := archivedFiles(start, end)
+	if err != nil {
+		log.Fatalf("Unable to list archived files: %v", explainDrive(err))
+	}
+	if len(fls) == 0 {
+		fmt.Println("No archived files in that range.")
+		return
+	}
+	if *forReal && !*assumeYes && !confirm(fmt.Sprintf("Replay %d files into SKUVault at %s?", len(fls), cfg.VaultURL)) {
+		fmt.Println("Replay cancelled.")
+		return
+	}
+
+	replaying = true
+	defer timeTrack(time.Now())
+	relay(func() { replayFiles(fls) })
+}
+
+// archivedFiles lists the processed folder's files last
+// modified within [start, end), oldest first.
+func archivedFiles(start, end time.Time) ([]*drive.File, error) {
+	q := fmt.Sprintf(`'%s' in parents and trashed = false and modifiedTime >= '%s' and modifiedTime < '%s'`,
+		cfg.ProcessedFolder, start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	var fls []*drive.File
+	err := drv.Files.List().Q(q).Fields("nextPageToken, files(id,name,parents,modifiedTime)").
+		Pages(runContext, func(fl *drive.FileList) error {
+			fls = append(fls, fl.Files...)
+			return nil
+		})
+	sort.SliceStable(fls, func(i, j int) bool {
+		// RFC 3339 timestamps in UTC sort lexically
+		return fls[i].ModifiedTime < fls[j].ModifiedTime
+	})
+	return fls, err
+}
+
+// replayFiles queues each file's items as they were,
+// skipping the anomaly and rejection checks.
+func replayFiles(fls []*drive.File) {
+	defer wg.Done()
+
+	fetches := fetchFeeds(fls)
+	items := 0
+	for _, fe := range fetches {
+		items += feedItems(fe.vsd)
+	}
+	summary.expect(len(fls), items)
+	for i, f := range fls {
+		echo(fmt.Sprintf("Replaying %s from %s", f.Name, f.ModifiedTime))
+		setRunFile(f.Name)
+		if fetches[i].interrupted {
+			summary.fileDone()
+			continue
+		}
+		if fetches[i].err != nil {
+			failFile(*f, fetches[i].err)
+			summary.fileDone()
+			continue
+		}
+		sendPayloads(fetches[i].vsd, fetches[i].deadline, *f)
+	}
+}
+
+// console reads the answers typed at prompts.
+var console = bufio.NewReader(os.Stdin)
+
+// confirm asks a yes/no question on the console.
+func confirm(question string) bool {
+	fmt.Printf("%s Type yes to continue: ", question)
+	answer, _ := console.ReadString('\n')
+	return strings.TrimSpace(strings.ToLower(answer)) == "yes"
+}
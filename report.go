@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runsTable is the state table of finished runs.
+const runsTable = "runs"
+
+// runRecord is a finished run as kept in history.
+type runRecord struct {
+	ID          string
+	Start       time.Time
+	End         time.Time
+	Files       []string
+	Payloads    int
+	Succeeded   int
+	Items       int
+	ItemsSent   int
+	Errors      []string
+	Spillover   []string
+	Quarantined int
+	P50         time.Duration
+	P95         time.Duration
+	Vendors     map[string]vendorStats `json:",omitempty"`
+	AckLatency  time.Duration          `json:",omitempty"`
+	SLOBreached int                    `json:",omitempty"`
+	Statuses    map[string]int         `json:",omitempty"`
+	Warnings    []string               `json:",omitempty"`
+}
+
+// record converts the summary for the run history.
+func (s *runSummary) record(id string) runRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return runRecord{
+		ID:          id,
+		Start:       s.Start,
+		End:         s.End,
+		Files:       s.Files,
+		Payloads:    s.Payloads,
+		Succeeded:   s.Succeeded,
+		Items:       s.Items,
+		ItemsSent:   s.ItemsSent,
+		Errors:      s.Errors,
+		Spillover:   s.Spillover,
+		Quarantined: len(s.Quarantined),
+		P50:         s.percentile(50),
+		P95:         s.percentile(95),
+		Vendors:     s.Vendors,
+		AckLatency:  s.AckLatency,
+		SLOBreached: s.SLOBreached,
+		Statuses:    s.Statuses,
+		Warnings:    s.Warnings,
+	}
+}
+
+// saveRun appends the finished run to the history.
+func saveRun(r runRecord) {
+	if err := appendRecord(runsTable, r); err != nil {
+		log.Printf("Unable to save run history: %v", err)
+	}
+}
+
+// loadRuns reads the runs that started since the given time.
+func loadRuns(since time.Time) ([]runRecord, error) {
+	var runs []runRecord
+	err := scanRecords(runsTable, func(raw json.RawMessage) error {
+		var r runRecord
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return err
+		}
+		if !r.Start.Before(since) {
+			runs = append(runs, r)
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// reportCmd prints or exports the run history, or with
+// -vendors each vendor's feed record.
+//
+//	drive2sku report [-last 30d] [-format table|csv|json] [-vendors]
+func reportCmd(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	last := fs.String("last", "30d", "how far back to report, e.g. 30d or 12h")
+	format := fs.String("format", "table", "table, csv, or json")
+	vendors := fs.Bool("vendors", false, "report each vendor's arrivals, sizes, error rate, and latency")
+	fs.Parse(args)
+
+	window, err := parseAge(*last)
+	if err != nil {
+		log.Fatalf("Unable to parse -last %q: %v", *last, err)
+	}
+	readConfig()
+	readBufferSettings()
+	since := time.Now().Add(-window)
+	runs, err := loadRuns(since)
+	if err != nil {
+		log.Fatalf("Unable to read run history: %v", err)
+	}
+	if *vendors {
+		slas, err := vendorSLAs(since, runs)
+		if err != nil {
+			log.Fatalf("Unable to read vendor arrivals: %v", err)
+		}
+		printVendorSLAs(slas, *format)
+		return
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(runs)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"id", "start", "end", "files", "payloads", "succeeded", "items", "items_sent", "errors", "p50_ms", "p95_ms"})
+		for _, r := range runs {
+			w.Write([]string{
+				r.ID, r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339),
+				strings.Join(r.Files, ";"),
+				strconv.Itoa(r.Payloads), strconv.Itoa(r.Succeeded),
+				strconv.Itoa(r.Items), strconv.Itoa(r.ItemsSent),
+				strconv.Itoa(len(r.Errors)),
+				strconv.FormatInt(int64(r.P50/time.Millisecond), 10),
+				strconv.FormatInt(int64(r.P95/time.Millisecond), 10),
+			})
+		}
+		w.Flush()
+	case "table":
+		printRuns(runs)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q\n", *format)
+		os.Exit(2)
+	}
+}
+
+// printRuns writes the history as a console table with totals.
+func printRuns(runs []runRecord) {
+	fmt.Printf("%-16s %9s %5s %11s %13s %6s %8s\n", "START", "TOOK", "FILES", "PAYLOADS", "ITEMS", "ERRORS", "P95")
+	var files, pls, ok, items, sent, errs int
+	for _, r := range runs {
+		fmt.Printf("%-16s %9v %5d %5d/%-5d %6d/%-6d %6d %8v\n",
+			r.Start.Format("2006-01-02 15:04"), r.End.Sub(r.Start).Round(time.Second),
+			len(r.Files), r.Succeeded, r.Payloads, r.ItemsSent, r.Items, len(r.Errors),
+			r.P95.Round(time.Millisecond))
+		files += len(r.Files)
+		pls += r.Payloads
+		ok += r.Succeeded
+		items += r.Items
+		sent += r.ItemsSent
+		errs += len(r.Errors)
+	}
+	echo(fmt.Sprintf("%d runs, %d files, %d/%d payloads, %d/%d items, %d errors",
+		len(runs), files, ok, pls, sent, items, errs))
+	if d := disabledVendors(); len(d) > 0 {
+		echo("Disabled vendors: " + strings.Join(d, ", "))
+	}
+}
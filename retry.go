@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transient reports whether a failed post may succeed if sent
+// again: network errors and timeouts, throttling, and server
+// errors. Anything else, such as an unknown SKU or warehouse,
+// would fail the same way.
+func transient(res *http.Response, body ResponseBody, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests,
+		res.StatusCode == http.StatusRequestTimeout,
+		res.StatusCode >= 500:
+		return true
+	case res.StatusCode >= 400:
+		return false
+	}
+	return strings.EqualFold(body.Status, "Throttled")
+}
+
+// retryPayload queues a payload to be posted again after a
+// delay, reporting false once its retries are used up.
+func retryPayload(pl Payload, res *http.Response, err error) bool {
+	if pl.attempts >= cfg.Retries {
+		return false
+	}
+	pl.attempts++
+	d := retryDelay(res, pl.attempts)
+
+	why := fmt.Sprint(err)
+	if err == nil {
+		why = res.Status
+	}
+	say(fmt.Sprintf("Retrying payload (%d/%d) in %v; %s", len(pl.Items), cap(pl.Items), d, why))
+
+	// retries join the last-payload channel, which the relay
+	// falls back to reading whenever its buffer runs dry; a
+	// retry still waiting at shutdown or the deadline is
+	// given up on
+	ch := lastPlCh
+	wg.Add(1)
+	go func() {
+		ctx := pl.context()
+		select {
+		case <-time.After(d):
+			select {
+			case ch <- pl:
+				return
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+		summary.recordError(fmt.Sprintf("gave up on %d items waiting to retry: %v", len(pl.Items), ctx.Err()))
+		pl.batch.done(false)
+		wg.Done()
+	}()
+	return true
+}
+
+// retryDelay waits as long as SKUVault's Retry-After asks,
+// otherwise RetryBackoff doubled for every earlier attempt.
+func retryDelay(res *http.Response, attempt int) time.Duration {
+	if res != nil {
+		if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && s > 0 {
+			return time.Duration(s) * time.Second
+		}
+	}
+	return cfg.RetryBackoff.Duration << uint(attempt-1)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readRows reads a tabular vendor file into header-led rows,
+// choosing the format by the file's extension.
+func readRows(name string, r io.Reader) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return csvRows(r)
+	case ".xlsx":
+		return xlsxRows(r)
+	case ".json":
+		return jsonRows(r)
+	}
+	return nil, fmt.Errorf("unsupported file type %q", filepath.Ext(name))
+}
+
+// jsonRows flattens a JSON array of flat objects into rows,
+// the union of all keys forming the header.
+func jsonRows(r io.Reader) ([][]string, error) {
+	var objs []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&objs); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var header []string
+	for _, o := range objs {
+		for k := range o {
+			if !seen[k] {
+				seen[k] = true
+				header = append(header, k)
+			}
+		}
+	}
+	sort.Strings(header)
+
+	rows := [][]string{header}
+	for _, o := range objs {
+		row := make([]string, len(header))
+		for i, k := range header {
+			if v, ok := o[k]; ok && v != nil {
+				row[i] = fmt.Sprint(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// xlsxRows reads the first worksheet of an XLSX workbook.
+// It understands shared and inline strings and plain values,
+// which covers what vendor spreadsheet exports contain.
+func xlsxRows(r io.Reader) ([][]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			SI []struct {
+				T string `xml:"t"`
+				R []struct {
+					T string `xml:"t"`
+				} `xml:"r"`
+			} `xml:"si"`
+		}
+		if err := unzipXML(f, &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.SI {
+			s := si.T
+			for _, r := range si.R {
+				s += r.T
+			}
+			shared = append(shared, s)
+		}
+	}
+
+	f, ok := files["xl/worksheets/sheet1.xml"]
+	if !ok {
+		return nil, fmt.Errorf("workbook has no first sheet")
+	}
+	var ws struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				V      string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := unzipXML(f, &ws); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(ws.Rows))
+	for _, wr := range ws.Rows {
+		var row []string
+		for i, c := range wr.Cells {
+			col := i
+			if c.Ref != "" {
+				col = xlsxColumn(c.Ref)
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.V)
+				if err != nil || n >= len(shared) {
+					return nil, fmt.Errorf("bad shared string %q at %s", c.V, c.Ref)
+				}
+				row[col] = shared[n]
+			case "inlineStr":
+				row[col] = c.Inline
+			default:
+				row[col] = c.V
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// unzipXML decodes one XML member of a zip archive.
+func unzipXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// xlsxColumn turns a cell reference like "AB12"
+// into its zero-based column index.
+func xlsxColumn(ref string) int {
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A') + 1
+	}
+	return n - 1
+}
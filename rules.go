@@ -0,0 +1,533 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Rules are small per-vendor statements run on each item
+// as its file is decoded, after Defaults and LocationTemplate:
+//
+//	skip if Sku startsWith "SAMPLE-"
+//	if Quantity > 500 then Quantity = 500
+//	LocationCode = "BIN-" + LocationCode
+//
+// Expressions compare with == != < <= > >=, startsWith,
+// endsWith, and contains; combine with and, or, not, and
+// parentheses; and do arithmetic with + - * /, + also
+// joining strings. Fields are Sku, Quantity, WarehouseID,
+// LocationCode, LotNumber, and ExpirationDate. A bare value
+// after then sets Quantity, so "if Quantity > 500 then 500"
+// caps it the same way.
+
+// rule is one compiled statement.
+type rule struct {
+	src  string
+	cond expr // nil always applies
+	skip bool
+	set  string
+	to   expr
+}
+
+// vendorRules holds each vendor's compiled Rules.
+var vendorRules map[string][]rule
+
+// compileRules compiles every vendor's Rules, failing
+// on the first that does not parse.
+func compileRules() {
+	vendorRules = map[string][]rule{}
+	for vendor, vs := range settings {
+		for _, src := range vs.Rules {
+			r, err := parseRule(src)
+			if err != nil {
+				log.Fatalf("Unable to parse %s rule %q: %v", vendor, src, err)
+			}
+			vendorRules[vendor] = append(vendorRules[vendor], r)
+		}
+	}
+}
+
+// applyRules runs each vendor's rules over its items,
+// dropping those a rule skips. An item keyed by its SKU, as
+// in native JSON feeds, moves to its new SKU's key when a
+// rule renames it, taking the place of any item already
+// there.
+func applyRules(vsd map[string]map[string]Item) error {
+	for vendor, items := range vsd {
+		rs := vendorRules[vendor]
+		if len(rs) == 0 {
+			continue
+		}
+		renamed := map[string]Item{}
+	items:
+		for key, iv := range items {
+			sku := iv.Sku
+			for _, r := range rs {
+				skip, err := r.apply(&iv)
+				if err != nil {
+					return fmt.Errorf("%s rule %q on %s: %v", vendor, r.src, iv.Sku, err)
+				}
+				if skip {
+					delete(items, key)
+					continue items
+				}
+			}
+			if iv.Sku != sku && key == sku {
+				delete(items, key)
+				renamed[iv.Sku] = iv
+				continue
+			}
+			items[key] = iv
+		}
+		for key, iv := range renamed {
+			items[key] = iv
+		}
+	}
+	return nil
+}
+
+// apply runs a rule on one item, reporting whether the
+// item is to be skipped.
+func (r rule) apply(iv *Item) (bool, error) {
+	if r.cond != nil {
+		v, err := r.cond.eval(iv)
+		if err != nil {
+			return false, err
+		}
+		if v.kind != kindBool {
+			return false, errors.New("condition is not true or false")
+		}
+		if !v.b {
+			return false, nil
+		}
+	}
+	if r.skip {
+		return true, nil
+	}
+	v, err := r.to.eval(iv)
+	if err != nil {
+		return false, err
+	}
+	return false, setField(iv, r.set, v)
+}
+
+// value is a rule's working value: a number, a string,
+// or true or false.
+type value struct {
+	kind int
+	n    int
+	s    string
+	b    bool
+}
+
+const (
+	kindNum = iota
+	kindStr
+	kindBool
+)
+
+func (v value) String() string {
+	switch v.kind {
+	case kindNum:
+		return strconv.Itoa(v.n)
+	case kindStr:
+		return strconv.Quote(v.s)
+	}
+	return strconv.FormatBool(v.b)
+}
+
+// ruleFields are the item fields a rule can read and set,
+// and whether each is a number.
+var ruleFields = map[string]bool{
+	"Sku":            false,
+	"Quantity":       true,
+	"WarehouseID":    true,
+	"LocationCode":   false,
+	"LotNumber":      false,
+	"ExpirationDate": false,
+}
+
+func getField(iv *Item, name string) value {
+	switch name {
+	case "Sku":
+		return value{kind: kindStr, s: iv.Sku}
+	case "Quantity":
+		return value{kind: kindNum, n: iv.Quantity}
+	case "WarehouseID":
+		return value{kind: kindNum, n: iv.WarehouseID}
+	case "LocationCode":
+		return value{kind: kindStr, s: iv.LocationCode}
+	case "LotNumber":
+		return value{kind: kindStr, s: iv.LotNumber}
+	}
+	return value{kind: kindStr, s: iv.ExpirationDate}
+}
+
+func setField(iv *Item, name string, v value) error {
+	if num := ruleFields[name]; num && v.kind != kindNum || !num && v.kind != kindStr {
+		return fmt.Errorf("cannot set %s to %v", name, v)
+	}
+	switch name {
+	case "Sku":
+		iv.Sku = v.s
+	case "Quantity":
+		iv.Quantity = v.n
+	case "WarehouseID":
+		iv.WarehouseID = v.n
+	case "LocationCode":
+		iv.LocationCode = v.s
+	case "LotNumber":
+		iv.LotNumber = v.s
+	case "ExpirationDate":
+		iv.ExpirationDate = v.s
+	}
+	return nil
+}
+
+// expr is a parsed expression.
+type expr interface {
+	eval(iv *Item) (value, error)
+}
+
+type (
+	literal  value
+	field    string
+	negation struct{ x expr }
+	not      struct{ x expr }
+	binary   struct {
+		op   string
+		l, r expr
+	}
+)
+
+func (e literal) eval(*Item) (value, error)  { return value(e), nil }
+func (e field) eval(iv *Item) (value, error) { return getField(iv, string(e)), nil }
+func (e negation) eval(iv *Item) (value, error) {
+	v, err := e.x.eval(iv)
+	if err != nil {
+		return v, err
+	}
+	if v.kind != kindNum {
+		return v, fmt.Errorf("cannot negate %v", v)
+	}
+	return value{kind: kindNum, n: -v.n}, nil
+}
+
+func (e not) eval(iv *Item) (value, error) {
+	v, err := e.x.eval(iv)
+	if err != nil {
+		return v, err
+	}
+	if v.kind != kindBool {
+		return v, fmt.Errorf("cannot apply not to %v", v)
+	}
+	return value{kind: kindBool, b: !v.b}, nil
+}
+
+func (e binary) eval(iv *Item) (value, error) {
+	l, err := e.l.eval(iv)
+	if err != nil {
+		return l, err
+	}
+	// and and or stop at the left side when it decides
+	if (e.op == "and" || e.op == "or") && l.kind == kindBool && l.b == (e.op == "or") {
+		return l, nil
+	}
+	r, err := e.r.eval(iv)
+	if err != nil {
+		return r, err
+	}
+	mismatch := fmt.Errorf("cannot apply %s to %v and %v", e.op, l, r)
+	if l.kind != r.kind {
+		return value{}, mismatch
+	}
+
+	switch e.op {
+	case "and", "or":
+		if l.kind != kindBool {
+			return value{}, mismatch
+		}
+		return r, nil
+	case "==":
+		return value{kind: kindBool, b: l == r}, nil
+	case "!=":
+		return value{kind: kindBool, b: l != r}, nil
+	case "startsWith", "endsWith", "contains":
+		if l.kind != kindStr {
+			return value{}, mismatch
+		}
+		var b bool
+		switch e.op {
+		case "startsWith":
+			b = strings.HasPrefix(l.s, r.s)
+		case "endsWith":
+			b = strings.HasSuffix(l.s, r.s)
+		default:
+			b = strings.Contains(l.s, r.s)
+		}
+		return value{kind: kindBool, b: b}, nil
+	case "<", "<=", ">", ">=":
+		var c int
+		switch l.kind {
+		case kindNum:
+			c = l.n - r.n
+		case kindStr:
+			c = strings.Compare(l.s, r.s)
+		default:
+			return value{}, mismatch
+		}
+		b := map[string]bool{"<": c < 0, "<=": c <= 0, ">": c > 0, ">=": c >= 0}[e.op]
+		return value{kind: kindBool, b: b}, nil
+	case "+":
+		if l.kind == kindStr {
+			return value{kind: kindStr, s: l.s + r.s}, nil
+		}
+	}
+	if l.kind != kindNum {
+		return value{}, mismatch
+	}
+	switch e.op {
+	case "+":
+		return value{kind: kindNum, n: l.n + r.n}, nil
+	case "-":
+		return value{kind: kindNum, n: l.n - r.n}, nil
+	case "*":
+		return value{kind: kindNum, n: l.n * r.n}, nil
+	}
+	if r.n == 0 {
+		return value{}, errors.New("division by zero")
+	}
+	return value{kind: kindNum, n: l.n / r.n}, nil
+}
+
+// ruleParser reads one rule from its tokens.
+type ruleParser struct {
+	toks []string
+	pos  int
+}
+
+// parseRule compiles a rule from its source.
+func parseRule(src string) (rule, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return rule{}, err
+	}
+	p := &ruleParser{toks: toks}
+	r := rule{src: src}
+	switch {
+	case p.accept("skip"):
+		if err := p.expect("if"); err != nil {
+			return r, err
+		}
+		r.skip = true
+		r.cond, err = p.or()
+	case p.accept("if"):
+		if r.cond, err = p.or(); err != nil {
+			return r, err
+		}
+		if err := p.expect("then"); err != nil {
+			return r, err
+		}
+		err = p.then(&r)
+	default:
+		err = p.assign(&r)
+	}
+	if err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected %q", p.toks[p.pos])
+	}
+	return r, err
+}
+
+func (p *ruleParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *ruleParser) accept(tok string) bool {
+	if p.peek() == tok {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) expect(tok string) error {
+	if !p.accept(tok) {
+		return fmt.Errorf("expected %q at %q", tok, p.peek())
+	}
+	return nil
+}
+
+func (p *ruleParser) assign(r *rule) error {
+	name := p.peek()
+	if _, ok := ruleFields[name]; !ok {
+		return fmt.Errorf("expected a field to set at %q", name)
+	}
+	p.pos++
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	r.set = name
+	var err error
+	r.to, err = p.or()
+	return err
+}
+
+// then parses what follows then: an assignment, or a bare
+// value, which sets Quantity.
+func (p *ruleParser) then(r *rule) error {
+	if p.pos+1 < len(p.toks) && p.toks[p.pos+1] == "=" {
+		return p.assign(r)
+	}
+	r.set = "Quantity"
+	var err error
+	r.to, err = p.or()
+	return err
+}
+
+func (p *ruleParser) or() (expr, error) {
+	return p.chain(p.and, "or")
+}
+
+func (p *ruleParser) and() (expr, error) {
+	return p.chain(p.negated, "and")
+}
+
+func (p *ruleParser) negated() (expr, error) {
+	if p.accept("not") {
+		x, err := p.negated()
+		return not{x}, err
+	}
+	return p.compare()
+}
+
+func (p *ruleParser) compare() (expr, error) {
+	l, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=", "startsWith", "endsWith", "contains":
+		p.pos++
+		r, err := p.sum()
+		return binary{op, l, r}, err
+	}
+	return l, nil
+}
+
+func (p *ruleParser) sum() (expr, error) {
+	return p.chain(p.product, "+", "-")
+}
+
+func (p *ruleParser) product() (expr, error) {
+	return p.chain(p.unary, "*", "/")
+}
+
+// chain parses operands joined left to right by any
+// of the given operators.
+func (p *ruleParser) chain(next func() (expr, error), ops ...string) (expr, error) {
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, o := range ops {
+			found = found || op == o
+		}
+		if !found {
+			return l, nil
+		}
+		p.pos++
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op, l, r}
+	}
+}
+
+func (p *ruleParser) unary() (expr, error) {
+	if p.accept("-") {
+		x, err := p.unary()
+		return negation{x}, err
+	}
+	tok := p.peek()
+	p.pos++
+	switch {
+	case tok == "":
+		return nil, errors.New("unexpected end of rule")
+	case tok == "(":
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case tok == "true" || tok == "false":
+		return literal{kind: kindBool, b: tok == "true"}, nil
+	case tok[0] == '"':
+		return literal{kind: kindStr, s: tok[1:]}, nil
+	case unicode.IsDigit(rune(tok[0])):
+		n, err := strconv.Atoi(tok)
+		return literal{kind: kindNum, n: n}, err
+	}
+	if _, ok := ruleFields[tok]; ok {
+		return field(tok), nil
+	}
+	return nil, fmt.Errorf("unknown name %q", tok)
+}
+
+// tokenize splits a rule into words, numbers, operators,
+// and strings, the last given as `"` and their contents.
+func tokenize(src string) ([]string, error) {
+	var toks []string
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(rs) && rs[j] != c {
+				j++
+			}
+			if j == len(rs) {
+				return nil, errors.New("unterminated string")
+			}
+			toks = append(toks, `"`+string(rs[i+1:j]))
+			i = j + 1
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		case strings.ContainsRune("=!<>", c):
+			if i+1 < len(rs) && rs[i+1] == '=' {
+				toks = append(toks, string(rs[i:i+2]))
+				i += 2
+				continue
+			}
+			if c == '!' {
+				return nil, errors.New("unexpected !")
+			}
+			toks = append(toks, string(c))
+			i++
+		case strings.ContainsRune("+-*/()", c):
+			toks = append(toks, string(c))
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, tt := range []struct {
+		src, err string
+	}{
+		{`skip Sku == "A"`, `expected "if"`},
+		{`if Quantity > 5 Quantity = 5`, `expected "then"`},
+		{`Color = "red"`, "expected a field to set"},
+		{`Quantity 5`, `expected "="`},
+		{`Quantity = `, "unexpected end of rule"},
+		{`Quantity = (1 + 2`, `expected ")"`},
+		{`Quantity = 1 2`, `unexpected "2"`},
+		{`Sku = "open`, "unterminated string"},
+		{`Sku = Size`, `unknown name "Size"`},
+		{`skip if Quantity ! 5`, "unexpected !"},
+		{`Quantity = 5 % 2`, "unexpected '%'"},
+	} {
+		_, err := parseRule(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parseRule(%q) = %v, want an error with %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestRuleApply(t *testing.T) {
+	base := Item{Sku: "ABC-1", Quantity: 600, WarehouseID: 2, LocationCode: "A1"}
+	for _, tt := range []struct {
+		src  string
+		skip bool
+		want Item
+	}{
+		{`skip if Sku startsWith "ABC"`, true, base},
+		{`skip if Sku startsWith "SAMPLE-"`, false, base},
+		{`if Quantity > 500 then Quantity = 500`, false, Item{Sku: "ABC-1", Quantity: 500, WarehouseID: 2, LocationCode: "A1"}},
+		{`if Quantity > 500 then 500`, false, Item{Sku: "ABC-1", Quantity: 500, WarehouseID: 2, LocationCode: "A1"}},
+		{`if Quantity > 1000 then 500`, false, base},
+		{`LocationCode = "BIN-" + LocationCode`, false, Item{Sku: "ABC-1", Quantity: 600, WarehouseID: 2, LocationCode: "BIN-A1"}},
+		{`Quantity = (Quantity - 100) / 2 * 3`, false, Item{Sku: "ABC-1", Quantity: 750, WarehouseID: 2, LocationCode: "A1"}},
+		{`Quantity = -Quantity + 601`, false, Item{Sku: "ABC-1", Quantity: 1, WarehouseID: 2, LocationCode: "A1"}},
+		{`skip if not (WarehouseID == 2 and Sku endsWith "-1")`, false, base},
+		{`skip if WarehouseID == 3 or Sku contains "C-"`, true, base},
+		{`skip if LocationCode <= "A0"`, false, base},
+		{`if LotNumber != "" then ExpirationDate = "2030-01-01"`, false, base},
+		{`skip if true`, true, base},
+	} {
+		r, err := parseRule(tt.src)
+		if err != nil {
+			t.Errorf("parseRule(%q): %v", tt.src, err)
+			continue
+		}
+		iv := base
+		skip, err := r.apply(&iv)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if skip != tt.skip || iv != tt.want {
+			t.Errorf("%q gave %+v, skip %v; want %+v, skip %v", tt.src, iv, skip, tt.want, tt.skip)
+		}
+	}
+}
+
+func TestRuleApplyErrors(t *testing.T) {
+	for _, tt := range []struct {
+		src, err string
+	}{
+		{`if Quantity then 5`, "not true or false"},
+		{`Quantity = Sku`, "cannot set Quantity"},
+		{`Sku = Quantity`, "cannot set Sku"},
+		{`Quantity = Quantity / 0`, "division by zero"},
+		{`skip if Sku > 5`, "cannot apply >"},
+		{`Quantity = Quantity - "1"`, "cannot apply -"},
+		{`Sku = -Sku`, "cannot negate"},
+		{`skip if not Sku`, "cannot apply not"},
+		{`skip if Quantity startsWith 1`, "cannot apply startsWith"},
+	} {
+		r, err := parseRule(tt.src)
+		if err != nil {
+			t.Errorf("parseRule(%q): %v", tt.src, err)
+			continue
+		}
+		iv := Item{Sku: "ABC-1", Quantity: 5}
+		if _, err := r.apply(&iv); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q gave %v, want an error with %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	defer func(rs map[string][]rule) { vendorRules = rs }(vendorRules)
+	vendorRules = map[string][]rule{}
+	for _, src := range []string{
+		`skip if Sku startsWith "SAMPLE-"`,
+		`if Sku == "OLD-1" then Sku = "NEW-1"`,
+		`if Quantity > 500 then 500`,
+	} {
+		r, err := parseRule(src)
+		if err != nil {
+			t.Fatalf("parseRule(%q): %v", src, err)
+		}
+		vendorRules["acme"] = append(vendorRules["acme"], r)
+	}
+
+	vsd := map[string]map[string]Item{
+		"acme": {
+			"SAMPLE-9": {Sku: "SAMPLE-9", Quantity: 1},
+			"OLD-1":    {Sku: "OLD-1", Quantity: 900},
+			"NEW-1":    {Sku: "NEW-1", Quantity: 3},
+			"KEEP-1":   {Sku: "KEEP-1", Quantity: 7},
+		},
+		"other": {
+			"SAMPLE-9": {Sku: "SAMPLE-9", Quantity: 1},
+		},
+	}
+	if err := applyRules(vsd); err != nil {
+		t.Fatal(err)
+	}
+
+	acme := vsd["acme"]
+	if len(acme) != 2 {
+		t.Fatalf("acme has %d items, want 2: %v", len(acme), acme)
+	}
+	if iv := acme["NEW-1"]; iv.Sku != "NEW-1" || iv.Quantity != 500 {
+		t.Errorf("renamed item is %+v under NEW-1, want the capped OLD-1", iv)
+	}
+	if _, ok := acme["OLD-1"]; ok {
+		t.Error("renamed item kept its old key")
+	}
+	if iv := acme["KEEP-1"]; iv.Quantity != 7 {
+		t.Errorf("untouched item is %+v", iv)
+	}
+	if len(vsd["other"]) != 1 {
+		t.Error("another vendor's items were changed")
+	}
+}
+
+func TestApplyRulesRowKeys(t *testing.T) {
+	defer func(rs map[string][]rule) { vendorRules = rs }(vendorRules)
+	r, err := parseRule(`Sku = "X-" + Sku`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vendorRules = map[string][]rule{"acme": {r}}
+
+	// mapped files key items by row, which stays their origin
+	vsd := map[string]map[string]Item{"acme": {"2": {Sku: "A"}, "3": {Sku: "B"}}}
+	if err := applyRules(vsd); err != nil {
+		t.Fatal(err)
+	}
+	if vsd["acme"]["2"].Sku != "X-A" || vsd["acme"]["3"].Sku != "X-B" {
+		t.Errorf("row-keyed items are %v", vsd["acme"])
+	}
+}
+
+func TestApplyRulesError(t *testing.T) {
+	defer func(rs map[string][]rule) { vendorRules = rs }(vendorRules)
+	r, err := parseRule(`Quantity = Quantity / WarehouseID`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vendorRules = map[string][]rule{"acme": {r}}
+
+	vsd := map[string]map[string]Item{"acme": {"A": {Sku: "A", Quantity: 4}}}
+	err = applyRules(vsd)
+	if err == nil || !strings.Contains(err.Error(), `acme rule "Quantity = Quantity / WarehouseID" on A`) {
+		t.Errorf("applyRules gave %v", err)
+	}
+}
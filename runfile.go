@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// localVendor is the vendor named for a local file, whose
+// mapping reads it whatever the file is called.
+var localVendor string
+
+// runCmd pushes one local file through mapping, validation,
+// and posting, for manual corrections that cannot wait on
+// Drive. Files with invalid items are not posted at all.
+//
+//	drive2sku run -file ./fix.json [-vendor acme]
+func runCmd(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	path := fs.String("file", "", "local vendor file to post")
+	vendor := fs.String("vendor", "", "vendor the file is for; its mapping reads the file")
+	fs.Parse(args)
+	if *path == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku run -file <path> [-vendor name]")
+		os.Exit(2)
+	}
+
+	readConfig()
+	readBufferSettings()
+	if *vendor != "" {
+		if _, ok := settings[*vendor]; !ok {
+			log.Fatalf("Vendor %q has no buffer settings", *vendor)
+		}
+		localVendor = *vendor
+	}
+
+	vsd := readLocalFile(*path)
+	if !confirmPost(*path, feedItems(vsd)) {
+		fmt.Println("Nothing posted.")
+		return
+	}
+	initDriveAndVault()
+
+	defer timeTrack(time.Now())
+	saveSnapshots(vsd)
+	postLocal(*path, vsd)
+}
+
+// postLocal relays a local file's decoded items, with no
+// Drive file to finish once they are answered.
+func postLocal(path string, vsd map[string]map[string]Item) {
+	relay(func() {
+		defer wg.Done()
+		echo(fmt.Sprintf("Processing %s", path))
+		setRunFile(path)
+		summary.expect(1, feedItems(vsd))
+		sendPayloads(vsd, time.Time{})
+		summary.fileDone()
+	})
+}
+
+// readLocalFile decodes and validates a local file, keeping
+// only localVendor's items when one is named.
+func readLocalFile(path string) map[string]map[string]Item {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Unable to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	vsd, err := decodeFile(path, f)
+	if err != nil {
+		log.Fatalf("Unable to decode %s: %v", path, err)
+	}
+	if localVendor != "" {
+		items, ok := vsd[localVendor]
+		if !ok {
+			log.Fatalf("%s has no items for %s", path, localVendor)
+		}
+		vsd = map[string]map[string]Item{localVendor: items}
+	}
+
+	bad := 0
+	for _, vendor := range vendorOrder(vsd) {
+		if _, known := settings[vendor]; !known {
+			log.Fatalf("Vendor %q in %s has no buffer settings", vendor, path)
+		}
+		for key, iv := range vsd[vendor] {
+			if err := validateItem(iv); err != nil {
+				say(fmt.Sprintf("%s/%s: %v", vendor, key, err))
+				bad++
+			}
+		}
+	}
+	if bad > 0 {
+		log.Fatalf("%d invalid items in %s; nothing posted", bad, path)
+	}
+	return vsd
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sampleItems logs the first SampleItems items of a decoded
+// file, in file order, with the fields named in SampleRedact
+// masked. Samples ship at DEBUG severity and are echoed for
+// -vv.
+func sampleItems(vsd map[string]map[string]Item) {
+	if cfg.SampleItems <= 0 {
+		return
+	}
+	type entry struct {
+		key string
+		iv  Item
+	}
+	var es []entry
+	for _, items := range vsd {
+		for key, iv := range items {
+			es = append(es, entry{key, iv})
+		}
+	}
+	sort.Slice(es, func(i, j int) bool { return keyLess(es[i].key, es[j].key) })
+	if len(es) > cfg.SampleItems {
+		es = es[:cfg.SampleItems]
+	}
+	for _, e := range es {
+		msg := fmt.Sprintf("Sample %s: %s %s", e.iv.origin, e.iv.vendor, formatSample(e.iv))
+		echoAt(levelDebug, msg)
+		shipLog("DEBUG", msg)
+	}
+}
+
+// keyLess orders item keys numerically when both are row
+// numbers, otherwise as strings.
+func keyLess(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// formatSample writes an item's fields as name=value pairs,
+// masking redacted ones and leaving out unset lot fields.
+func formatSample(iv Item) string {
+	fields := []struct{ name, value string }{
+		{"Sku", iv.Sku},
+		{"Quantity", strconv.Itoa(iv.Quantity)},
+		{"WarehouseID", strconv.Itoa(iv.WarehouseID)},
+		{"LocationCode", iv.LocationCode},
+		{"LotNumber", iv.LotNumber},
+		{"ExpirationDate", iv.ExpirationDate},
+	}
+	var parts []string
+	for _, f := range fields {
+		if f.value == "" && (f.name == "LotNumber" || f.name == "ExpirationDate") {
+			continue
+		}
+		if redacted(f.name) {
+			f.value = "***"
+		}
+		parts = append(parts, f.name+"="+f.value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// redacted reports whether SampleRedact names a field.
+func redacted(field string) bool {
+	for _, r := range cfg.SampleRedact {
+		if strings.EqualFold(r, field) {
+			return true
+		}
+	}
+	return false
+}
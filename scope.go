@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// driveScopes are the Drive scopes DriveScope may name.
+var driveScopes = map[string]string{
+	"drive":      drive.DriveScope,
+	"drive.file": drive.DriveFileScope,
+}
+
+// driveScope is the OAuth scope Drive is authorized with.
+func driveScope() string {
+	s, ok := driveScopes[cfg.DriveScope]
+	if !ok {
+		log.Fatalf("Unknown DriveScope %q; use \"drive\" or \"drive.file\"", cfg.DriveScope)
+	}
+	return s
+}
+
+// explainDrive adds advice to Drive errors caused by the
+// authorized scope or folder sharing, so they say what to
+// change instead of only that access was denied.
+func explainDrive(err error) error {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok {
+		return err
+	}
+	for _, e := range gerr.Errors {
+		switch e.Reason {
+		case "insufficientPermissions", "insufficientScopes", "ACCESS_TOKEN_SCOPE_INSUFFICIENT":
+			return fmt.Errorf("%v: the %q scope does not allow this; share the folders as the "+
+				"README describes, or set DriveScope to \"drive\" and delete the cached Drive token", err, cfg.DriveScope)
+		}
+	}
+	if gerr.Code == 404 && cfg.DriveScope == "drive.file" {
+		return fmt.Errorf("%v: with the \"drive.file\" scope only files this app created or was "+
+			"shared through the picker are visible; see the README's Drive access section", err)
+	}
+	if gerr.Code == 403 {
+		return fmt.Errorf("%v: check that the folder is shared with the authorized account as an editor", err)
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+)
+
+// SecretsConfig picks where credentials and cached tokens
+// are kept: "file" (the default) reads and writes them at
+// their usual paths, "vault" in a HashiCorp Vault KV v2
+// engine, and "gcp" in Google Secret Manager. Remote secrets
+// are named after the file, e.g. "client_secret-json".
+type SecretsConfig struct {
+	Backend string
+
+	// VaultAddr and VaultToken default to $VAULT_ADDR and
+	// $VAULT_TOKEN; secrets live at VaultMount/VaultPath/name.
+	VaultAddr  string
+	VaultToken string
+	VaultMount string
+	VaultPath  string
+
+	// GCPProject holds the Secret Manager secrets, reached
+	// with application default credentials.
+	GCPProject string
+}
+
+// secretStore keeps named secrets.
+type secretStore interface {
+	get(name string) ([]byte, error)
+	put(name string, b []byte) error
+}
+
+var (
+	secrets     secretStore
+	secretsOnce sync.Once
+)
+
+// secretBackend gives the configured secret store.
+func secretBackend() secretStore {
+	secretsOnce.Do(func() {
+		s := cfg.Secrets
+		switch s.Backend {
+		case "", "file":
+			secrets = fileSecrets{}
+		case "vault":
+			if s.VaultAddr == "" {
+				s.VaultAddr = os.Getenv("VAULT_ADDR")
+			}
+			if s.VaultToken == "" {
+				s.VaultToken = os.Getenv("VAULT_TOKEN")
+			}
+			if s.VaultMount == "" {
+				s.VaultMount = "secret"
+			}
+			if s.VaultPath == "" {
+				s.VaultPath = "drive2sku"
+			}
+			secrets = vaultSecrets{s}
+		case "gcp":
+			client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/cloud-platform")
+			if err != nil {
+				log.Fatalf("Unable to authenticate to Secret Manager: %v", err)
+			}
+			secrets = gcpSecrets{s.GCPProject, client}
+		default:
+			log.Fatalf("Unknown secrets backend %q; use \"file\", \"vault\", or \"gcp\"", s.Backend)
+		}
+	})
+	return secrets
+}
+
+// readSecret reads the credential kept at path, or under
+// its name in a remote store.
+func readSecret(path string) ([]byte, error) {
+	if _, ok := secretBackend().(fileSecrets); ok {
+		return ioutil.ReadFile(path)
+	}
+	return secretBackend().get(secretName(path))
+}
+
+// writeSecret saves a credential at path, or under its
+// name in a remote store.
+func writeSecret(path string, b []byte) error {
+	if _, ok := secretBackend().(fileSecrets); ok {
+		return writeFileAtomic(path, b, 0600)
+	}
+	return secretBackend().put(secretName(path), b)
+}
+
+// secretName names a credential file's remote secret.
+func secretName(path string) string {
+	return strings.Replace(filepath.Base(path), ".", "-", -1)
+}
+
+// fileSecrets keeps secrets as plain files.
+type fileSecrets struct{}
+
+func (fileSecrets) get(name string) ([]byte, error) { return ioutil.ReadFile(name) }
+func (fileSecrets) put(name string, b []byte) error { return writeFileAtomic(name, b, 0600) }
+
+// vaultSecrets keeps secrets in a Vault KV v2 engine,
+// each as {"value": "<base64>"}.
+type vaultSecrets struct {
+	SecretsConfig
+}
+
+// url addresses a secret's data endpoint.
+func (v vaultSecrets) url(name string) string {
+	return fmt.Sprintf("%s/v1/%s/data/%s/%s", strings.TrimRight(v.VaultAddr, "/"), v.VaultMount, v.VaultPath, name)
+}
+
+func (v vaultSecrets) get(name string) ([]byte, error) {
+	req, err := http.NewRequest("GET", v.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.VaultToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("vault answered %s for %s", res.Status, name)
+	}
+	var body struct {
+		Data struct {
+			Data struct{ Value string }
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(body.Data.Data.Value)
+}
+
+func (v vaultSecrets) put(name string, b []byte) error {
+	data, _ := json.Marshal(map[string]interface{}{
+		"data": map[string]string{"value": base64.StdEncoding.EncodeToString(b)},
+	})
+	req, err := http.NewRequest("POST", v.url(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.VaultToken)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("vault answered %s for %s", res.Status, name)
+	}
+	return nil
+}
+
+// gcpSecrets keeps secrets in Google Secret Manager, each
+// write adding a new version.
+type gcpSecrets struct {
+	project string
+	client  *http.Client
+}
+
+// url addresses a secret in the project.
+func (g gcpSecrets) url(name string) string {
+	return fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s", g.project, name)
+}
+
+func (g gcpSecrets) get(name string) ([]byte, error) {
+	res, err := g.client.Get(g.url(name) + "/versions/latest:access")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("Secret Manager answered %s for %s", res.Status, name)
+	}
+	var body struct {
+		Payload struct{ Data string }
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(body.Payload.Data)
+}
+
+func (g gcpSecrets) put(name string, b []byte) error {
+	// create the secret on first write; a conflict
+	// means it already exists
+	create, _ := json.Marshal(map[string]interface{}{
+		"replication": map[string]interface{}{"automatic": map[string]interface{}{}},
+	})
+	res, err := g.client.Post(fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets?secretId=%s",
+		g.project, name), "application/json", bytes.NewReader(create))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 400 && res.StatusCode != http.StatusConflict {
+		return fmt.Errorf("Secret Manager answered %s creating %s", res.Status, name)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"payload": map[string]string{"data": base64.StdEncoding.EncodeToString(b)},
+	})
+	res, err = g.client.Post(g.url(name)+":addVersion", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("Secret Manager answered %s for %s", res.Status, name)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sentry is the configured error aggregator, nil when off.
+var sentry *sentryClient
+
+// sentryClient posts events to Sentry's store endpoint.
+type sentryClient struct {
+	store  string
+	auth   string
+	client *http.Client
+}
+
+// runCtx carries what the pipeline is working on,
+// attached to every reported error.
+var runCtx struct {
+	sync.Mutex
+	run  string
+	file string
+}
+
+// setRunFile records the file currently being processed,
+// adding it to the run's summary.
+func setRunFile(name string) {
+	runCtx.Lock()
+	runCtx.file = name
+	runCtx.Unlock()
+	summary.addFile(name)
+}
+
+// initSentry parses the DSN; log output, which in this
+// program only ever carries errors, is then mirrored to it.
+func initSentry(dsn string) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		log.Fatalf("Unable to parse Sentry DSN %q", dsn)
+	}
+	i := strings.LastIndex(u.Path, "/")
+	project := u.Path[i+1:]
+
+	sentry = &sentryClient{
+		store: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, u.Path[:i], project),
+		auth: fmt.Sprintf("Sentry sentry_version=7, sentry_client=drive2sku/1.0, sentry_key=%s",
+			u.User.Username()),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// reportItemErrors sends a non-fatal SKUVault rejection.
+func reportItemErrors(status int, msg string, extra map[string]interface{}) {
+	if sentry == nil {
+		return
+	}
+	sentry.capture("warning", fmt.Sprintf("SKUVault rejected items (%d): %s", status, msg),
+		[]string{"skuvault-items", msg}, extra)
+}
+
+// capture sends one event; delivery failures are dropped
+// rather than logged, which would loop back here.
+func (c *sentryClient) capture(level, msg string, fingerprint []string, extra map[string]interface{}) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	host, _ := os.Hostname()
+
+	runCtx.Lock()
+	tags := map[string]string{"run": runCtx.run, "file": runCtx.file}
+	runCtx.Unlock()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   time.Now().UTC().Format("2006-01-02T15:04:05"),
+		"level":       level,
+		"logger":      "drive2sku",
+		"platform":    "go",
+		"server_name": host,
+		"environment": cfg.SentryEnvironment,
+		"message":     msg,
+		"fingerprint": fingerprint,
+		"tags":        tags,
+		"extra":       extra,
+	})
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("POST", c.store, bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+	res, err := c.client.Do(req)
+	if err == nil {
+		res.Body.Close()
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// invokeCh allows one invocation's run at a time; triggers
+// arriving mid-run are turned away so the caller retries.
+var invokeCh = make(chan struct{}, 1)
+
+// connectOnce connects to Drive and SKUVault on the first
+// invocation, reused by warm instances afterwards.
+var connectOnce sync.Once
+
+// invoke performs one full run for a serverless trigger,
+// reporting false if a run was already in progress.
+func invoke(event []byte) bool {
+	return invokeWith(syncDrive)
+}
+
+// invokeWith connects if needed and performs run,
+// unless another invocation's run is in progress.
+func invokeWith(run func()) bool {
+	select {
+	case invokeCh <- struct{}{}:
+	default:
+		return false
+	}
+	defer func() { <-invokeCh }()
+
+	connect()
+	run()
+	return true
+}
+
+// connect reads settings and connects to Drive and SKUVault
+// the first time it is called.
+func connect() {
+	connectOnce.Do(func() {
+		readConfig()
+		initDriveAndVault()
+		readBufferSettings()
+	})
+}
+
+// handleInvoke is the HTTP entry point used by Cloud Run,
+// Cloud Functions, Cloud Scheduler, and Pub/Sub push
+// subscriptions; any POST triggers a run.
+func handleInvoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST to trigger a run", http.StatusMethodNotAllowed)
+		return
+	}
+	event, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !invoke(event) {
+		// Pub/Sub push and Scheduler both retry with backoff
+		http.Error(w, "a run is already in progress", http.StatusTooManyRequests)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveCmd listens for HTTP triggers on $PORT, as serverless
+// containers expect, or the -addr given. Besides full runs at
+// "/", it subscribes to Drive change notifications at "/drive"
+// (direct web_hook) and "/pubsub" (Pub/Sub push), and
+// releases held files at "/approve".
+//
+//	drive2sku serve [-addr :8080]
+func serveCmd(args []string) {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":"+port, "listen address")
+	fs.Parse(args)
+
+	readConfig()
+	startDebug()
+	handlePauseSignals()
+
+	// a private mux keeps the diagnostics handlers
+	// off the publicly reachable trigger port
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleInvoke)
+	mux.HandleFunc("/drive", handleDriveNotice)
+	mux.HandleFunc("/pubsub", handlePubSubNotice)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/approve", handleApprove)
+	go keepWatching()
+	go watchNotices()
+	echo(fmt.Sprintf("Listening for triggers on %s", *addr))
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// runLambda serves invocations through the AWS Lambda
+// runtime API, for deployment as a custom "bootstrap".
+func runLambda(api string) {
+	base := "http://" + api + "/2018-06-01/runtime/invocation/"
+	for {
+		res, err := http.Get(base + "next")
+		if err != nil {
+			log.Fatalf("Unable to get next Lambda invocation: %v", err)
+		}
+		id := res.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		event, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			log.Fatalf("Unable to read Lambda invocation: %v", err)
+		}
+
+		if invoke(event) {
+			lambdaPost(base+id+"/response", map[string]string{"status": "ok"})
+		} else {
+			lambdaPost(base+id+"/error", map[string]string{
+				"errorType":    "Busy",
+				"errorMessage": "a run is already in progress",
+			})
+		}
+	}
+}
+
+// lambdaPost reports an invocation's outcome to the runtime API.
+func lambdaPost(url string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Fatalf("Unable to encode Lambda result: %v", err)
+	}
+	res, err := http.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Fatalf("Unable to report Lambda result: %v", err)
+	}
+	res.Body.Close()
+}
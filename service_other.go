@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// serviceCmd is only meaningful under the Windows Service
+// Control Manager; elsewhere run "drive2sku daemon" under
+// the platform's own supervisor.
+func serviceCmd(args []string) {
+	fmt.Fprintln(os.Stderr, "Service management is only supported on Windows; use \"drive2sku daemon\"")
+	os.Exit(1)
+}
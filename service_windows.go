@@ -0,0 +1,225 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// svcName is the name registered with the Service Control Manager.
+const svcName = "Drive2Sku"
+
+// serviceCmd manages the program as a Windows service.
+//
+//	drive2sku service install [-interval 1h]
+//	drive2sku service uninstall|start|stop
+//	drive2sku service run [-interval 1h]  (invoked by the SCM)
+func serviceCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku service install|uninstall|start|stop|run")
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(args[1:])
+	case "uninstall":
+		err = uninstallService()
+	case "start":
+		err = startService()
+	case "stop":
+		err = controlService(svc.Stop, svc.Stopped)
+	case "run":
+		err = runService(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown service action %q\n", args[0])
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Unable to %s service: %v", args[0], err)
+	}
+}
+
+// installService registers the executable to start automatically,
+// passing any daemon flags through to "service run".
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(svcName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", svcName)
+	}
+
+	s, err := m.CreateService(svcName, exe, mgr.Config{
+		DisplayName: "Drive2Sku",
+		Description: "Relays vendor inventory files from Google Drive to SKUVault.",
+		StartType:   mgr.StartAutomatic,
+	}, append([]string{"service", "run"}, args...)...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	echo(fmt.Sprintf("Installed service %s", svcName))
+	return nil
+}
+
+// uninstallService removes the service registration.
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(svcName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", svcName)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	echo(fmt.Sprintf("Uninstalled service %s", svcName))
+	return nil
+}
+
+// startService asks the SCM to start the installed service.
+func startService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(svcName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", svcName)
+	}
+	defer s.Close()
+
+	return s.Start()
+}
+
+// controlService sends a control request and waits,
+// up to a run's worth of time, for the expected state.
+func controlService(c svc.Cmd, to svc.State) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(svcName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", svcName)
+	}
+	defer s.Close()
+
+	status, err := s.Control(c)
+	if err != nil {
+		return err
+	}
+	timeout := time.Now().Add(time.Hour)
+	for status.State != to {
+		if time.Now().After(timeout) {
+			return fmt.Errorf("timed out waiting for state %d", to)
+		}
+		time.Sleep(time.Second)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runService is the SCM entry point. Relative config and
+// credential files resolve next to the executable, since
+// services start in the system directory.
+func runService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(filepath.Dir(exe)); err != nil {
+		return err
+	}
+	return svc.Run(svcName, &service{interval: daemonFlags("service run", args)})
+}
+
+// service adapts the daemon to the svc.Handler interface.
+type service struct {
+	interval time.Duration
+}
+
+// Execute runs the daemon until the SCM asks it to stop,
+// cutting an in-flight run short the way a signal does and
+// reporting stopped once it has drained.
+func (s *service) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runDaemon(s.interval, stop)
+		close(done)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: accepts}
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				say("Shutting down; leaving unfinished files pending")
+				shutdown()
+				close(stop)
+				drainService(done, changes)
+				return false, 0
+			}
+		case <-done:
+			return false, 0
+		}
+	}
+}
+
+// stopHint is how long the SCM is told each step of
+// draining may take before it hears from the service again.
+const stopHint = 10 * time.Second
+
+// drainService keeps the SCM waiting while the cancelled
+// run drains, sending StopPending with a rising CheckPoint
+// so it does not give up and kill the process mid-post.
+func drainService(done <-chan struct{}, changes chan<- svc.Status) {
+	tick := time.NewTicker(stopHint / 2)
+	defer tick.Stop()
+	for cp := uint32(1); ; cp++ {
+		changes <- svc.Status{State: svc.StopPending, CheckPoint: cp, WaitHint: uint32(stopHint / time.Millisecond)}
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// claimFiles narrows fetched files to those this process
+// has claimed, so no two instances or runs post the same one.
+// Files that failed to fetch are kept, unclaimed, to be failed.
+func claimFiles(fls []*drive.File, fetches []fetched) ([]*drive.File, []fetched) {
+	idx := make([]int, len(fls))
+	for i := range idx {
+		idx[i] = i
+	}
+	keep := claimIndexes(fls, fetches, idx)
+
+	var mine []*drive.File
+	var fetchedMine []fetched
+	for i, f := range fls {
+		if keep[i] {
+			mine = append(mine, f)
+			fetchedMine = append(fetchedMine, fetches[i])
+		}
+	}
+	return mine, fetchedMine
+}
+
+// claimIndexes claims the files at the given indexes,
+// reporting which of them are this process's to handle.
+// Free or expired files are stamped with a claim, then re-read
+// after a pause; Drive has no compare-and-set, so the last
+// writer standing owns a file. Read-only runs claim nothing
+// and handle every file.
+func claimIndexes(fls []*drive.File, fetches []fetched, idx []int) map[int]bool {
+	if *readOnly {
+		keep := make(map[int]bool, len(idx))
+		for _, i := range idx {
+			keep[i] = true
+		}
+		return keep
+	}
+	me := identity()
+	now := time.Now().UTC()
+	props := map[string]string{
+		"claimedBy":    me,
+		"claimExpires": now.Add(cfg.ClaimDuration.Duration).Format(time.RFC3339),
+	}
+
+	keep := map[int]bool{}
+	var stamped []int
+	for _, i := range idx {
+		f := fls[i]
+		if fetches[i].err != nil {
+			keep[i] = true
+			continue
+		}
+		if by := f.AppProperties["claimedBy"]; by != "" && by != me {
+			exp, err := time.Parse(time.RFC3339, f.AppProperties["claimExpires"])
+			if err == nil && now.Before(exp) {
+				continue
+			}
+		}
+		if _, err := driveFor(f.Id).Files.Update(f.Id, &drive.File{AppProperties: props}).Do(); err != nil {
+			log.Printf("Unable to claim %s (%s): %v", f.Name, f.Id, err)
+			continue
+		}
+		stamped = append(stamped, i)
+	}
+
+	if len(stamped) > 0 {
+		// let racing instances' writes land before checking
+		time.Sleep(3 * time.Second)
+	}
+
+	claimed := 0
+	for _, i := range stamped {
+		f := fls[i]
+		g, err := driveFor(f.Id).Files.Get(f.Id).Fields("appProperties").Do()
+		if err != nil {
+			log.Printf("Unable to confirm claim on %s (%s): %v", f.Name, f.Id, err)
+			continue
+		}
+		if g.AppProperties["claimedBy"] == me {
+			keep[i] = true
+			claimed++
+		}
+	}
+	if len(stamped) > 0 {
+		echo(fmt.Sprintf("Claimed %d of %d files", claimed, len(idx)))
+	}
+	return keep
+}
+
+// claimer claims files as their downloads finish, in
+// batches of whatever is ready, so posting can start on
+// the first file while later ones are still downloading.
+type claimer struct {
+	mu      sync.Mutex
+	fls     []*drive.File
+	fetches []fetched
+	ready   []chan struct{}
+	decided map[int]bool
+	keep    map[int]bool
+}
+
+// newClaimer claims files fetched in the background.
+func newClaimer(fls []*drive.File, fetches []fetched, ready []chan struct{}) *claimer {
+	return &claimer{fls: fls, fetches: fetches, ready: ready, decided: map[int]bool{}, keep: map[int]bool{}}
+}
+
+// mine waits for file i's download, claiming it along with
+// every later file already fetched, and reports whether it
+// is this process's to handle.
+func (c *claimer) mine(i int) bool {
+	<-c.ready[i]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.decided[i] {
+		var idx []int
+		for j := i; j < len(c.fls); j++ {
+			if c.decided[j] {
+				continue
+			}
+			select {
+			case <-c.ready[j]:
+				idx = append(idx, j)
+			default:
+			}
+		}
+		for j, ok := range claimIndexes(c.fls, c.fetches, idx) {
+			c.keep[j] = ok
+		}
+		for _, j := range idx {
+			c.decided[j] = true
+		}
+	}
+	return c.keep[i]
+}
+
+// pending lists the files at the given indexes that may
+// still be this process's: claimed, or not yet tried.
+func (c *claimer) pending(idx []int) []*drive.File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var fls []*drive.File
+	for _, j := range idx {
+		if !c.decided[j] || c.keep[j] {
+			fls = append(fls, c.fls[j])
+		}
+	}
+	return fls
+}
+
+// throttleInterval is the time between this instance's posts.
+// Sharded instances split SKUVault's budget evenly, so each
+// posts at 1/Shards of the single-instance rate.
+func throttleInterval() time.Duration {
+	shards := cfg.Shards
+	if shards < 1 {
+		shards = 1
+	}
+	return time.Duration(shards) * throttle * time.Millisecond
+}
+
+// postsPerTick is how many payloads may start posting in
+// each throttle interval.
+func postsPerTick() int {
+	return limit(cfg.PostsPerTick)
+}
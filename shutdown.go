@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/net/context"
+)
+
+// shutdownCtx ends on the first SIGINT or SIGTERM, cutting
+// short every Drive and SKUVault call made under it.
+var shutdownCtx, shutdown = context.WithCancel(context.Background())
+
+// handleShutdown cancels in-flight calls on the first
+// SIGINT or SIGTERM, leaving unfinished files pending;
+// a second signal exits at once.
+func handleShutdown() {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		say("Shutting down; interrupt again to exit at once")
+		shutdown()
+		<-sigCh
+		os.Exit(1)
+	}()
+}
+
+// stopping reports whether the program is shutting down.
+func stopping() bool {
+	return shutdownCtx.Err() != nil
+}
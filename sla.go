@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// vendorStats is one vendor's share of a run: items queued,
+// items SKUVault rejected, and the longest a file of theirs
+// took from landing in Drive to being queued.
+type vendorStats struct {
+	Items    int
+	Rejected int
+	Latency  time.Duration
+
+	// Defaulted counts items that relied on the vendor's Defaults.
+	Defaulted int `json:",omitempty"`
+
+	// AckLatency is the longest from a file landing to
+	// SKUVault acknowledging its items.
+	AckLatency time.Duration `json:",omitempty"`
+}
+
+// vendorQueued notes a vendor's items queued from the files.
+func (s *runSummary) vendorQueued(vendor string, items int, fs []drive.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.Vendors[vendor]
+	st.Items += items
+	for _, f := range fs {
+		if d := time.Since(modifiedTime(f)); d > st.Latency {
+			st.Latency = d
+		}
+	}
+	s.Vendors[vendor] = st
+}
+
+// vendorDefaulted notes a vendor's items queued with
+// one of its Defaults filled in.
+func (s *runSummary) vendorDefaulted(vendor string, items int) {
+	if items == 0 {
+		return
+	}
+	s.mu.Lock()
+	st := s.Vendors[vendor]
+	st.Defaulted += items
+	s.Vendors[vendor] = st
+	s.mu.Unlock()
+}
+
+// vendorRejected notes one item SKUVault rejected.
+func (s *runSummary) vendorRejected(vendor string) {
+	if vendor == "" {
+		return
+	}
+	s.mu.Lock()
+	st := s.Vendors[vendor]
+	st.Rejected++
+	s.Vendors[vendor] = st
+	s.mu.Unlock()
+}
+
+// vendorSLA is a vendor's feed record over a report window.
+type vendorSLA struct {
+	Vendor     string
+	Files      int
+	LastFile   time.Time
+	AvgBytes   int
+	Items      int
+	Rejected   int
+	ErrorPct   float64
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+
+	// Disabled notes a vendor switched off in buffers.json.
+	Disabled bool `json:",omitempty"`
+}
+
+// vendorSLAs totals each vendor's arrivals and run shares
+// since the given time.
+func vendorSLAs(since time.Time, runs []runRecord) ([]vendorSLA, error) {
+	byVendor := map[string]*vendorSLA{}
+	get := func(vendor string) *vendorSLA {
+		if byVendor[vendor] == nil {
+			byVendor[vendor] = &vendorSLA{Vendor: vendor}
+		}
+		return byVendor[vendor]
+	}
+
+	bytes := map[string]int{}
+	err := scanRecords(arrivalsTable, func(raw json.RawMessage) error {
+		var a arrival
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return err
+		}
+		if a.Time.Before(since) {
+			return nil
+		}
+		v := get(a.Vendor)
+		v.Files++
+		bytes[a.Vendor] += a.Bytes
+		if a.Modified.After(v.LastFile) {
+			v.LastFile = a.Modified
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	latencies := map[string][]time.Duration{}
+	for _, r := range runs {
+		for vendor, st := range r.Vendors {
+			v := get(vendor)
+			v.Items += st.Items
+			v.Rejected += st.Rejected
+			latencies[vendor] = append(latencies[vendor], st.Latency)
+		}
+	}
+
+	for _, vendor := range disabledVendors() {
+		get(vendor).Disabled = true
+	}
+
+	var slas []vendorSLA
+	for _, vendor := range sortedVendors(byVendor) {
+		v := byVendor[vendor]
+		if v.Files > 0 {
+			v.AvgBytes = bytes[vendor] / v.Files
+		}
+		if v.Items > 0 {
+			v.ErrorPct = 100 * float64(v.Rejected) / float64(v.Items)
+		}
+		if ds := latencies[vendor]; len(ds) > 0 {
+			var sum time.Duration
+			for _, d := range ds {
+				sum += d
+				if d > v.MaxLatency {
+					v.MaxLatency = d
+				}
+			}
+			v.AvgLatency = sum / time.Duration(len(ds))
+		}
+		slas = append(slas, *v)
+	}
+	return slas, nil
+}
+
+// sortedVendors orders the vendor names of a tally.
+func sortedVendors(m map[string]*vendorSLA) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printVendorSLAs writes the vendor records in a format.
+func printVendorSLAs(slas []vendorSLA, format string) {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(slas)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"vendor", "files", "last_file", "avg_bytes", "items", "rejected", "error_pct", "avg_latency_s", "max_latency_s"})
+		for _, v := range slas {
+			last := ""
+			if !v.LastFile.IsZero() {
+				last = v.LastFile.Format(time.RFC3339)
+			}
+			w.Write([]string{
+				v.Vendor, strconv.Itoa(v.Files), last, strconv.Itoa(v.AvgBytes),
+				strconv.Itoa(v.Items), strconv.Itoa(v.Rejected),
+				strconv.FormatFloat(v.ErrorPct, 'f', 2, 64),
+				strconv.FormatInt(int64(v.AvgLatency/time.Second), 10),
+				strconv.FormatInt(int64(v.MaxLatency/time.Second), 10),
+			})
+		}
+		w.Flush()
+	case "table":
+		fmt.Printf("%-16s %5s %-16s %9s %8s %8s %7s %10s %10s\n",
+			"VENDOR", "FILES", "LAST FILE", "AVG SIZE", "ITEMS", "REJECTED", "ERR%", "AVG LAT", "MAX LAT")
+		for _, v := range slas {
+			last := "never"
+			if !v.LastFile.IsZero() {
+				last = v.LastFile.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%-16s %5d %-16s %9d %8d %8d %6.1f%% %10v %10v\n",
+				v.Vendor, v.Files, last, v.AvgBytes, v.Items, v.Rejected, v.ErrorPct,
+				v.AvgLatency.Round(time.Minute), v.MaxLatency.Round(time.Minute))
+		}
+		if d := disabledVendors(); len(d) > 0 {
+			fmt.Printf("\nDisabled: %s\n", strings.Join(d, ", "))
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q\n", format)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// landedAt gives when the batch's oldest file landed in
+// Drive, zero for payloads not from Drive files.
+func (b *batch) landedAt() time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+	return b.landed
+}
+
+// recordAck notes how long acknowledged items took from
+// their file landing in Drive to SKUVault accepting them.
+// Callers hold the summary's lock.
+func (s *runSummary) recordAck(pl Payload, acked map[string]int) {
+	landed := pl.batch.landedAt()
+	if landed.IsZero() || len(acked) == 0 {
+		return
+	}
+	d := time.Since(landed)
+	if d > s.AckLatency {
+		s.AckLatency = d
+	}
+	for vendor, n := range acked {
+		if slo := cfg.LatencySLO.Duration; slo > 0 && d > slo {
+			s.SLOBreached += n
+		}
+		if vendor == "" {
+			continue
+		}
+		st := s.Vendors[vendor]
+		if d > st.AckLatency {
+			st.AckLatency = d
+		}
+		s.Vendors[vendor] = st
+	}
+}
+
+// sloRule is the alert rule LatencySLO stands for.
+func sloRule() (AlertRule, bool) {
+	if cfg.LatencySLO.Duration <= 0 {
+		return AlertRule{}, false
+	}
+	return AlertRule{Name: "latency_slo", Metric: "ack_latency_hours", Above: cfg.LatencySLO.Hours()}, true
+}
+
+// sloNote describes the run's latency SLO breaches, if any.
+// Callers hold the summary's lock.
+func (s *runSummary) sloNote() string {
+	if s.SLOBreached == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d items acknowledged past the %v latency SLO (worst %v)",
+		s.SLOBreached, cfg.LatencySLO.Duration, s.AckLatency.Round(time.Minute))
+}
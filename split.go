@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+)
+
+// Allocation is one warehouse's share of a vendor's stock:
+// a Fixed quantity, filled first, or a Percent of what is
+// left after the fixed shares.
+type Allocation struct {
+	WarehouseID int
+
+	// LocationCode replaces the item's own when set.
+	LocationCode string `json:",omitempty"`
+
+	Percent float64 `json:",omitempty"`
+	Fixed   int     `json:",omitempty"`
+}
+
+// validateSplits rejects splits whose percentages do not
+// account for the whole of what the fixed shares leave.
+func validateSplits() {
+	for vendor, vs := range settings {
+		if len(vs.Split) == 0 {
+			continue
+		}
+		total := 0.0
+		for _, a := range vs.Split {
+			if a.WarehouseID <= 0 || a.Percent < 0 || a.Fixed < 0 {
+				log.Fatalf("%s Split needs a WarehouseID and no negative shares", vendor)
+			}
+			total += a.Percent
+		}
+		if math.Abs(total-100) > 0.001 {
+			log.Fatalf("%s Split percentages add up to %g, not 100", vendor, total)
+		}
+	}
+}
+
+// splitItem fans an item out over its vendor's Split, one
+// item per allocation; without a split it is left whole.
+// Percentage shares are rounded so they add up exactly,
+// the units left over going to the largest remainders.
+func splitItem(vendor string, iv Item) []Item {
+	split := settings[vendor].Split
+	if len(split) == 0 {
+		return []Item{iv}
+	}
+
+	qty := make([]int, len(split))
+	left := iv.Quantity
+	for i, a := range split {
+		if a.Fixed > 0 {
+			qty[i] = a.Fixed
+			if qty[i] > left {
+				qty[i] = left
+			}
+			left -= qty[i]
+		}
+	}
+	rest := left
+	frac := make([]float64, len(split))
+	for i, a := range split {
+		share := float64(rest) * a.Percent / 100
+		qty[i] += int(share)
+		left -= int(share)
+		frac[i] = share - math.Floor(share)
+	}
+	order := make([]int, len(split))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(x, y int) bool { return frac[order[x]] > frac[order[y]] })
+	for _, i := range order {
+		if left <= 0 {
+			break
+		}
+		if split[i].Percent > 0 {
+			qty[i]++
+			left--
+		}
+	}
+
+	out := make([]Item, len(split))
+	for i, a := range split {
+		part := iv
+		part.WarehouseID = a.WarehouseID
+		if a.LocationCode != "" {
+			part.LocationCode = a.LocationCode
+		}
+		part.Quantity = qty[i]
+		out[i] = part
+	}
+	return out
+}
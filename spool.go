@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// spoolDir holds decoded files set aside, in the state
+// directory, to keep the heap within MemoryItems.
+const spoolDir = "spool"
+
+// spooledFeed is a spooled file's items, with the keys of
+// those that relied on vendor defaults and the units still
+// unconverted, which JSON would otherwise lose.
+type spooledFeed struct {
+	Items     map[string]map[string]Item
+	Defaulted map[string][]string          `json:",omitempty"`
+	Units     map[string]map[string]string `json:",omitempty"`
+}
+
+// spoolFeed gathers a file's items for the spool.
+func spoolFeed(vsd map[string]map[string]Item) spooledFeed {
+	sf := spooledFeed{vsd, map[string][]string{}, map[string]map[string]string{}}
+	for vendor, items := range vsd {
+		for key, iv := range items {
+			if iv.defaulted {
+				sf.Defaulted[vendor] = append(sf.Defaulted[vendor], key)
+			}
+			if iv.uom != "" {
+				if sf.Units[vendor] == nil {
+					sf.Units[vendor] = map[string]string{}
+				}
+				sf.Units[vendor][key] = iv.uom
+			}
+		}
+	}
+	return sf
+}
+
+// heldItems counts the decoded items held in memory
+// across the files of a run.
+var heldItems int64
+
+// holdItems counts a decoded file's items against
+// MemoryItems, spilling them to the spool instead when
+// they would pass it.
+func holdItems(f drive.File, fe *fetched) {
+	n := feedItems(fe.vsd)
+	if cfg.MemoryItems <= 0 || atomic.AddInt64(&heldItems, int64(n)) <= int64(cfg.MemoryItems) {
+		fe.held = n
+		return
+	}
+	atomic.AddInt64(&heldItems, -int64(n))
+
+	path := filepath.Join(statePath(spoolDir), runCtx.run+"-"+f.Id+".json")
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		err = writeJSON(path, spoolFeed(fe.vsd))
+	}
+	if err != nil {
+		log.Printf("Unable to spool %s; keeping it in memory: %v", f.Name, err)
+		atomic.AddInt64(&heldItems, int64(n))
+		fe.held = n
+		return
+	}
+	echoAt(levelVerbose, fmt.Sprintf("Spooled %s (%d items) to disk", f.Name, n))
+	fe.vsd, fe.spooled = nil, path
+}
+
+// restoreItems reads a spooled file's items back into
+// memory for posting.
+func restoreItems(f drive.File, fe *fetched) error {
+	if fe.spooled == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(fe.spooled)
+	if err != nil {
+		return err
+	}
+	var sf spooledFeed
+	if err := json.Unmarshal(b, &sf); err != nil {
+		return err
+	}
+	os.Remove(fe.spooled)
+	vsd := sf.Items
+	for vendor, keys := range sf.Defaulted {
+		for _, key := range keys {
+			iv := vsd[vendor][key]
+			iv.defaulted = true
+			vsd[vendor][key] = iv
+		}
+	}
+	for vendor, units := range sf.Units {
+		for key, uom := range units {
+			iv := vsd[vendor][key]
+			iv.uom = uom
+			vsd[vendor][key] = iv
+		}
+	}
+	stampOrigin(f.Name, vsd)
+	fe.vsd, fe.spooled = vsd, ""
+	fe.held = feedItems(vsd)
+	atomic.AddInt64(&heldItems, int64(fe.held))
+	return nil
+}
+
+// releaseItems stops counting a file's items once they are
+// queued or set aside, dropping any spooled copy.
+func releaseItems(fe *fetched) {
+	atomic.AddInt64(&heldItems, -int64(fe.held))
+	fe.held = 0
+	if fe.spooled != "" {
+		os.Remove(fe.spooled)
+		fe.spooled = ""
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// stagingDir holds each downloaded file until it is done,
+// by Drive id, so a run cut short by a crash picks the
+// file up again without downloading it twice.
+const stagingDir = "staging"
+
+// stageFile keeps a downloaded file in the staging area.
+func stageFile(f drive.File, b []byte) {
+	if err := os.MkdirAll(statePath(stagingDir), 0700); err != nil {
+		log.Printf("Unable to create staging area: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(statePath(stagingDir), f.Id), b, 0600); err != nil {
+		log.Printf("Unable to stage %s: %v", f.Name, err)
+	}
+}
+
+// staged gives a file's staged copy left by an earlier run,
+// if it still matches the file Drive lists: the same size
+// and checksum. Files without a checksum are downloaded
+// again, since their copy cannot be told from a newer one.
+func staged(f drive.File) ([]byte, bool) {
+	if f.Md5Checksum == "" {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(filepath.Join(statePath(stagingDir), f.Id))
+	if err != nil || verifyDownload(f, b) != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// unstage drops a finished file's staged copy.
+func unstage(f drive.File) {
+	os.Remove(filepath.Join(statePath(stagingDir), f.Id))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// arrivalsTable records each vendor file as it comes in.
+const arrivalsTable = "arrivals"
+
+// arrival is one vendor's file taken into a run,
+// with the file's size and the vendor's items in it.
+type arrival struct {
+	Time     time.Time
+	Vendor   string
+	File     string
+	Modified time.Time
+	Bytes    int
+	Items    int
+}
+
+// recordArrival notes the vendors a decoded file came from.
+func recordArrival(f drive.File, size int, vsd map[string]map[string]Item) {
+	mod := fileTime(f)
+	for vendor, items := range vsd {
+		a := arrival{time.Now(), vendor, f.Name, mod, size, len(items)}
+		if err := appendRecord(arrivalsTable, a); err != nil {
+			log.Printf("Unable to record %s arrival: %v", vendor, err)
+		}
+	}
+}
+
+// modifiedTime is when a file last changed in Drive,
+// now if Drive did not say.
+func modifiedTime(f drive.File) time.Time {
+	mod, err := time.Parse(time.RFC3339, f.ModifiedTime)
+	if err != nil {
+		return time.Now()
+	}
+	return mod
+}
+
+// lastArrivals gives each vendor's newest file time, and
+// when arrivals were first recorded at all.
+func lastArrivals() (map[string]time.Time, time.Time, error) {
+	last := map[string]time.Time{}
+	var since time.Time
+	err := scanRecords(arrivalsTable, func(raw json.RawMessage) error {
+		var a arrival
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return err
+		}
+		if since.IsZero() || a.Time.Before(since) {
+			since = a.Time
+		}
+		if a.Modified.After(last[a.Vendor]) {
+			last[a.Vendor] = a.Modified
+		}
+		return nil
+	})
+	return last, since, err
+}
+
+// staleAfter is how long a vendor may go without a file.
+func staleAfter(vendor string) time.Duration {
+	if settings[vendor].Disabled {
+		return 0
+	}
+	if d := settings[vendor].StaleAfter; d != nil {
+		return d.Duration
+	}
+	return cfg.StaleAfter.Duration
+}
+
+// staleChecks reports whether any vendor is checked.
+func staleChecks() bool {
+	for vendor := range settings {
+		if staleAfter(vendor) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// staleFeeds alerts for each vendor whose newest file is
+// older than its StaleAfter, or that has sent none since
+// arrivals were first recorded, recording what fired and
+// reporting whether anything did.
+func staleFeeds(fired map[string]time.Time) bool {
+	if !staleChecks() {
+		return false
+	}
+	last, since, err := lastArrivals()
+	if err != nil {
+		log.Printf("Unable to read vendor arrivals: %v", err)
+		return false
+	}
+	if since.IsZero() {
+		return false
+	}
+
+	changed := false
+	for _, vendor := range vendorNames() {
+		limit := staleAfter(vendor)
+		if limit <= 0 {
+			continue
+		}
+		var msg string
+		if t, ok := last[vendor]; ok {
+			if time.Since(t) <= limit {
+				continue
+			}
+			msg = fmt.Sprintf("stale feed: %s's newest file is from %s, over %v ago", vendor, t.Format(time.RFC1123), limit)
+		} else {
+			if time.Since(since) <= limit {
+				continue
+			}
+			msg = fmt.Sprintf("stale feed: %s has sent no file since %s", vendor, since.Format(time.RFC1123))
+		}
+
+		key := "stale feed " + vendor
+		if time.Since(fired[key]) < cfg.AlertRepeat.Duration {
+			continue
+		}
+		alert(msg)
+		fired[key] = time.Now()
+		changed = true
+	}
+	return changed
+}
+
+// vendorNames lists the vendors in buffers.json, sorted.
+func vendorNames() []string {
+	var names []string
+	for vendor := range settings {
+		names = append(names, vendor)
+	}
+	sort.Strings(names)
+	return names
+}
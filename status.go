@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// statusCmd prints the latest run and the state of the
+// local caches.
+//
+//	drive2sku status
+func statusCmd(args []string) {
+	readConfig()
+
+	st, err := checkHealth()
+	switch {
+	case st.Started.IsZero():
+		fmt.Println("Last run:     none recorded")
+	case st.Started.After(st.Finished):
+		fmt.Printf("Last run:     running since %s\n", st.Started.Format(time.RFC1123))
+	default:
+		fmt.Printf("Last run:     %s, took %v\n", st.Started.Format(time.RFC1123),
+			st.Finished.Sub(st.Started).Round(time.Second))
+	}
+	if err != nil {
+		fmt.Printf("Health:       unhealthy, %v\n", err)
+	} else {
+		fmt.Println("Health:       ok")
+	}
+
+	if c := cachedCatalog(); c == nil {
+		fmt.Println("SKU catalog:  not cached")
+	} else {
+		stale := ""
+		if cfg.CatalogRefresh.Duration > 0 && c.age() > cfg.CatalogRefresh.Duration {
+			stale = ", due for refresh"
+		}
+		fmt.Printf("SKU catalog:  %d SKUs, %v old%s\n", len(c.Skus), c.age().Round(time.Minute), stale)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// storeMu serializes writes to the state tables.
+var storeMu sync.Mutex
+
+// The state store keeps each table as a JSON-lines file in
+// the state directory, one record appended per line.
+
+// appendRecord appends one record to a state table.
+func appendRecord(table string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	f, err := os.OpenFile(statePath(table+".jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// scanRecords hands each record of a table, oldest first,
+// to fn; a missing table has no records.
+func scanRecords(table string, fn func(raw json.RawMessage) error) error {
+	f, err := os.Open(statePath(table + ".jsonl"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(json.RawMessage(sc.Bytes())); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
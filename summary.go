@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runSummary accumulates what happened during one run
+// for the report printed when the run finishes.
+type runSummary struct {
+	mu sync.Mutex
+
+	Start time.Time
+	End   time.Time
+
+	// Latencies holds each SKUVault post's round trip.
+	Latencies []time.Duration
+
+	Payloads  int
+	Succeeded int
+	Items     int
+	ItemsSent int
+
+	// Files and Errors list what was processed and
+	// each rejection SKUVault answered with.
+	Files  []string
+	Errors []string
+
+	// FilesTotal, FilesDone, and ItemsTotal track progress
+	// against what the run expects to send.
+	FilesTotal int
+	FilesDone  int
+	ItemsTotal int
+
+	// Quarantined lists items held back for unknown warehouses
+	// or for review.
+	Quarantined []quarantined
+
+	// Spillover lists files left for the next run
+	// because the run deadline was reached.
+	Spillover []string
+
+	// Vendors tallies each vendor's items, rejects,
+	// and latency.
+	Vendors map[string]vendorStats
+
+	// AckLatency is the longest an acknowledged item took
+	// from its file landing in Drive; SLOBreached counts the
+	// items that took longer than LatencySLO.
+	AckLatency  time.Duration
+	SLOBreached int
+
+	// Statuses tallies SKUVault's answers by code and status
+	// text; Warnings keeps each warning it gave, once.
+	Statuses map[string]int
+	Warnings []string
+
+	// sent holds the quantities SKUVault accepted.
+	sent map[itemKey]position
+}
+
+// summary is the current run's summary.
+var summary = newSummary()
+
+// newSummary starts an empty summary from now.
+func newSummary() *runSummary {
+	return &runSummary{Start: time.Now(), Vendors: map[string]vendorStats{}}
+}
+
+// recordPost notes one SKUVault post's outcome.
+func (s *runSummary) recordPost(d time.Duration, items int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Latencies = append(s.Latencies, d)
+	s.Payloads++
+	s.Items += items
+	if ok {
+		s.Succeeded++
+		s.ItemsSent += items
+	}
+}
+
+// addFile notes a file taken into the run.
+func (s *runSummary) addFile(name string) {
+	s.mu.Lock()
+	s.Files = append(s.Files, name)
+	s.mu.Unlock()
+}
+
+// recordError notes an error reported during the run.
+func (s *runSummary) recordError(msg string) {
+	s.mu.Lock()
+	s.Errors = append(s.Errors, msg)
+	s.mu.Unlock()
+}
+
+// clean reports whether the run left nothing behind: every
+// post succeeded, nothing spilled over, and no errors.
+func (s *runSummary) clean() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Succeeded == s.Payloads && len(s.Spillover) == 0 && len(s.Errors) == 0
+}
+
+// finish stamps the end of the run.
+func (s *runSummary) finish() {
+	s.mu.Lock()
+	s.End = time.Now()
+	s.mu.Unlock()
+}
+
+// snapshot copies the running counts for diagnostics.
+func (s *runSummary) snapshot() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]interface{}{
+		"Start":       s.Start,
+		"Payloads":    s.Payloads,
+		"Succeeded":   s.Succeeded,
+		"Items":       s.Items,
+		"ItemsSent":   s.ItemsSent,
+		"AckLatency":  s.AckLatency.String(),
+		"SLOBreached": s.SLOBreached,
+	}
+}
+
+// percentile returns the nearest-rank p-th percentile latency.
+// Callers hold the summary's lock.
+func (s *runSummary) percentile(p float64) time.Duration {
+	if len(s.Latencies) == 0 {
+		return 0
+	}
+	ds := append([]time.Duration(nil), s.Latencies...)
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	i := int(p/100*float64(len(ds))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(ds) {
+		i = len(ds) - 1
+	}
+	return ds[i]
+}
+
+// print reports the run's throughput and SKUVault health.
+func (s *runSummary) print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.Spillover) > 0 {
+		defer say(fmt.Sprintf("Deadline reached; %d files spill over to the next run", len(s.Spillover)))
+	}
+	if d := disabledVendors(); len(d) > 0 {
+		defer say("Disabled vendors: " + strings.Join(d, ", "))
+	}
+	defaulted := 0
+	for _, st := range s.Vendors {
+		defaulted += st.Defaulted
+	}
+	if note := s.sloNote(); note != "" {
+		defer say(note)
+	}
+	if defaulted > 0 {
+		defer say(fmt.Sprintf("%d items relied on vendor defaults", defaulted))
+	}
+	if s.Payloads == 0 {
+		say("No payloads sent")
+		return
+	}
+	rate := 100 * float64(s.Succeeded) / float64(s.Payloads)
+	perMin := float64(s.ItemsSent) / s.End.Sub(s.Start).Minutes()
+	say(fmt.Sprintf("Payloads %d/%d succeeded (%.1f%%); %d/%d items sent",
+		s.Succeeded, s.Payloads, rate, s.ItemsSent, s.Items))
+	say(fmt.Sprintf("Latency p50 %v, p95 %v; %.0f items/min",
+		s.percentile(50).Round(time.Millisecond), s.percentile(95).Round(time.Millisecond), perMin))
+	if len(s.Statuses) > 0 {
+		say("SKUVault answered " + s.statusLine())
+	}
+	if len(s.Warnings) > 0 {
+		say(fmt.Sprintf("%d SKUVault warnings: %s", len(s.Warnings), strings.Join(s.Warnings, "; ")))
+	}
+}
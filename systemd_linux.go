@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// lastBeat is the unix nanosecond time the daemon last
+// proved its loops were still turning.
+var lastBeat int64
+
+// sdNotify sends a state string to systemd when running
+// under a unit with NotifyAccess; otherwise it does nothing.
+func sdNotify(state string) {
+	sock := os.Getenv("NOTIFY_SOCKET")
+	if sock == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
+
+// heartbeat marks the daemon as alive for the watchdog.
+func heartbeat() {
+	atomic.StoreInt64(&lastBeat, time.Now().UnixNano())
+}
+
+// startSystemd reports readiness, starts watchdog keepalives
+// if the unit asks for them, and maps reloads onto pausing.
+func startSystemd() {
+	heartbeat()
+	sdNotify("READY=1")
+
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		go watchdog(time.Duration(usec) * time.Microsecond)
+	}
+
+	// "systemctl reload" toggles pausing of payload dispatch
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			sdNotify("RELOADING=1")
+			setPaused(!isPaused())
+			if isPaused() {
+				sdNotify("READY=1\nSTATUS=Paused")
+			} else {
+				sdNotify("READY=1\nSTATUS=Running")
+			}
+		}
+	}()
+}
+
+// watchdog keeps systemd's watchdog fed at half its timeout,
+// but only while heartbeats show the daemon isn't wedged.
+func watchdog(timeout time.Duration) {
+	for range time.Tick(timeout / 2) {
+		if time.Since(time.Unix(0, atomic.LoadInt64(&lastBeat))) < timeout {
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// sdNotify is a no-op off Linux.
+func sdNotify(state string) {}
+
+// heartbeat is a no-op off Linux.
+func heartbeat() {}
+
+// startSystemd is a no-op off Linux.
+func startSystemd() {}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// skuTokens holds the SKUVault tokens in use, replaced
+// whole when they rotate so no call sees half a swap.
+var skuTokens atomic.Value
+
+// currentTokens gives the SKUVault tokens in use.
+func currentTokens() *SkuTokens {
+	t, _ := skuTokens.Load().(*SkuTokens)
+	if t == nil {
+		return &SkuTokens{}
+	}
+	return t
+}
+
+// setTokens swaps in new SKUVault tokens.
+func setTokens(t *SkuTokens) {
+	skuTokens.Store(t)
+}
+
+// rotateTokens exchanges the account login for fresh tokens
+// once the current ones are older than TokenRotation, caching
+// and swapping them in. A failed exchange keeps the old ones
+// and is tried again on the next run.
+func rotateTokens() {
+	if *mockVault || cfg.TokenRotation.Duration <= 0 {
+		return
+	}
+	if time.Since(currentTokens().Fetched) < cfg.TokenRotation.Duration {
+		return
+	}
+
+	toks, err := exchangeTokens()
+	if err != nil {
+		log.Printf("Unable to rotate SKUVault tokens; keeping the current ones: %v", err)
+		return
+	}
+	_, cacheSkuFile, err := tokenCacheFiles()
+	if err == nil {
+		b, _ := json.Marshal(toks)
+		err = writeSecret(cacheSkuFile, b)
+	}
+	if err != nil {
+		log.Printf("Unable to cache rotated SKUVault tokens: %v", err)
+	}
+	setTokens(toks)
+	echo("Rotated SKUVault tokens")
+}
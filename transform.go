@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Transform hands a vendor's files to an outside converter:
+// a command reading the raw file on stdin, or a URL it is
+// POSTed to. Either answers with the file's items as a JSON
+// array, e.g. [{"Sku": "A1", "Quantity": 4, "WarehouseID": 1}].
+type Transform struct {
+	// Match is a glob on file names, like a Mapping's.
+	Match string
+
+	// Command is the program and its arguments, or URL
+	// the converter to POST to instead; set one.
+	Command []string `json:",omitempty"`
+	URL     string   `json:",omitempty"`
+
+	// Timeout bounds each conversion; it defaults to a minute.
+	Timeout *duration `json:",omitempty"`
+}
+
+// vendorTransform finds the vendor whose transform claims
+// the given file name, or the one named with run -vendor.
+func vendorTransform(name string) (string, *Transform, bool) {
+	if localVendor != "" {
+		if t := settings[localVendor].Transform; t != nil {
+			return localVendor, t, true
+		}
+		return "", nil, false
+	}
+	base := filepath.Base(name)
+	for vendor, vs := range settings {
+		if vs.Transform == nil {
+			continue
+		}
+		if ok, _ := filepath.Match(vs.Transform.Match, base); ok {
+			return vendor, vs.Transform, true
+		}
+	}
+	return "", nil, false
+}
+
+// fileVendor names the vendor whose mapping or transform
+// claims a file, or the vendor its name gives.
+func fileVendor(name string) (string, bool) {
+	if vendor, _, ok := vendorMapping(name); ok {
+		return vendor, true
+	}
+	if vendor, _, ok := vendorTransform(name); ok {
+		return vendor, true
+	}
+	return nameVendor(name)
+}
+
+// validateTransforms rejects transforms that match nothing
+// or have nowhere to send files.
+func validateTransforms() {
+	for vendor, vs := range settings {
+		t := vs.Transform
+		if t == nil {
+			continue
+		}
+		if t.Match == "" {
+			log.Fatalf("%s Transform needs a Match pattern", vendor)
+		}
+		if (len(t.Command) == 0) == (t.URL == "") {
+			log.Fatalf("%s Transform needs either a Command or a URL", vendor)
+		}
+	}
+}
+
+// runTransform converts a file through its transform,
+// keying the items it returns by their position.
+func runTransform(t *Transform, name string, r io.Reader) (map[string]Item, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Minute
+	if t.Timeout != nil {
+		timeout = t.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(runContext, timeout)
+	defer cancel()
+
+	var out []byte
+	if t.URL != "" {
+		out, err = transformURL(ctx, t.URL, name, raw)
+	} else {
+		out, err = transformCommand(ctx, t.Command, raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("transform: %v", err)
+	}
+
+	var ivs []Item
+	if err := json.Unmarshal(out, &ivs); err != nil {
+		return nil, fmt.Errorf("transform answered with something other than an item array: %v", err)
+	}
+	items := make(map[string]Item, len(ivs))
+	for i, iv := range ivs {
+		items[strconv.Itoa(i+1)] = iv
+	}
+	return items, nil
+}
+
+// transformCommand runs a converter with the file on stdin,
+// giving what it wrote to stdout.
+func transformCommand(ctx context.Context, command []string, raw []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(raw)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// transformURL POSTs the file to a converter, giving the
+// body it answers with.
+func transformURL(ctx context.Context, url, name string, raw []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-File-Name", filepath.Base(name))
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s answered %s", url, res.Status)
+	}
+	return b, nil
+}
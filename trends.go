@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// trendDir holds each vendor's recent quantities by
+// stock position.
+const trendDir = "trends"
+
+// trendMinHistory is how many quantities a position needs
+// on record before it is judged against them.
+const trendMinHistory = 3
+
+// trendHistory keeps the quantities seen this run on top
+// of those loaded, per vendor, until saved at the run's end.
+var (
+	trendHistory   = map[string]map[string][]int{}
+	trendHistoryMu sync.Mutex
+)
+
+// trendPath locates a vendor's trend file.
+func trendPath(vendor string) string {
+	return statePath(filepath.Join(trendDir, vendor+".json"))
+}
+
+// trendOutlier reports why an item's quantity stands out
+// from its position's recent quantities: more than
+// TrendFactor times their median, or less than the median
+// divided by it. Only quantities SKUVault accepted are
+// on record, so a held outlier never becomes the norm.
+func trendOutlier(vendor string, iv Item) (string, bool) {
+	if cfg.TrendFactor <= 0 {
+		return "", false
+	}
+	trendHistoryMu.Lock()
+	past := trendsOf(vendor)[keyOf(vendor, iv).String()]
+	trendHistoryMu.Unlock()
+
+	if len(past) < trendMinHistory {
+		return "", false
+	}
+	m := median(past)
+	q := float64(iv.Quantity)
+	if m <= 0 || q <= cfg.TrendFactor*m && q >= m/cfg.TrendFactor {
+		return "", false
+	}
+	return fmt.Sprintf("quantity %d against a recent median of %g", iv.Quantity, m), true
+}
+
+// recordTrend adds a quantity SKUVault accepted to its
+// position's history, keeping the last TrendHistory.
+func recordTrend(iv Item) {
+	if cfg.TrendFactor <= 0 {
+		return
+	}
+	trendHistoryMu.Lock()
+	defer trendHistoryMu.Unlock()
+	h := trendsOf(iv.vendor)
+	key := keyOf(iv.vendor, iv).String()
+	h[key] = append(h[key], iv.Quantity)
+	keep := cfg.TrendHistory
+	if keep < trendMinHistory {
+		keep = trendMinHistory
+	}
+	if n := len(h[key]); n > keep {
+		h[key] = h[key][n-keep:]
+	}
+}
+
+// trendsOf gives a vendor's history, loading it the first
+// time. Callers hold trendHistoryMu.
+func trendsOf(vendor string) map[string][]int {
+	h, ok := trendHistory[vendor]
+	if !ok {
+		h = map[string][]int{}
+		readJSON(trendPath(vendor), &h)
+		trendHistory[vendor] = h
+	}
+	return h
+}
+
+// median gives the middle of a set of quantities.
+func median(qs []int) float64 {
+	s := append([]int(nil), qs...)
+	sort.Ints(s)
+	if len(s)%2 == 1 {
+		return float64(s[len(s)/2])
+	}
+	return float64(s[len(s)/2-1]+s[len(s)/2]) / 2
+}
+
+// saveTrends writes the run's quantities into each vendor's
+// trend file. Runs against the mock vault or read-only
+// runs are left out.
+func saveTrends() {
+	trendHistoryMu.Lock()
+	defer trendHistoryMu.Unlock()
+	if !*mockVault && !*readOnly && len(trendHistory) > 0 {
+		os.MkdirAll(statePath(trendDir), 0700)
+		for vendor, h := range trendHistory {
+			if err := writeJSON(trendPath(vendor), h); err != nil {
+				log.Printf("Unable to save %s trends: %v", vendor, err)
+			}
+		}
+	}
+	trendHistory = map[string]map[string][]int{}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestTrendOutlier(t *testing.T) {
+	oldCfg, oldHistory := cfg, trendHistory
+	defer func() { cfg, trendHistory = oldCfg, oldHistory }()
+	cfg = Config{StateDir: t.TempDir(), TrendFactor: 3, TrendHistory: 10}
+	trendHistory = map[string]map[string][]int{}
+
+	item := func(q int) Item { return Item{Sku: "A", WarehouseID: 1, Quantity: q, vendor: "acme"} }
+	for _, q := range []int{48, 50, 52} {
+		recordTrend(item(q))
+	}
+
+	for _, tt := range []struct {
+		qty int
+		odd bool
+	}{
+		{50, false},
+		{150, false},
+		{151, true},
+		{17, false},
+		{16, true},
+		{0, true},
+	} {
+		if _, odd := trendOutlier("acme", item(tt.qty)); odd != tt.odd {
+			t.Errorf("quantity %d judged odd = %v, want %v", tt.qty, odd, tt.odd)
+		}
+	}
+
+	// judging records nothing, so held outliers never
+	// become the norm
+	for i := 0; i < 5; i++ {
+		trendOutlier("acme", item(0))
+	}
+	if _, odd := trendOutlier("acme", item(0)); !odd {
+		t.Error("repeatedly held zero became the norm")
+	}
+	if n := len(trendHistory["acme"][keyOf("acme", item(0)).String()]); n != 3 {
+		t.Errorf("history holds %d quantities, want the 3 posted", n)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// triggerName is the control file that asks for a run.
+func triggerName() string {
+	if cfg.TriggerName != "" {
+		return cfg.TriggerName
+	}
+	return "RUN_NOW"
+}
+
+// triggerPoll is how often the daemon looks for a trigger.
+func triggerPoll() time.Duration {
+	if cfg.TriggerPoll.Duration > 0 {
+		return cfg.TriggerPoll.Duration
+	}
+	return time.Minute
+}
+
+// stuckTriggers holds the triggers that could not be
+// consumed, such as one another user owns on a shared
+// drive, so each is reported once and never reruns.
+var stuckTriggers = map[string]bool{}
+
+// runTriggered reports whether a trigger file sits in the
+// control folder, consuming every copy so each asks once;
+// only a trigger actually consumed starts a run.
+// Read-only daemons neither look nor consume.
+func runTriggered() bool {
+	if cfg.ControlFolder == "" || *readOnly {
+		return false
+	}
+	name := strings.Replace(triggerName(), `'`, `\'`, -1)
+	q := fmt.Sprintf(`'%s' in parents and name = '%s' and trashed = false`, cfg.ControlFolder, name)
+	fls, err := drv.Files.List().Q(q).Fields("files(id,name,lastModifyingUser(displayName,emailAddress))").Do()
+	if err != nil {
+		log.Printf("Unable to look for a %s trigger: %v", triggerName(), explainDrive(err))
+		return false
+	}
+	run := false
+	for _, f := range fls.Files {
+		if stuckTriggers[f.Id] {
+			continue
+		}
+		if err := drv.Files.Delete(f.Id).Do(); err != nil {
+			stuckTriggers[f.Id] = true
+			log.Printf("Unable to consume trigger %s (%s), ignoring it from now on: %v", f.Name, f.Id, explainDrive(err))
+			continue
+		}
+		by := "someone"
+		if u := f.LastModifyingUser; u != nil {
+			by = u.DisplayName
+			if u.EmailAddress != "" {
+				by += " <" + u.EmailAddress + ">"
+			}
+		}
+		say(fmt.Sprintf("Run triggered by %s from %s", f.Name, by))
+		run = true
+	}
+	return run
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// eachUnit is the unit SKUVault counts stock in.
+const eachUnit = "EA"
+
+// unitFactor gives how many eaches one of a unit holds for
+// a vendor's SKU, from the SKU's own Units entry or else the
+// vendor's "*" entry.
+func unitFactor(vendor, sku, unit string) (int, bool) {
+	if unit == eachUnit {
+		return 1, true
+	}
+	units := settings[vendor].Units
+	if f, ok := units[sku][unit]; ok {
+		return f, true
+	}
+	f, ok := units["*"][unit]
+	return f, ok
+}
+
+// convertUnits turns quantities given in cases, pallets,
+// and the like into eaches. Items whose unit has no factor
+// keep it, so validation flags them and they are never
+// posted as eaches.
+func convertUnits(vsd map[string]map[string]Item) {
+	for vendor, items := range vsd {
+		for key, iv := range items {
+			if iv.uom == "" {
+				continue
+			}
+			if f, ok := unitFactor(vendor, iv.Sku, iv.uom); ok {
+				iv.Quantity *= f
+				iv.uom = ""
+			}
+			items[key] = iv
+		}
+	}
+}
+
+// unitErr describes an item left in a unit with no factor.
+func unitErr(iv Item) error {
+	return fmt.Errorf("unknown unit of measure %q", iv.uom)
+}
+
+// normalUnit reads a unit as written in a feed; blank is eaches.
+func normalUnit(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return eachUnit
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// validateCmd runs local vendor files through decoding,
+// buffer rules, and item validation, printing the payloads
+// that would be sent without touching Drive or SKUVault.
+//
+//	drive2sku validate <file-or-folder>
+func validateCmd(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku validate <file-or-folder>")
+		os.Exit(2)
+	}
+
+	readConfig()
+	readBufferSettings()
+
+	paths, err := localFeeds(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Unable to read %s: %v", fs.Arg(0), err)
+	}
+
+	bad := 0
+	for _, p := range paths {
+		if !validateFile(p) {
+			bad++
+		}
+	}
+
+	echo(fmt.Sprintf("%d/%d files valid", len(paths)-bad, len(paths)))
+	if bad > 0 {
+		os.Exit(1)
+	}
+}
+
+// feedExts are the file extensions read as vendor feeds.
+var feedExts = map[string]bool{".json": true, ".csv": true, ".xlsx": true}
+
+// localFeeds expands a path into the feed files it names;
+// a folder yields every supported file directly inside it.
+func localFeeds(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, fi := range fis {
+		if !fi.IsDir() && feedExts[strings.ToLower(filepath.Ext(fi.Name()))] {
+			paths = append(paths, filepath.Join(path, fi.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// validateFile checks one local file and prints the
+// payloads it would produce, reporting whether it passed.
+func validateFile(path string) bool {
+	echo(fmt.Sprintf("Validating %s", path))
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("  unable to open: %v\n", err)
+		return false
+	}
+	defer f.Close()
+
+	vsd, err := decodeFile(path, f)
+	if err != nil {
+		fmt.Printf("  unable to decode: %v\n", err)
+		return false
+	}
+
+	t := time.Now()
+	ok := true
+	var items []Item
+	for _, vendor := range vendorOrder(vsd) {
+		if _, known := settings[vendor]; !known {
+			fmt.Printf("  vendor %q has no buffer settings\n", vendor)
+		}
+		for key, iv := range vsd[vendor] {
+			if err := validateItem(iv); err != nil {
+				fmt.Printf("  %s/%s: %v\n", vendor, key, err)
+				ok = false
+				continue
+			}
+			items = append(items, splitItem(vendor, applyBuffer(vendor, iv, t))...)
+		}
+	}
+	for _, v := range violations(vsd) {
+		fmt.Printf("  contract: %s\n", v)
+		ok = false
+	}
+	pls := chunkItems(items)
+
+	for n, pl := range pls {
+		fmt.Printf("  payload %d (%d/%d)\n", n+1, len(pl.Items), cap(pl.Items))
+		for _, iv := range pl.Items {
+			fmt.Printf("    %-24s qty=%-6d wh=%-4d loc=%s\n", iv.Sku, iv.Quantity, iv.WarehouseID, iv.LocationCode)
+		}
+	}
+	if len(pls) == 0 {
+		fmt.Println("  no items found")
+		ok = false
+	}
+	return ok
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// vaultClient calls SKUVault functions by name. Its methods
+// take and return Go values, adding the current tokens to
+// each request, waiting out throttling, and decoding the
+// answer the same way for every function.
+type vaultClient struct{}
+
+// vault is the program's SKUVault client.
+var vault vaultClient
+
+// Warehouse is one of SKUVault's warehouses.
+type Warehouse struct {
+	Id   int
+	Code string
+}
+
+// Product is a SKU in SKUVault's catalog.
+type Product struct {
+	Sku          string
+	ReorderPoint int
+	Supplier     string
+}
+
+// Kit is a SKU SKUVault assembles from other SKUs.
+type Kit struct {
+	Sku      string
+	KitLines []kitLine
+}
+
+// Available is a SKU's available quantity in one warehouse.
+type Available struct {
+	Sku               string
+	AvailableQuantity int
+}
+
+// Sale is a sale's line items.
+type Sale struct {
+	SaleItems []struct {
+		Sku      string
+		Quantity int
+	}
+}
+
+// call posts req to a SKUVault function, within its budget,
+// and decodes the answer into out. A throttled call, answered 429 or with a Throttled
+// status, is sent again after Retry-After or RetryBackoff, up
+// to Retries times; the last answer is returned either way.
+// A body that does not decode is an error only on success.
+func (c vaultClient) call(ctx context.Context, fn string, req, out interface{}) (*http.Response, error) {
+	return c.post(ctx, fn, req, out, cfg.Retries)
+}
+
+// send posts req once, leaving a throttled answer to the
+// caller. Payload posts use it, since retryPayload requeues
+// them without holding up a post slot.
+func (c vaultClient) send(ctx context.Context, fn string, req, out interface{}) (*http.Response, error) {
+	return c.post(ctx, fn, req, out, 0)
+}
+
+// post carries out call and send, resending a throttled
+// call up to retries times.
+func (vaultClient) post(ctx context.Context, fn string, req, out interface{}, retries int) (*http.Response, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode %s request: %v", fn, err)
+	}
+	for attempt := 1; ; attempt++ {
+		if err := budgetFor(fn).wait(ctx); err != nil {
+			return nil, err
+		}
+		res, err := vaultRequest(ctx, fn, b)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return res, err
+		}
+		if throttled(res, body) && attempt <= retries {
+			d := retryDelay(res, attempt)
+			echo(fmt.Sprintf("%s throttled; waiting %v", fn, d))
+			select {
+			case <-time.After(d):
+				continue
+			case <-ctx.Done():
+				return res, ctx.Err()
+			}
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if out == nil || len(bytes.TrimSpace(body)) == 0 {
+			return res, nil
+		}
+		if err := json.Unmarshal(body, out); err != nil && res.StatusCode < 400 {
+			return res, fmt.Errorf("unable to decode %s answer: %v", fn, err)
+		}
+		return res, nil
+	}
+}
+
+// throttled reports whether SKUVault turned a call away
+// for coming too soon.
+func throttled(res *http.Response, body []byte) bool {
+	if res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	var status struct{ Status string }
+	json.Unmarshal(body, &status)
+	return strings.EqualFold(status.Status, "Throttled")
+}
+
+// authed adds the current tokens to a request's params.
+func authed(params map[string]interface{}) map[string]interface{} {
+	toks := currentTokens()
+	req := map[string]interface{}{
+		"TenantToken": toks.TenantToken,
+		"UserToken":   toks.UserToken,
+	}
+	for k, v := range params {
+		req[k] = v
+	}
+	return req
+}
+
+// answerErr turns an error status into an error.
+func answerErr(fn string, res *http.Response, err error) error {
+	if err == nil && res.StatusCode >= 400 {
+		err = fmt.Errorf("%s answered %s", fn, res.Status)
+	}
+	return err
+}
+
+// SetItemQuantities posts plain items' quantities.
+func (c vaultClient) SetItemQuantities(ctx context.Context, items []Item) (*http.Response, ResponseBody, error) {
+	return c.setQuantities(ctx, "inventory/setItemQuantities", items)
+}
+
+// SetLotItemQuantities posts lot-tracked items' quantities
+// to LotFunction.
+func (c vaultClient) SetLotItemQuantities(ctx context.Context, items []Item) (*http.Response, ResponseBody, error) {
+	return c.setQuantities(ctx, cfg.LotFunction, items)
+}
+
+// setQuantities posts a bulk quantity payload to fn once;
+// writeVault retries it.
+func (c vaultClient) setQuantities(ctx context.Context, fn string, items []Item) (*http.Response, ResponseBody, error) {
+	toks := currentTokens()
+	var body ResponseBody
+	res, err := c.send(ctx, fn, Payload{Items: items, TenantToken: toks.TenantToken, UserToken: toks.UserToken}, &body)
+	return res, body, err
+}
+
+// SetItemQuantity posts one item's quantity to SingleFunction
+// once; writeVault retries it.
+func (c vaultClient) SetItemQuantity(ctx context.Context, iv Item) (*http.Response, ResponseBody, error) {
+	toks := currentTokens()
+	var body ResponseBody
+	res, err := c.send(ctx, cfg.SingleFunction, singleItem{iv, toks.TenantToken, toks.UserToken}, &body)
+	return res, body, err
+}
+
+// UpdateProducts posts products' cost and prices.
+func (c vaultClient) UpdateProducts(ctx context.Context, items []PriceItem) (*http.Response, ResponseBody, error) {
+	toks := currentTokens()
+	var body ResponseBody
+	res, err := c.call(ctx, "products/updateProducts", pricePayload{items, toks.TenantToken, toks.UserToken}, &body)
+	return res, body, err
+}
+
+// CreatePO creates a purchase order.
+func (c vaultClient) CreatePO(ctx context.Context, d poDraft) (*http.Response, ResponseBody, error) {
+	toks := currentTokens()
+	d.TenantToken, d.UserToken = toks.TenantToken, toks.UserToken
+	var body ResponseBody
+	res, err := c.call(ctx, "purchaseorders/createPO", d, &body)
+	return res, body, err
+}
+
+// GetTokens trades an account login for tokens.
+func (c vaultClient) GetTokens(ctx context.Context, email, password string) (*SkuTokens, error) {
+	toks := &SkuTokens{}
+	res, err := c.call(ctx, "getTokens", map[string]string{"Email": email, "Password": password}, toks)
+	if err = answerErr("getTokens", res, err); err != nil {
+		return nil, err
+	}
+	if toks.TenantToken == "" {
+		return nil, fmt.Errorf("getTokens answered no tokens")
+	}
+	toks.Fetched = time.Now()
+	return toks, nil
+}
+
+// GetWarehouses lists one page of warehouses; an empty
+// page follows the last.
+func (c vaultClient) GetWarehouses(ctx context.Context, page int) ([]Warehouse, error) {
+	var body struct{ Warehouses []Warehouse }
+	res, err := c.call(ctx, "inventory/getWarehouses", authed(map[string]interface{}{"PageNumber": page}), &body)
+	return body.Warehouses, answerErr("inventory/getWarehouses", res, err)
+}
+
+// GetProducts lists every product.
+func (c vaultClient) GetProducts(ctx context.Context) ([]Product, error) {
+	var ps []Product
+	err := c.pages(ctx, "products/getProducts", nil, func() (interface{}, func() int) {
+		var body struct{ Products []Product }
+		return &body, func() int {
+			ps = append(ps, body.Products...)
+			return len(body.Products)
+		}
+	})
+	return ps, err
+}
+
+// GetKits lists every kit.
+func (c vaultClient) GetKits(ctx context.Context) ([]Kit, error) {
+	var ks []Kit
+	err := c.pages(ctx, "products/getKits", nil, func() (interface{}, func() int) {
+		var body struct{ Kits []Kit }
+		return &body, func() int {
+			ks = append(ks, body.Kits...)
+			return len(body.Kits)
+		}
+	})
+	return ks, err
+}
+
+// GetAvailableQuantities lists available quantities
+// across all warehouses.
+func (c vaultClient) GetAvailableQuantities(ctx context.Context) ([]Available, error) {
+	var as []Available
+	err := c.pages(ctx, "inventory/getAvailableQuantities", nil, func() (interface{}, func() int) {
+		var body struct{ Items []Available }
+		return &body, func() int {
+			as = append(as, body.Items...)
+			return len(body.Items)
+		}
+	})
+	return as, err
+}
+
+// GetSalesByDate lists sales made between two times.
+func (c vaultClient) GetSalesByDate(ctx context.Context, from, to time.Time) ([]Sale, error) {
+	params := map[string]interface{}{
+		"DateField": "SaleDate",
+		"FromDate":  from.UTC().Format(time.RFC3339),
+		"ToDate":    to.UTC().Format(time.RFC3339),
+	}
+	var ss []Sale
+	err := c.pages(ctx, "sales/getSalesByDate", params, func() (interface{}, func() int) {
+		var body struct{ Sales []Sale }
+		return &body, func() int {
+			ss = append(ss, body.Sales...)
+			return len(body.Sales)
+		}
+	})
+	return ss, err
+}
+
+// pages calls a paged SKUVault function with any extra params
+// until it gives a short page. For each page, page gives the
+// value to decode into and a func that keeps its entries and
+// says how many there were.
+func (c vaultClient) pages(ctx context.Context, fn string, params map[string]interface{}, page func() (interface{}, func() int)) error {
+	req := authed(params)
+	req["PageSize"] = catalogPageSize
+	for n := 0; ; n++ {
+		req["PageNumber"] = n
+		out, keep := page()
+		res, err := c.call(ctx, fn, req, out)
+		if err = answerErr(fn, res, err); err != nil {
+			return err
+		}
+		if keep() < catalogPageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// vendorCmd manages vendor profiles in buffers.json.
+//
+//	drive2sku vendor add [-name acme] [-sample file] [-contact email] [-parent folder-id]
+//	drive2sku vendor disable|enable <name>
+func vendorCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku vendor add|disable|enable ...")
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "add":
+		vendorAdd(args[1:])
+	case "disable", "enable":
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "usage: drive2sku vendor %s <name>\n", args[0])
+			os.Exit(2)
+		}
+		if err := setDisabled(args[1], args[0] == "disable"); err != nil {
+			log.Fatalf("Unable to %s %s: %v", args[0], args[1], err)
+		}
+		say(fmt.Sprintf("%s is %sd", args[1], args[0]))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown vendor command %q\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// vendorAdd onboards a vendor: it builds a starter profile
+// from a sample file, validates the sample with it, posts
+// it to the mock vault end to end, and only then creates
+// the vendor's Drive folder and saves the profile. Anything
+// not given as a flag is asked for.
+func vendorAdd(args []string) {
+	fs := flag.NewFlagSet("vendor add", flag.ExitOnError)
+	name := fs.String("name", "", "vendor name")
+	sample := fs.String("sample", "", "sample file the vendor sends")
+	contact := fs.String("contact", "", "email for notices about rejected files")
+	weekday := fs.Int("weekday", -1, "weekday quantity buffer")
+	weekend := fs.Int("weekend", -1, "weekend quantity buffer")
+	parent := fs.String("parent", "", "Drive folder to create the vendor's folder in; blank is My Drive")
+	fs.Parse(args)
+
+	*name = ask("Vendor name", *name)
+	*sample = ask("Sample file", *sample)
+	*contact = ask("Contact email (optional)", *contact)
+	vs := VendorSettings{
+		WeekdayBuffer: askInt("Weekday buffer", *weekday),
+		WeekendBuffer: askInt("Weekend buffer", *weekend),
+		Contact:       *contact,
+	}
+	if *name == "" || *sample == "" {
+		log.Fatalf("A vendor name and sample file are needed")
+	}
+
+	// the end-to-end test must never reach production
+	*mockVault = true
+	readConfig()
+	readBufferSettings()
+	if _, ok := settings[*name]; ok {
+		log.Fatalf("Vendor %q is already in buffers.json", *name)
+	}
+
+	if ext := strings.ToLower(filepath.Ext(*sample)); ext != ".json" {
+		vs.Mapping = sampleMapping(*sample)
+	}
+	settings[*name] = vs
+	localVendor = *name
+
+	say(fmt.Sprintf("Validating %s", *sample))
+	vsd := readLocalFile(*sample)
+
+	say("Posting the sample to the mock vault")
+	initDriveAndVault()
+	postLocal(*sample, vsd)
+	if summary.Payloads == 0 || summary.Succeeded < summary.Payloads || summary.ItemsSent < summary.Items {
+		log.Fatalf("The mock vault did not accept the sample; %s was not added", *name)
+	}
+	if n := len(summary.Quarantined); n > 0 {
+		say(fmt.Sprintf("%d sample items were quarantined for unknown warehouses", n))
+	}
+
+	f, err := drv.Files.Create(&drive.File{Name: *name, MimeType: folderMime, Parents: parentsFor(*parent)}).Do()
+	if err != nil {
+		log.Fatalf("Unable to create the vendor's folder: %v", explainDrive(err))
+	}
+	vs.Folder = f.Id
+	if err := addVendor(*name, vs); err != nil {
+		log.Fatalf("Unable to save %s to buffers.json: %v", *name, err)
+	}
+	say(fmt.Sprintf("Added %s with folder %s; it goes live on the next run", *name, f.Id))
+}
+
+// folderMime is the MIME type of a Drive folder.
+const folderMime = "application/vnd.google-apps.folder"
+
+// parentsFor gives the parents of a new file, none when
+// it belongs in My Drive.
+func parentsFor(id string) []string {
+	if id == "" {
+		return nil
+	}
+	return []string{id}
+}
+
+// sampleMapping infers a mapping from a tabular sample,
+// refusing one missing its Sku or Quantity column.
+func sampleMapping(path string) *Mapping {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Unable to open sample file: %v", err)
+	}
+	defer f.Close()
+	rows, err := readRows(path, f)
+	if err != nil {
+		log.Fatalf("Unable to read sample file: %v", err)
+	}
+	if len(rows) == 0 {
+		log.Fatalf("Sample file %s has no header row", path)
+	}
+	m := inferMapping(rows)
+	m.Match = matchPattern(path)
+	if m.Sku == "" || m.Quantity == "" {
+		log.Fatalf("No Sku or Quantity column found in %s; write the mapping with genmap instead", path)
+	}
+	return m
+}
+
+// addVendor writes a vendor's profile into buffers.json.
+func addVendor(name string, vs VendorSettings) error {
+	return editBuffers(func(raw map[string]json.RawMessage) (err error) {
+		raw[name], err = json.Marshal(vs)
+		return err
+	})
+}
+
+// setDisabled turns a vendor's Disabled switch on or off.
+func setDisabled(name string, off bool) error {
+	return editBuffers(func(raw map[string]json.RawMessage) error {
+		if _, ok := raw[name]; !ok {
+			return fmt.Errorf("no vendor %q", name)
+		}
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw[name], &fields); err != nil {
+			return err
+		}
+		if off {
+			fields["Disabled"] = json.RawMessage("true")
+		} else {
+			delete(fields, "Disabled")
+		}
+		b, err := json.Marshal(fields)
+		raw[name] = b
+		return err
+	})
+}
+
+// editBuffers rewrites buffers.json through edit, leaving
+// the entries it does not touch as they are.
+func editBuffers(edit func(raw map[string]json.RawMessage) error) error {
+	raw := map[string]json.RawMessage{}
+	b, err := ioutil.ReadFile("buffers.json")
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if err := edit(raw); err != nil {
+		return err
+	}
+	return writeJSON("buffers.json", raw)
+}
+
+// disabledVendors lists the vendors switched off, sorted.
+func disabledVendors() []string {
+	var names []string
+	for _, vendor := range vendorNames() {
+		if settings[vendor].Disabled {
+			names = append(names, vendor)
+		}
+	}
+	return names
+}
+
+// skipDisabled drops the files claimed by a disabled
+// vendor's mapping, leaving them pending.
+func skipDisabled(fls []*drive.File) []*drive.File {
+	var keep []*drive.File
+	for _, f := range fls {
+		if vendor, ok := fileVendor(f.Name); ok && settings[vendor].Disabled {
+			echoAt(levelVerbose, fmt.Sprintf("Leaving %s pending; %s is disabled", f.Name, vendor))
+			continue
+		}
+		keep = append(keep, f)
+	}
+	return keep
+}
+
+// ask prompts for a value on the console unless it
+// was already given.
+func ask(question, given string) string {
+	if given != "" {
+		return given
+	}
+	fmt.Printf("%s: ", question)
+	answer, _ := console.ReadString('\n')
+	return strings.TrimSpace(answer)
+}
+
+// askInt prompts for a whole number unless one was given
+// (non-negative); a blank answer is zero.
+func askInt(question string, given int) int {
+	if given >= 0 {
+		return given
+	}
+	for {
+		answer := ask(question, "")
+		if answer == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 0 {
+			return n
+		}
+		fmt.Println("Enter a whole number.")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// output levels, from summaries only to per-item detail
+const (
+	levelQuiet = iota
+	levelNormal
+	levelVerbose
+	levelDebug
+)
+
+var (
+	quiet       = flag.Bool("q", false, "only print warnings and summaries")
+	verbose     = flag.Bool("v", false, "print per-payload detail")
+	veryVerbose = flag.Bool("vv", false, "print per-item detail")
+)
+
+// verbosity is the output level chosen on the command line.
+func verbosity() int {
+	switch {
+	case *veryVerbose:
+		return levelDebug
+	case *verbose:
+		return levelVerbose
+	case *quiet:
+		return levelQuiet
+	}
+	return levelNormal
+}
+
+// echoAt echoes a message only at or above an output level.
+func echoAt(level int, s string) {
+	if verbosity() >= level {
+		echo(s)
+	}
+}
+
+// echoItem echoes a single payload item, for -vv.
+func echoItem(vendor string, iv Item) {
+	if verbosity() < levelDebug {
+		return
+	}
+	echo(fmt.Sprintf("%s: %s x%d @ %s/%d", vendor, iv.Sku, iv.Quantity, iv.LocationCode, iv.WarehouseID))
+}
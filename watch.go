@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// watchFile persists the Drive changes channel and the
+// change-feed position between notifications.
+const watchFile = "watch.json"
+
+// watchState is the persisted form of a Drive changes channel.
+type watchState struct {
+	ChannelID  string
+	ResourceID string
+	Address    string
+
+	// Expiration is in unix milliseconds, as Drive reports it.
+	Expiration int64
+
+	// PageToken is the change-feed position already processed.
+	PageToken string
+}
+
+// watchCmd registers a Drive changes channel delivering to
+// an HTTPS address (the serve command's /drive endpoint, or a
+// relay publishing to Pub/Sub), replacing any existing one.
+//
+//	drive2sku watch -address https://host/drive [-ttl 168h]
+//	drive2sku watch -stop
+func watchCmd(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	address := fs.String("address", "", "HTTPS address notifications are delivered to")
+	ttl := fs.Duration("ttl", 7*24*time.Hour, "requested channel lifetime")
+	stop := fs.Bool("stop", false, "stop the current channel")
+	fs.Parse(args)
+
+	readConfig()
+	initDriveAndVault()
+
+	var st watchState
+	if err := readJSON(statePath(watchFile), &st); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Unable to read watch state: %v", err)
+	}
+	if *stop {
+		stopWatch(&st)
+		return
+	}
+	if *address == "" {
+		*address = st.Address
+	}
+	if *address == "" {
+		fmt.Fprintln(os.Stderr, "usage: drive2sku watch -address https://host/drive [-ttl 168h]")
+		os.Exit(2)
+	}
+
+	if err := startWatch(&st, *address, *ttl); err != nil {
+		log.Fatalf("Unable to watch Drive changes: %v", err)
+	}
+}
+
+// startWatch opens a new channel, then stops the old one
+// so no notification window is missed.
+func startWatch(st *watchState, address string, ttl time.Duration) error {
+	if st.PageToken == "" {
+		spt, err := drv.Changes.GetStartPageToken().Do()
+		if err != nil {
+			return err
+		}
+		st.PageToken = spt.StartPageToken
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	ch, err := drv.Changes.Watch(st.PageToken, &drive.Channel{
+		Id:         hex.EncodeToString(id),
+		Type:       "web_hook",
+		Address:    address,
+		Token:      cfg.WatchToken,
+		Expiration: time.Now().Add(ttl).UnixNano() / int64(time.Millisecond),
+	}).Do()
+	if err != nil {
+		return err
+	}
+
+	old := *st
+	st.ChannelID, st.ResourceID, st.Address, st.Expiration = ch.Id, ch.ResourceId, address, ch.Expiration
+	if err := writeJSON(statePath(watchFile), st); err != nil {
+		return err
+	}
+	echo(fmt.Sprintf("Watching Drive changes until %s", time.Unix(0, st.Expiration*int64(time.Millisecond)).Format(time.RFC1123)))
+
+	if old.ChannelID != "" {
+		stopWatch(&old)
+	}
+	return nil
+}
+
+// stopWatch stops a channel; failures are only logged
+// since an expired channel cannot be stopped anyway.
+func stopWatch(st *watchState) {
+	if st.ChannelID == "" {
+		return
+	}
+	err := drv.Channels.Stop(&drive.Channel{Id: st.ChannelID, ResourceId: st.ResourceID}).Do()
+	if err != nil {
+		log.Printf("Unable to stop watch channel %s: %v", st.ChannelID, err)
+		return
+	}
+	echo(fmt.Sprintf("Stopped watch channel %s", st.ChannelID))
+}
+
+// keepWatching renews the saved channel a day before
+// it expires, for as long as the subscriber runs.
+func keepWatching() {
+	for ; ; time.Sleep(time.Hour) {
+		var st watchState
+		if err := readJSON(statePath(watchFile), &st); err != nil || st.Address == "" {
+			continue
+		}
+		exp := time.Unix(0, st.Expiration*int64(time.Millisecond))
+		if time.Until(exp) > 24*time.Hour {
+			continue
+		}
+		invokeWith(func() {
+			if err := startWatch(&st, st.Address, 7*24*time.Hour); err != nil {
+				log.Printf("Unable to renew watch channel: %v", err)
+			}
+		})
+	}
+}
+
+// pendingChanges lists changes after the given feed position,
+// returning the pending-folder files among them and the
+// position to resume from next time.
+func pendingChanges(token string) ([]*drive.File, string, error) {
+	var fls []*drive.File
+	for token != "" {
+		cl, err := drv.Changes.List(token).Fields("nextPageToken,newStartPageToken,changes(fileId,removed,file(trashed," + pendingFields + "))").Do()
+		if err != nil {
+			return nil, token, err
+		}
+		for _, c := range cl.Changes {
+			if c.Removed || c.File == nil || c.File.Trashed || c.File.Name == lockName {
+				continue
+			}
+			for _, p := range c.File.Parents {
+				if inboxFolder(p) {
+					fls = append(fls, c.File)
+					break
+				}
+			}
+		}
+		if cl.NewStartPageToken != "" {
+			return fls, cl.NewStartPageToken, nil
+		}
+		token = cl.NextPageToken
+	}
+	return fls, token, nil
+}
+
+// noticeWait is how long a notice waits between tries
+// while another run is going.
+const noticeWait = 10 * time.Second
+
+// noticeCh holds a notice waiting to be processed; notices
+// arriving meanwhile fold into it, since each one processes
+// every change since the last.
+var noticeCh = make(chan struct{}, 1)
+
+// watchNotices processes notices one at a time in the
+// background, waiting out any run already going.
+func watchNotices() {
+	for range noticeCh {
+		for !processNotice() {
+			time.Sleep(noticeWait)
+		}
+	}
+}
+
+// processNotice relays exactly the files changed since the
+// last notice, reporting false if a run was already going.
+// The change position only moves past the files once their
+// run finishes cleanly, so any left pending or failed are
+// seen again with the next notice.
+func processNotice() bool {
+	return invokeWith(func() {
+		var st watchState
+		if err := readJSON(statePath(watchFile), &st); err != nil {
+			log.Printf("Unable to read watch state: %v", err)
+			return
+		}
+		fls, next, err := pendingChanges(st.PageToken)
+		if err != nil {
+			log.Printf("Unable to list Drive changes: %v", err)
+			return
+		}
+		if len(fls) > 0 {
+			relay(func() {
+				defer wg.Done()
+				processFiles(skipDisabled(fls))
+			})
+			if !summary.clean() {
+				say("Keeping the Drive change position; the run did not finish cleanly")
+				return
+			}
+		}
+		st.PageToken = next
+		if err := writeJSON(statePath(watchFile), &st); err != nil {
+			log.Printf("Unable to save watch state: %v", err)
+		}
+	})
+}
+
+// handleDriveNotice receives Drive's web_hook notifications.
+func handleDriveNotice(w http.ResponseWriter, r *http.Request) {
+	noticeReply(w, r.Header.Get("X-Goog-Channel-Token"), r.Header.Get("X-Goog-Resource-State"))
+}
+
+// handlePubSubNotice receives notifications relayed through
+// a Pub/Sub push subscription, Drive's headers carried along
+// as message attributes.
+func handlePubSubNotice(w http.ResponseWriter, r *http.Request) {
+	var env struct {
+		Message struct {
+			Attributes map[string]string
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attrs := env.Message.Attributes
+	noticeReply(w, attrs["X-Goog-Channel-Token"], attrs["X-Goog-Resource-State"])
+}
+
+// noticeReply authenticates a notice and acknowledges it at
+// once, well within Drive's and Pub/Sub's deadlines, leaving
+// watchNotices to process it.
+func noticeReply(w http.ResponseWriter, token, state string) {
+	if cfg.WatchToken != "" && token != cfg.WatchToken {
+		http.Error(w, "bad channel token", http.StatusForbidden)
+		return
+	}
+	// "sync" only confirms a new channel
+	if state == "sync" {
+		return
+	}
+	select {
+	case noticeCh <- struct{}{}:
+	default:
+	}
+}